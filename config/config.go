@@ -0,0 +1,519 @@
+// Package config loads the application configuration from a JSON file and IMAGE_* environment variables
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultFile is the configuration file read when IMAGE_CONFIG_FILE is not set (it may not exist)
+const DefaultFile = "config/config.json"
+
+// formats the inputs and outputs can be restricted to
+var (
+	InputFormats  = []string{"png", "jpg", "jpeg", "bmp"}
+	OutputFormats = []string{"jpeg", "png", "webp", "avif"}
+)
+
+// exporters of the traces
+const (
+	TracingNone   = "none"
+	TracingOTLP   = "otlp"
+	TracingStdout = "stdout"
+	TracingFile   = "file"
+)
+
+var TracingExporters = []string{TracingNone, TracingOTLP, TracingStdout, TracingFile}
+
+// Operations are the rate limited operations, named after their endpoint (resize for /image-resize, luts for
+// /luts, static for the conversions of /static/*), to be kept in sync with the routes of the server
+var Operations = []string{
+	"adjust", "animate", "animation", "compression", "crop", "effect", "faces", "filter", "luts", "mask", "pad",
+	"pipeline", "png-to-jpeg", "resize", "responsive", "static", "watermark",
+}
+
+type Config struct {
+	Server  Server  `json:"server"`
+	Storage Storage `json:"storage"`
+	Limits  Limits  `json:"limits"`
+	Images  Images  `json:"images"`
+	Workers Workers `json:"workers"`
+	Tracing Tracing `json:"tracing"`
+	Auth    Auth    `json:"auth"`
+	// RateLimits bound the requests of every client (API key, or IP without key) on the image endpoints
+	RateLimits RateLimits `json:"rate_limits"`
+}
+
+type Server struct {
+	// Address is the listen address (host:port)
+	Address string `json:"address"`
+	// TLSCert and TLSKey enable HTTPS when both are set
+	TLSCert string `json:"tls_cert"`
+	TLSKey  string `json:"tls_key"`
+	// Views is the glob pattern of the HTML templates
+	Views string `json:"views"`
+	// ShutdownTimeout bounds the wait for the running and queued image operations when the server stops
+	ShutdownTimeout Duration `json:"shutdown_timeout"`
+	// TrustProxy reads the client IP from the X-Forwarded-For header of the private network proxies
+	TrustProxy bool `json:"trust_proxy"`
+}
+
+// Duration is a time.Duration written as a string in the configuration (e.g. "30s" or "1m30s")
+type Duration time.Duration
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var value string
+	if err := json.Unmarshal(data, &value); err != nil {
+		return errors.New("durations must be strings (e.g. \"30s\")")
+	}
+	return d.parse(value)
+}
+
+func (d *Duration) parse(value string) error {
+	v, err := time.ParseDuration(value)
+	if err != nil {
+		return fmt.Errorf("invalid duration %q (e.g. 30s or 1m30s)", value)
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// Storage paths are relative to Root, which defaults to the working directory
+type Storage struct {
+	Root        string `json:"root"`
+	Uploads     string `json:"uploads"`
+	Public      string `json:"public"`
+	Watermarks  string `json:"watermarks"`
+	Luts        string `json:"luts"`
+	FaceCascade string `json:"face_cascade"`
+	Presets     string `json:"presets"`
+}
+
+type Limits struct {
+	// MaxUploadBytes bounds the request bodies, MaxPixels the dimensions (width x height) of the uploaded images
+	MaxUploadBytes int64 `json:"max_upload_bytes"`
+	MaxPixels      int64 `json:"max_pixels"`
+	MaxLutBytes    int64 `json:"max_lut_bytes"`
+}
+
+type Images struct {
+	DefaultQuality int `json:"default_quality"`
+	// InputFormats are accepted by the image endpoints, OutputFormats restrict the available encoders (jpeg
+	// and png are always needed as fallback formats)
+	InputFormats  []string `json:"input_formats"`
+	OutputFormats []string `json:"output_formats"`
+}
+
+type Workers struct {
+	// Processing is the number of image operations running at once, the others wait for a free worker
+	Processing int `json:"processing"`
+	// OpenCVThreads is the number of threads of the OpenCV functions (0 keeps the OpenCV default)
+	OpenCVThreads int `json:"opencv_threads"`
+}
+
+type Tracing struct {
+	// Exporter sends the spans to an OTLP collector (otlp), prints them (stdout) or appends them to File (file)
+	Exporter string `json:"exporter"`
+	// Endpoint is the URL of the OTLP/HTTP collector (the OTEL_EXPORTER_OTLP_* variables apply when not set)
+	Endpoint    string `json:"endpoint"`
+	File        string `json:"file"`
+	ServiceName string `json:"service_name"`
+	// SampleRatio is the fraction of the requests traced (the sampling decision of the callers is kept)
+	SampleRatio float64 `json:"sample_ratio"`
+}
+
+type Auth struct {
+	// Enabled requires an API key on the image endpoints
+	Enabled bool `json:"enabled"`
+	// KeysFile stores the API keys and their usage (relative to storage.root)
+	KeysFile string `json:"keys_file"`
+	// AdminKey grants access to the /admin endpoints, which are disabled when not set
+	AdminKey string `json:"admin_key"`
+}
+
+// RateLimit bounds the requests of a client on a route (0 disables a limit)
+type RateLimit struct {
+	// Rate is the sustained number of requests per second, Burst the number of requests accepted at once
+	Rate  float64 `json:"rate"`
+	Burst int     `json:"burst"`
+	// Concurrency is the number of image operations of the client running or waiting for a worker at once,
+	// over every route for the default limits and on the route for the limits of a route
+	Concurrency int `json:"concurrency"`
+}
+
+type RateLimits struct {
+	Default RateLimit `json:"default"`
+	// Routes replace the default rate and burst of the operations (resize for /image-resize, luts for /luts),
+	// their concurrency bounds the operations of the route on top of the default one
+	Routes map[string]RateLimit `json:"routes"`
+}
+
+// Route returns the limits of the operation
+func (rl RateLimits) Route(operation string) RateLimit {
+	if limit, ok := rl.Routes[operation]; ok {
+		return limit
+	}
+	return rl.Default
+}
+
+// minAdminKeyLength is the minimum length of the admin key
+const minAdminKeyLength = 16
+
+// Default returns the built-in configuration
+func Default() *Config {
+	return &Config{
+		Server: Server{
+			Address:         ":9000",
+			Views:           "views/*.html",
+			ShutdownTimeout: Duration(30 * time.Second),
+		},
+		Storage: Storage{
+			Uploads:     filepath.Join("storages", "uploads"),
+			Public:      filepath.Join("storages", "public"),
+			Watermarks:  filepath.Join("storages", "watermarks"),
+			Luts:        filepath.Join("storages", "luts"),
+			FaceCascade: filepath.Join("storages", "cascades", "haarcascade_frontalface_default.xml"),
+			Presets:     filepath.Join("config", "presets.json"),
+		},
+		Limits: Limits{
+			MaxUploadBytes: 32 << 20,
+			MaxPixels:      100_000_000,
+			MaxLutBytes:    16 << 20,
+		},
+		Images: Images{
+			DefaultQuality: 80,
+			InputFormats:   slices.Clone(InputFormats),
+			OutputFormats:  slices.Clone(OutputFormats),
+		},
+		Workers: Workers{
+			Processing: runtime.NumCPU(),
+		},
+		Tracing: Tracing{
+			Exporter:    TracingNone,
+			ServiceName: "go-http-image-manipulation",
+			SampleRatio: 1,
+		},
+		Auth: Auth{
+			KeysFile: filepath.Join("storages", "apikeys.json"),
+		},
+	}
+}
+
+// Load reads the configuration: the built-in defaults, overridden by the file (IMAGE_CONFIG_FILE, or
+// config/config.json when it exists), then by the environment variables. The result is validated.
+func Load() (*Config, error) {
+	cfg := Default()
+	path := os.Getenv("IMAGE_CONFIG_FILE")
+	explicit := path != ""
+	if !explicit {
+		path = DefaultFile
+	}
+	data, err := os.ReadFile(path)
+	if err == nil {
+		if err := cfg.decode(data); err != nil {
+			return nil, fmt.Errorf("invalid configuration file %s: %w", path, err)
+		}
+	} else if explicit || !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to read the configuration file: %w", err)
+	}
+	if err := cfg.applyEnv(os.LookupEnv); err != nil {
+		return nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// decode overrides the configuration with the JSON document, rejecting unknown fields
+func (cfg *Config) decode(data []byte) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	return decoder.Decode(cfg)
+}
+
+// envString, envBool, envInt, envFloat and envList parse an environment variable into the field
+func envString(field *string) func(string) error {
+	return func(value string) error {
+		*field = value
+		return nil
+	}
+}
+
+func envBool(field *bool) func(string) error {
+	return func(value string) error {
+		v, err := strconv.ParseBool(value)
+		if err != nil {
+			return errors.New("must be a boolean (true or false)")
+		}
+		*field = v
+		return nil
+	}
+}
+
+func envInt[T int | int64](field *T) func(string) error {
+	return func(value string) error {
+		v, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return errors.New("must be a number")
+		}
+		*field = T(v)
+		return nil
+	}
+}
+
+func envFloat(field *float64) func(string) error {
+	return func(value string) error {
+		v, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return errors.New("must be a number")
+		}
+		*field = v
+		return nil
+	}
+}
+
+func envList(field *[]string) func(string) error {
+	return func(value string) error {
+		*field = []string{}
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.ToLower(strings.TrimSpace(item)); item != "" {
+				*field = append(*field, item)
+			}
+		}
+		return nil
+	}
+}
+
+// applyEnv overrides the configuration with the IMAGE_* environment variables
+func (cfg *Config) applyEnv(lookup func(string) (string, bool)) error {
+	vars := []struct {
+		name  string
+		parse func(string) error
+	}{
+		{"IMAGE_ADDRESS", envString(&cfg.Server.Address)},
+		{"IMAGE_TLS_CERT", envString(&cfg.Server.TLSCert)},
+		{"IMAGE_TLS_KEY", envString(&cfg.Server.TLSKey)},
+		{"IMAGE_VIEWS", envString(&cfg.Server.Views)},
+		{"IMAGE_TRUST_PROXY", envBool(&cfg.Server.TrustProxy)},
+		{"IMAGE_SHUTDOWN_TIMEOUT", cfg.Server.ShutdownTimeout.parse},
+		{"IMAGE_STORAGE_ROOT", envString(&cfg.Storage.Root)},
+		{"IMAGE_STORAGE_UPLOADS", envString(&cfg.Storage.Uploads)},
+		{"IMAGE_STORAGE_PUBLIC", envString(&cfg.Storage.Public)},
+		{"IMAGE_STORAGE_WATERMARKS", envString(&cfg.Storage.Watermarks)},
+		{"IMAGE_STORAGE_LUTS", envString(&cfg.Storage.Luts)},
+		{"IMAGE_STORAGE_FACE_CASCADE", envString(&cfg.Storage.FaceCascade)},
+		{"IMAGE_STORAGE_PRESETS", envString(&cfg.Storage.Presets)},
+		{"IMAGE_MAX_UPLOAD_BYTES", envInt(&cfg.Limits.MaxUploadBytes)},
+		{"IMAGE_MAX_PIXELS", envInt(&cfg.Limits.MaxPixels)},
+		{"IMAGE_MAX_LUT_BYTES", envInt(&cfg.Limits.MaxLutBytes)},
+		{"IMAGE_DEFAULT_QUALITY", envInt(&cfg.Images.DefaultQuality)},
+		{"IMAGE_INPUT_FORMATS", envList(&cfg.Images.InputFormats)},
+		{"IMAGE_OUTPUT_FORMATS", envList(&cfg.Images.OutputFormats)},
+		{"IMAGE_WORKERS", envInt(&cfg.Workers.Processing)},
+		{"IMAGE_OPENCV_THREADS", envInt(&cfg.Workers.OpenCVThreads)},
+		{"IMAGE_TRACING_EXPORTER", envString(&cfg.Tracing.Exporter)},
+		{"IMAGE_TRACING_ENDPOINT", envString(&cfg.Tracing.Endpoint)},
+		{"IMAGE_TRACING_FILE", envString(&cfg.Tracing.File)},
+		{"IMAGE_TRACING_SERVICE_NAME", envString(&cfg.Tracing.ServiceName)},
+		{"IMAGE_TRACING_SAMPLE_RATIO", envFloat(&cfg.Tracing.SampleRatio)},
+		{"IMAGE_AUTH_ENABLED", envBool(&cfg.Auth.Enabled)},
+		{"IMAGE_AUTH_KEYS_FILE", envString(&cfg.Auth.KeysFile)},
+		{"IMAGE_AUTH_ADMIN_KEY", envString(&cfg.Auth.AdminKey)},
+		{"IMAGE_RATE_LIMIT", envFloat(&cfg.RateLimits.Default.Rate)},
+		{"IMAGE_RATE_BURST", envInt(&cfg.RateLimits.Default.Burst)},
+		{"IMAGE_CLIENT_CONCURRENCY", envInt(&cfg.RateLimits.Default.Concurrency)},
+	}
+	for _, v := range vars {
+		if value, ok := lookup(v.name); ok {
+			if err := v.parse(value); err != nil {
+				return fmt.Errorf("invalid environment variable %s: %w", v.name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// RootPath returns the storage root (the working directory when not set)
+func (cfg *Config) RootPath() string {
+	if cfg.Storage.Root != "" {
+		return cfg.Storage.Root
+	}
+	cwd, _ := os.Getwd()
+	return cwd
+}
+
+// Path resolves a storage path against the root
+func (cfg *Config) Path(path string) string {
+	return filepath.Join(cfg.RootPath(), path)
+}
+
+// checkDirectory tells why the path is not an existing directory
+func checkDirectory(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("%s does not exist", path)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", path)
+	}
+	return nil
+}
+
+// Validate checks every setting and reports all the invalid ones, named after their JSON path
+func (cfg *Config) Validate() error {
+	errs := []error{}
+	invalid := func(field string, format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf("%s: %s", field, fmt.Sprintf(format, args...)))
+	}
+
+	if cfg.Server.Address == "" {
+		invalid("server.address", "must not be empty")
+	}
+	if (cfg.Server.TLSCert == "") != (cfg.Server.TLSKey == "") {
+		invalid("server.tls_cert", "tls_cert and tls_key must be set together")
+	}
+	for field, path := range map[string]string{"server.tls_cert": cfg.Server.TLSCert, "server.tls_key": cfg.Server.TLSKey} {
+		if _, err := os.Stat(path); path != "" && err != nil {
+			invalid(field, "%s does not exist", path)
+		}
+	}
+	if matches, err := filepath.Glob(cfg.Server.Views); err != nil || len(matches) == 0 {
+		invalid("server.views", "%q matches no template", cfg.Server.Views)
+	}
+	if cfg.Server.ShutdownTimeout <= 0 {
+		invalid("server.shutdown_timeout", "must be greater than 0")
+	}
+
+	if err := checkDirectory(cfg.RootPath()); err != nil {
+		invalid("storage.root", err.Error())
+	}
+	for _, dir := range []struct{ field, path string }{
+		{"storage.uploads", cfg.Storage.Uploads},
+		{"storage.public", cfg.Storage.Public},
+		{"storage.watermarks", cfg.Storage.Watermarks},
+		{"storage.luts", cfg.Storage.Luts},
+	} {
+		if dir.path == "" || filepath.IsAbs(dir.path) {
+			invalid(dir.field, "must be a path relative to storage.root")
+		} else if err := checkDirectory(cfg.Path(dir.path)); err != nil {
+			invalid(dir.field, err.Error())
+		}
+	}
+	for _, file := range []struct{ field, path string }{
+		{"storage.face_cascade", cfg.Storage.FaceCascade},
+		{"storage.presets", cfg.Storage.Presets},
+	} {
+		// the files are optional: faces are not detected without cascade, and there are no presets without file
+		if file.path == "" || filepath.IsAbs(file.path) {
+			invalid(file.field, "must be a path relative to storage.root")
+		}
+	}
+
+	if cfg.Limits.MaxUploadBytes <= 0 {
+		invalid("limits.max_upload_bytes", "must be greater than 0")
+	}
+	if cfg.Limits.MaxPixels <= 0 {
+		invalid("limits.max_pixels", "must be greater than 0")
+	}
+	if cfg.Limits.MaxLutBytes <= 0 {
+		invalid("limits.max_lut_bytes", "must be greater than 0")
+	}
+
+	if cfg.Images.DefaultQuality < 1 || cfg.Images.DefaultQuality > 100 {
+		invalid("images.default_quality", "must between 1 - 100")
+	}
+	if len(cfg.Images.InputFormats) == 0 {
+		invalid("images.input_formats", "must not be empty")
+	}
+	for _, format := range cfg.Images.InputFormats {
+		if !slices.Contains(InputFormats, format) {
+			invalid("images.input_formats", "unknown format %q (choose among %s)", format, strings.Join(InputFormats, ","))
+		}
+	}
+	for _, format := range cfg.Images.OutputFormats {
+		if !slices.Contains(OutputFormats, format) {
+			invalid("images.output_formats", "unknown format %q (choose among %s)", format, strings.Join(OutputFormats, ","))
+		}
+	}
+	if !slices.Contains(cfg.Images.OutputFormats, "jpeg") || !slices.Contains(cfg.Images.OutputFormats, "png") {
+		invalid("images.output_formats", "jpeg and png are needed as fallback formats")
+	}
+
+	if cfg.Workers.Processing < 1 {
+		invalid("workers.processing", "must be at least 1")
+	}
+	if cfg.Workers.OpenCVThreads < 0 {
+		invalid("workers.opencv_threads", "must be 0 (OpenCV default) or more")
+	}
+
+	if !slices.Contains(TracingExporters, cfg.Tracing.Exporter) {
+		invalid("tracing.exporter", "unknown exporter %q (choose among %s)", cfg.Tracing.Exporter, strings.Join(TracingExporters, ","))
+	}
+	if cfg.Tracing.Endpoint != "" {
+		if u, err := url.Parse(cfg.Tracing.Endpoint); err != nil || u.Scheme == "" || u.Host == "" {
+			invalid("tracing.endpoint", "%q is not a URL (e.g. http://localhost:4318)", cfg.Tracing.Endpoint)
+		}
+	}
+	if cfg.Tracing.Exporter == TracingFile && cfg.Tracing.File == "" {
+		invalid("tracing.file", "must be set with the file exporter")
+	}
+
+	if cfg.Tracing.ServiceName == "" {
+		invalid("tracing.service_name", "must not be empty")
+	}
+	if cfg.Tracing.SampleRatio < 0 || cfg.Tracing.SampleRatio > 1 {
+		invalid("tracing.sample_ratio", "must between 0 - 1")
+	}
+
+	if cfg.Auth.KeysFile == "" || filepath.IsAbs(cfg.Auth.KeysFile) {
+		invalid("auth.keys_file", "must be a path relative to storage.root")
+	}
+	if cfg.Auth.AdminKey != "" && len(cfg.Auth.AdminKey) < minAdminKeyLength {
+		invalid("auth.admin_key", "must be at least %d characters long", minAdminKeyLength)
+	}
+
+	checkRateLimit := func(field string, limit RateLimit) {
+		if limit.Rate < 0 {
+			invalid(field+".rate", "must be 0 (unlimited) or more")
+		}
+		if limit.Rate > 0 && limit.Burst < 1 {
+			invalid(field+".burst", "must be at least 1 when rate is set")
+		}
+		if limit.Burst < 0 {
+			invalid(field+".burst", "must be 0 or more")
+		}
+		if limit.Concurrency < 0 {
+			invalid(field+".concurrency", "must be 0 (unlimited) or more")
+		}
+	}
+	checkRateLimit("rate_limits.default", cfg.RateLimits.Default)
+	operations := []string{}
+	for operation := range cfg.RateLimits.Routes {
+		operations = append(operations, operation)
+	}
+	sort.Strings(operations)
+	for _, operation := range operations {
+		if !slices.Contains(Operations, operation) {
+			invalid("rate_limits.routes", "unknown operation %q (choose among %s)", operation, strings.Join(Operations, ","))
+			continue
+		}
+		checkRateLimit("rate_limits.routes."+operation, cfg.RateLimits.Routes[operation])
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid configuration:\n%w", errors.Join(errs...))
+	}
+	return nil
+}
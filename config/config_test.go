@@ -0,0 +1,126 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// testConfig returns the defaults, rooted at the application directory
+func testConfig() *Config {
+	cfg := Default()
+	cfg.Server.Views = filepath.Join("..", "views", "*.html")
+	cfg.Storage.Root = ".."
+	return cfg
+}
+
+func TestDefaultIsValid(t *testing.T) {
+	assert := assert.New(t)
+	assert.Nil(testConfig().Validate(), "Error should be nil")
+}
+
+func TestLoadFileAndEnvironment(t *testing.T) {
+	assert := assert.New(t)
+	path := filepath.Join(t.TempDir(), "config.json")
+	os.WriteFile(path, []byte(`{"server": {"address": ":8080", "shutdown_timeout": "1m"}, "images": {"default_quality": 90}, "workers": {"processing": 3}, "rate_limits": {"routes": {"resize": {"rate": 1, "burst": 2, "concurrency": 1}}}}`), 0o644)
+	t.Setenv("IMAGE_CONFIG_FILE", path)
+	t.Setenv("IMAGE_VIEWS", filepath.Join("..", "views", "*.html"))
+	t.Setenv("IMAGE_STORAGE_ROOT", "..")
+	t.Setenv("IMAGE_DEFAULT_QUALITY", "70")
+	t.Setenv("IMAGE_INPUT_FORMATS", "png, JPEG")
+	t.Setenv("IMAGE_TRACING_SAMPLE_RATIO", "0.25")
+	t.Setenv("IMAGE_AUTH_ENABLED", "true")
+	t.Setenv("IMAGE_RATE_LIMIT", "5")
+	t.Setenv("IMAGE_RATE_BURST", "10")
+	cfg, err := Load()
+	if assert.Nil(err, "Error should be nil") {
+		assert.Equal(":8080", cfg.Server.Address, "Address should be read from the file")
+		assert.Equal(Duration(time.Minute), cfg.Server.ShutdownTimeout, "Durations should be parsed")
+		assert.Equal(70, cfg.Images.DefaultQuality, "Environment should override the file")
+		assert.Equal([]string{"png", "jpeg"}, cfg.Images.InputFormats, "Formats should be a trimmed lowercase list")
+		assert.Equal(3, cfg.Workers.Processing, "Workers should be read from the file")
+		assert.Equal(0.25, cfg.Tracing.SampleRatio, "Ratios should be parsed")
+		assert.True(cfg.Auth.Enabled, "Booleans should be parsed")
+		assert.Equal(RateLimit{Rate: 1, Burst: 2, Concurrency: 1}, cfg.RateLimits.Route("resize"), "Route limits should replace the default")
+		assert.Equal(RateLimit{Rate: 5, Burst: 10}, cfg.RateLimits.Route("crop"), "Other routes should have the default limits")
+		assert.Equal(int64(32<<20), cfg.Limits.MaxUploadBytes, "Unset values should keep their default")
+		assert.Equal(filepath.Join("..", "storages", "public"), cfg.Path(cfg.Storage.Public), "Path should be resolved against the root")
+	}
+}
+
+func TestLoadInvalidSources(t *testing.T) {
+	dir := t.TempDir()
+	unknown := filepath.Join(dir, "unknown.json")
+	os.WriteFile(unknown, []byte(`{"server": {"port": 8080}}`), 0o644)
+	testCases := []struct {
+		name    string
+		env     map[string]string
+		message string
+	}{
+		{"missing file", map[string]string{"IMAGE_CONFIG_FILE": filepath.Join(dir, "missing.json")}, "failed to read the configuration file"},
+		{"unknown field", map[string]string{"IMAGE_CONFIG_FILE": unknown}, "unknown field \"port\""},
+		{"invalid number", map[string]string{"IMAGE_WORKERS": "four"}, "invalid environment variable IMAGE_WORKERS"},
+		{"invalid boolean", map[string]string{"IMAGE_AUTH_ENABLED": "yes please"}, "invalid environment variable IMAGE_AUTH_ENABLED"},
+		{"invalid duration", map[string]string{"IMAGE_SHUTDOWN_TIMEOUT": "30"}, "invalid duration \"30\""},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			for name, value := range tc.env {
+				t.Setenv(name, value)
+			}
+			_, err := Load()
+			if assert.NotNil(t, err, "Error should not be nil") {
+				assert.Contains(t, err.Error(), tc.message)
+			}
+		})
+	}
+}
+
+func TestValidateReportsEveryField(t *testing.T) {
+	assert := assert.New(t)
+	cfg := testConfig()
+	cfg.Server.TLSCert = "cert.pem"
+	cfg.Server.ShutdownTimeout = 0
+	cfg.Storage.Uploads = "missing"
+	cfg.Storage.Public = "/var/public"
+	cfg.Limits.MaxPixels = 0
+	cfg.Images.DefaultQuality = 101
+	cfg.Images.InputFormats = []string{"png", "tiff"}
+	cfg.Images.OutputFormats = []string{"webp"}
+	cfg.Workers.Processing = 0
+	cfg.Tracing.Exporter = TracingFile
+	cfg.Tracing.Endpoint = "localhost:4318"
+	cfg.Tracing.SampleRatio = 2
+	cfg.Auth.KeysFile = ""
+	cfg.Auth.AdminKey = "secret"
+	cfg.RateLimits.Default.Rate = 2
+	cfg.RateLimits.Routes = map[string]RateLimit{"resize": {Concurrency: -1}, "image-crop": {Rate: 1, Burst: 1}}
+	err := cfg.Validate()
+	if assert.NotNil(err, "Error should not be nil") {
+		for _, message := range []string{
+			"server.tls_cert: tls_cert and tls_key must be set together",
+			"server.tls_cert: cert.pem does not exist",
+			"server.shutdown_timeout: must be greater than 0",
+			"storage.uploads: " + filepath.Join("..", "missing") + " does not exist",
+			"storage.public: must be a path relative to storage.root",
+			"limits.max_pixels: must be greater than 0",
+			"images.default_quality: must between 1 - 100",
+			"images.input_formats: unknown format \"tiff\"",
+			"images.output_formats: jpeg and png are needed as fallback formats",
+			"workers.processing: must be at least 1",
+			"tracing.endpoint: \"localhost:4318\" is not a URL",
+			"tracing.file: must be set with the file exporter",
+			"tracing.sample_ratio: must between 0 - 1",
+			"auth.keys_file: must be a path relative to storage.root",
+			"auth.admin_key: must be at least 16 characters long",
+			"rate_limits.default.burst: must be at least 1 when rate is set",
+			"rate_limits.routes.resize.concurrency: must be 0 (unlimited) or more",
+			"rate_limits.routes: unknown operation \"image-crop\"",
+		} {
+			assert.Contains(err.Error(), message)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package controllers
+
+import (
+	"net/http"
+	"path/filepath"
+
+	"github.com/labstack/echo/v4"
+	"github.com/vafrcor/go-http-image-manipulation/models"
+	helpers "github.com/vafrcor/go-http-image-manipulation/services"
+)
+
+// adjustOptions reads the color adjustment form options
+func adjustOptions(c echo.Context) (helpers.AdjustOptions, error) {
+	options := helpers.AdjustOptions{}
+	err := formNumbers(c, map[string]*int{
+		"clahe_tile_size": &options.ClaheTileSize,
+	}, map[string]*float64{
+		"brightness":       &options.Brightness,
+		"contrast":         &options.Contrast,
+		"gamma":            &options.Gamma,
+		"saturation":       &options.Saturation,
+		"hue":              &options.Hue,
+		"clahe_clip_limit": &options.ClaheClipLimit,
+	})
+	if err != nil {
+		return options, err
+	}
+	if options.AutoLevels, err = formBool(c, "auto_levels"); err != nil {
+		return options, err
+	}
+	options.Clahe, err = formBool(c, "clahe")
+	return options.WithDefaults(), err
+}
+
+// ImageAdjust corrects the tones and colors of the image (brightness, contrast, gamma, saturation, hue,
+// auto levels and CLAHE)
+func ImageAdjust(c echo.Context) error {
+	options, err := adjustOptions(c)
+	if err == nil {
+		err = options.Validate()
+	}
+	if err != nil {
+		return badRequest(c, err)
+	}
+	encode, err := formEncodeOptions(c)
+	if err != nil {
+		return badRequest(c, err)
+	}
+	if encode.Format != "" {
+		if err := checkEncodeOptions(encode); err != nil {
+			return badRequest(c, err)
+		}
+	}
+	data, err := ValidateImageFileUpload(c, inputFormats(), "file")
+	if err != nil {
+		return badRequest(c, err)
+	}
+	// fmt.Printf("DATA: %#v\n", data)
+	negotiateEncodeFormat(c, &encode, filepath.Join(data["upload_path"], data["filename"]))
+	im := helpers.NewImageManipulation(c.Request().Context())
+	result, err := im.Filter(data["cwd"], data["upload_path"], data["output_path"], data["filename"], options, encode, false)
+	if err != nil {
+		return respondError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, &models.Response{
+		Message: "Ok",
+		Status:  true,
+		Data:    outputURL(c, result.OutputFilePath, data["output_path"]),
+		Meta:    result,
+	})
+}
@@ -0,0 +1,207 @@
+package controllers
+
+import (
+	"net/http"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/vafrcor/go-http-image-manipulation/models"
+	helpers "github.com/vafrcor/go-http-image-manipulation/services"
+)
+
+// animationOptions reads the animation form options
+func animationOptions(c echo.Context) (helpers.AnimationOptions, error) {
+	options := helpers.AnimationOptions{
+		Operation: strings.ToLower(c.FormValue("operation")),
+		Gravity:   strings.ToLower(c.FormValue("gravity")),
+		Direction: strings.ToLower(c.FormValue("direction")),
+		Encode: helpers.EncodeOptions{
+			Format: strings.ToLower(c.FormValue("format")),
+		},
+	}
+	if !slices.Contains(helpers.AnimationOperations, options.Operation) {
+		return options, helpers.ErrInvalidAnimationOperation
+	}
+	keepAspectRatio := c.FormValue("keep_aspect_ratio")
+	if keepAspectRatio == "" {
+		keepAspectRatio = "1"
+	}
+	if !slices.Contains([]string{"0", "1"}, keepAspectRatio) {
+		return options, helpers.InvalidOption("keep_aspect_ratio", "invalid keep_aspect_ratio option value (choose either 1 or 0)")
+	}
+	options.KeepAspectRatio = keepAspectRatio == "1"
+	if options.Operation == helpers.AnimationResize || options.Operation == helpers.AnimationCrop {
+		width, errWidth := strconv.ParseFloat(c.FormValue("width"), 64)
+		height, errHeight := strconv.ParseFloat(c.FormValue("height"), 64)
+		if errWidth != nil || errHeight != nil || width <= 0 || height <= 0 {
+			return options, helpers.InvalidOption("", "invalid width or height")
+		}
+		options.Width, options.Height = width, height
+	}
+	if frame := c.FormValue("frame"); frame != "" {
+		frameInt, err := strconv.Atoi(frame)
+		if err != nil || frameInt < 0 {
+			return options, helpers.ErrInvalidFrame
+		}
+		options.Frame = frameInt
+	}
+	if quality := c.FormValue("quality"); quality != "" {
+		qualityInt, err := strconv.Atoi(quality)
+		if err != nil || qualityInt < 1 || qualityInt > 100 {
+			return options, helpers.InvalidOption("quality", "invalid quality (must between 1 - 100)")
+		}
+		options.Encode.Quality = qualityInt
+	}
+	var err error
+	if options.Encode.Lossless, err = formBool(c, "lossless"); err != nil {
+		return options, err
+	}
+	if options.Dither, err = formBool(c, "dither"); err != nil {
+		return options, err
+	}
+	return options, nil
+}
+
+// ImageAnimation processes every frame of an animated gif (resize, crop, convert) or turns it into a still
+// image (single frame or sprite strip)
+func ImageAnimation(c echo.Context) error {
+	options, err := animationOptions(c)
+	if err != nil {
+		return badRequest(c, err)
+	}
+	if options.Encode.Format != helpers.FormatAuto {
+		if err := options.WithDefaults().Validate(); err != nil {
+			return badRequest(c, err)
+		}
+	}
+	data, err := ValidateImageFileUpload(c, []string{"gif"}, "file")
+	if err != nil {
+		return badRequest(c, err)
+	}
+	// fmt.Printf("DATA: %#v\n", data)
+	if options.Encode.Format == helpers.FormatAuto {
+		c.Response().Header().Add(echo.HeaderVary, echo.HeaderAccept)
+		accept := c.Request().Header.Get(echo.HeaderAccept)
+		if options.IsStill() {
+			hasAlpha, _ := helpers.HasAlpha(filepath.Join(data["upload_path"], data["filename"]))
+			options.Encode.Format = helpers.NegotiateFormat(accept, hasAlpha || options.Encode.Lossless, false)
+		} else {
+			options.Encode.Format = helpers.NegotiateFormat(accept, false, true)
+		}
+	}
+	im := helpers.NewImageManipulation(c.Request().Context())
+	result, err := im.ProcessAnimation(data["cwd"], data["upload_path"], data["output_path"], data["filename"], options, false)
+	if err != nil {
+		return respondError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, &models.Response{
+		Message: "Ok",
+		Status:  true,
+		Data:    outputURL(c, result.OutputFilePath, data["output_path"]),
+		Meta:    result,
+	})
+}
+
+// animateOptions reads the options of an animation built from frames
+func animateOptions(c echo.Context) (helpers.AnimateOptions, error) {
+	options := helpers.AnimateOptions{
+		Palette: strings.ToLower(c.FormValue("palette")),
+		Encode: helpers.EncodeOptions{
+			Format: strings.ToLower(c.FormValue("format")),
+		},
+	}
+	keepAspectRatio := c.FormValue("keep_aspect_ratio")
+	if keepAspectRatio == "" {
+		keepAspectRatio = "1"
+	}
+	if !slices.Contains([]string{"0", "1"}, keepAspectRatio) {
+		return options, helpers.InvalidOption("keep_aspect_ratio", "invalid keep_aspect_ratio option value (choose either 1 or 0)")
+	}
+	options.KeepAspectRatio = keepAspectRatio == "1"
+	width, height := c.FormValue("width"), c.FormValue("height")
+	if (width == "") != (height == "") {
+		return options, helpers.InvalidOption("", "invalid width or height")
+	}
+	if width != "" {
+		widthFloat, errWidth := strconv.ParseFloat(width, 64)
+		heightFloat, errHeight := strconv.ParseFloat(height, 64)
+		if errWidth != nil || errHeight != nil || widthFloat <= 0 || heightFloat <= 0 {
+			return options, helpers.InvalidOption("", "invalid width or height")
+		}
+		options.Width, options.Height = widthFloat, heightFloat
+	}
+	// either a single delay or a comma separated list, one per frame
+	if delay := c.FormValue("delay"); delay != "" {
+		for _, value := range strings.Split(delay, ",") {
+			delayInt, err := strconv.Atoi(strings.TrimSpace(value))
+			if err != nil || delayInt <= 0 {
+				return options, helpers.InvalidOption("delay", "invalid delay (must between 1 - 655350 milliseconds)")
+			}
+			options.Delays = append(options.Delays, delayInt)
+		}
+	}
+	if loopCount := c.FormValue("loop_count"); loopCount != "" {
+		loopCountInt, err := strconv.Atoi(loopCount)
+		if err != nil || loopCountInt < -1 || loopCountInt > 65535 {
+			return options, helpers.InvalidOption("loop_count", "invalid loop_count (must between -1 - 65535)")
+		}
+		options.LoopCount = loopCountInt
+	}
+	if quality := c.FormValue("quality"); quality != "" {
+		qualityInt, err := strconv.Atoi(quality)
+		if err != nil || qualityInt < 1 || qualityInt > 100 {
+			return options, helpers.InvalidOption("quality", "invalid quality (must between 1 - 100)")
+		}
+		options.Encode.Quality = qualityInt
+	}
+	var err error
+	if options.Encode.Lossless, err = formBool(c, "lossless"); err != nil {
+		return options, err
+	}
+	if options.Dither, err = formBool(c, "dither"); err != nil {
+		return options, err
+	}
+	return options, nil
+}
+
+// ImageAnimate builds an animated gif (or webp) out of the ordered frame uploads
+func ImageAnimate(c echo.Context) error {
+	options, err := animateOptions(c)
+	if err != nil {
+		return badRequest(c, err)
+	}
+	form, err := c.MultipartForm()
+	if err != nil {
+		return badRequest(c, err)
+	}
+	if options.Encode.Format != helpers.FormatAuto {
+		if err := options.WithDefaults().Validate(len(form.File["frames"])); err != nil {
+			return badRequest(c, err)
+		}
+	}
+	data, filenames, err := ValidateImageFilesUpload(c, inputFormats(), "frames")
+	if err != nil {
+		return badRequest(c, err)
+	}
+	// fmt.Printf("DATA: %#v\n", data)
+	if options.Encode.Format == helpers.FormatAuto {
+		c.Response().Header().Add(echo.HeaderVary, echo.HeaderAccept)
+		options.Encode.Format = helpers.NegotiateFormat(c.Request().Header.Get(echo.HeaderAccept), false, true)
+	}
+	im := helpers.NewImageManipulation(c.Request().Context())
+	result, err := im.Animate(data["cwd"], data["upload_path"], data["output_path"], filenames, options, false)
+	if err != nil {
+		return respondError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, &models.Response{
+		Message: "Ok",
+		Status:  true,
+		Data:    outputURL(c, result.OutputFilePath, data["output_path"]),
+		Meta:    result,
+	})
+}
@@ -0,0 +1,287 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/vafrcor/go-http-image-manipulation/config"
+	"github.com/vafrcor/go-http-image-manipulation/models"
+)
+
+func TestImageAnimationResize(t *testing.T) {
+	// Setup
+	e := echo.New()
+	cwd, _ := os.Getwd()
+	rootDir := filepath.Clean(filepath.Join(cwd, ".."))
+	testFilePath := filepath.Join(rootDir, "storages", "test", "sample-animated.gif")
+	body := new(bytes.Buffer)
+	writer := multipart.NewWriter(body)
+	writer.WriteField("operation", "resize")
+	writer.WriteField("width", "48")
+	writer.WriteField("height", "48")
+	part, _ := writer.CreateFormFile("file", "sample-animated.gif")
+	testFile, _ := os.Open(testFilePath)
+	defer testFile.Close()
+	io.Copy(part, testFile)
+	writer.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/", body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	c.SetPath("/image-animation")
+
+	if assert.NoError(t, ImageAnimation(c)) {
+		assert.Equal(t, http.StatusOK, rec.Code)
+		jsonData := []byte(rec.Body.Bytes())
+		var data models.Response
+		err := json.Unmarshal(jsonData, &data)
+		if err == nil {
+			assert.True(t, data.Status)
+			meta := data.Meta.(map[string]interface{})
+			assert.Equal(t, "gif", meta["format"])
+			assert.Equal(t, float64(6), meta["frames"])
+			assert.Equal(t, float64(48), meta["width"])
+		}
+	}
+}
+
+func TestImageAnimationSprite(t *testing.T) {
+	// Setup
+	e := echo.New()
+	cwd, _ := os.Getwd()
+	rootDir := filepath.Clean(filepath.Join(cwd, ".."))
+	testFilePath := filepath.Join(rootDir, "storages", "test", "sample-animated.gif")
+	body := new(bytes.Buffer)
+	writer := multipart.NewWriter(body)
+	writer.WriteField("operation", "sprite")
+	writer.WriteField("direction", "vertical")
+	part, _ := writer.CreateFormFile("file", "sample-animated.gif")
+	testFile, _ := os.Open(testFilePath)
+	defer testFile.Close()
+	io.Copy(part, testFile)
+	writer.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/", body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	c.SetPath("/image-animation")
+
+	if assert.NoError(t, ImageAnimation(c)) {
+		assert.Equal(t, http.StatusOK, rec.Code)
+		jsonData := []byte(rec.Body.Bytes())
+		var data models.Response
+		err := json.Unmarshal(jsonData, &data)
+		if err == nil {
+			meta := data.Meta.(map[string]interface{})
+			assert.Equal(t, "png", meta["format"])
+			assert.Equal(t, float64(64*6), meta["height"])
+		}
+	}
+}
+
+func TestImageAnimationInvalidOperation(t *testing.T) {
+	// Setup
+	e := echo.New()
+	body := new(bytes.Buffer)
+	writer := multipart.NewWriter(body)
+	writer.WriteField("operation", "rotate")
+	writer.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/", body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	c.SetPath("/image-animation")
+
+	if assert.NoError(t, ImageAnimation(c)) {
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		jsonData := []byte(rec.Body.Bytes())
+		var data models.Response
+		err := json.Unmarshal(jsonData, &data)
+		if err == nil {
+			assert.True(t, data.Status == false)
+			assert.Equal(t, "invalid operation (choose either resize, crop, convert, frame or sprite)", data.Message)
+		}
+	}
+}
+
+func TestImageAnimationUnsupportedFormat(t *testing.T) {
+	// Setup
+	e := echo.New()
+	body := new(bytes.Buffer)
+	writer := multipart.NewWriter(body)
+	writer.WriteField("operation", "convert")
+	writer.WriteField("format", "jpeg")
+	writer.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/", body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	c.SetPath("/image-animation")
+
+	if assert.NoError(t, ImageAnimation(c)) {
+		assert.Equal(t, http.StatusUnsupportedMediaType, rec.Code)
+	}
+}
+
+func TestImageAnimate(t *testing.T) {
+	// Setup
+	e := echo.New()
+	cwd, _ := os.Getwd()
+	rootDir := filepath.Clean(filepath.Join(cwd, ".."))
+	testFilePath := filepath.Join(rootDir, "storages", "test", "sample-test.png")
+	body := new(bytes.Buffer)
+	writer := multipart.NewWriter(body)
+	writer.WriteField("width", "64")
+	writer.WriteField("height", "48")
+	writer.WriteField("delay", "100,200,300")
+	writer.WriteField("loop_count", "2")
+	writer.WriteField("palette", "global")
+	for i := 0; i < 3; i++ {
+		part, _ := writer.CreateFormFile("frames", "sample-test.png")
+		testFile, _ := os.Open(testFilePath)
+		io.Copy(part, testFile)
+		testFile.Close()
+	}
+	writer.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/", body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	c.SetPath("/image-animate")
+
+	if assert.NoError(t, ImageAnimate(c)) {
+		assert.Equal(t, http.StatusOK, rec.Code)
+		jsonData := []byte(rec.Body.Bytes())
+		var data models.Response
+		err := json.Unmarshal(jsonData, &data)
+		if err == nil {
+			assert.True(t, data.Status)
+			meta := data.Meta.(map[string]interface{})
+			assert.Equal(t, "gif", meta["format"])
+			assert.Equal(t, float64(3), meta["frames"])
+			assert.Equal(t, float64(2), meta["loop_count"])
+			assert.Equal(t, float64(64), meta["width"])
+			assert.Equal(t, float64(48), meta["height"])
+		}
+	}
+}
+
+func TestImageAnimateInvalidFrameCount(t *testing.T) {
+	// Setup
+	e := echo.New()
+	cwd, _ := os.Getwd()
+	rootDir := filepath.Clean(filepath.Join(cwd, ".."))
+	testFilePath := filepath.Join(rootDir, "storages", "test", "sample-test.png")
+	body := new(bytes.Buffer)
+	writer := multipart.NewWriter(body)
+	part, _ := writer.CreateFormFile("frames", "sample-test.png")
+	testFile, _ := os.Open(testFilePath)
+	defer testFile.Close()
+	io.Copy(part, testFile)
+	writer.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/", body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	c.SetPath("/image-animate")
+
+	if assert.NoError(t, ImageAnimate(c)) {
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		jsonData := []byte(rec.Body.Bytes())
+		var data models.Response
+		err := json.Unmarshal(jsonData, &data)
+		if err == nil {
+			assert.True(t, data.Status == false)
+			assert.Equal(t, "invalid number of frames (must between 2 - 100)", data.Message)
+		}
+	}
+}
+
+func TestImageAnimateInvalidDelay(t *testing.T) {
+	// Setup
+	e := echo.New()
+	body := new(bytes.Buffer)
+	writer := multipart.NewWriter(body)
+	writer.WriteField("delay", "100,fast")
+	writer.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/", body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	c.SetPath("/image-animate")
+
+	if assert.NoError(t, ImageAnimate(c)) {
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	}
+}
+
+func TestImageAnimateInvalidLoopCount(t *testing.T) {
+	// Setup
+	e := echo.New()
+	body := new(bytes.Buffer)
+	writer := multipart.NewWriter(body)
+	writer.WriteField("loop_count", "70000")
+	writer.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/", body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	c.SetPath("/image-animate")
+
+	if assert.NoError(t, ImageAnimate(c)) {
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.Contains(t, rec.Body.String(), "invalid loop_count")
+	}
+}
+
+func TestImageAnimateFrameTooLarge(t *testing.T) {
+	// Setup
+	cfg := config.Default()
+	cfg.Limits.MaxUploadBytes = 16
+	Configure(cfg)
+	defer Configure(config.Default())
+	e := echo.New()
+	cwd, _ := os.Getwd()
+	rootDir := filepath.Clean(filepath.Join(cwd, ".."))
+	testFilePath := filepath.Join(rootDir, "storages", "test", "sample-test.png")
+	body := new(bytes.Buffer)
+	writer := multipart.NewWriter(body)
+	for i := 0; i < 2; i++ {
+		part, _ := writer.CreateFormFile("frames", "sample-test.png")
+		testFile, _ := os.Open(testFilePath)
+		io.Copy(part, testFile)
+		testFile.Close()
+	}
+	writer.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/", body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	c.SetPath("/image-animate")
+
+	if assert.NoError(t, ImageAnimate(c)) {
+		assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+		var data models.Response
+		if err := json.Unmarshal(rec.Body.Bytes(), &data); err == nil {
+			assert.Equal(t, "image exceeds the maximum upload size (16 bytes)", data.Message)
+		}
+	}
+}
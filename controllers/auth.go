@@ -0,0 +1,269 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync/atomic"
+
+	"github.com/labstack/echo/v4"
+	"github.com/vafrcor/go-http-image-manipulation/models"
+	helpers "github.com/vafrcor/go-http-image-manipulation/services"
+)
+
+// the API keys are sent in the X-API-Key header, or in the api_key query parameter (redacted from the access
+// log, see LogURI). The admin key is only accepted in the header.
+const (
+	apiKeyHeader = "X-API-Key"
+	apiKeyParam  = "api_key"
+)
+
+// apiKeyContextKey stores the API key of the request in the echo context
+const apiKeyContextKey = "api_key"
+
+// keys stores the API keys (nil until UseKeys is called)
+var keys *helpers.KeyStore
+
+// UseKeys sets the store of the API keys checked by Authenticate and managed by the admin endpoints
+func UseKeys(store *helpers.KeyStore) {
+	keys = store
+}
+
+// keyUsage is the API key of a request, along with the pixels of the images it uploaded
+type keyUsage struct {
+	key    helpers.APIKey
+	pixels atomic.Int64
+}
+
+type keyUsageContextKey struct{}
+
+// requestKey returns the API key of the request context
+func requestKey(ctx context.Context) (*keyUsage, bool) {
+	usage, ok := ctx.Value(keyUsageContextKey{}).(*keyUsage)
+	return usage, ok
+}
+
+// uploadLimits returns the maximum size and dimensions of the uploads: the server limits, lowered by the ones
+// of the API key
+func uploadLimits(ctx context.Context) (int64, int64) {
+	maxBytes, maxPixels := settings.Limits.MaxUploadBytes, settings.Limits.MaxPixels
+	if usage, ok := requestKey(ctx); ok {
+		if usage.key.MaxUploadBytes > 0 && usage.key.MaxUploadBytes < maxBytes {
+			maxBytes = usage.key.MaxUploadBytes
+		}
+		if usage.key.MaxPixels > 0 && usage.key.MaxPixels < maxPixels {
+			maxPixels = usage.key.MaxPixels
+		}
+	}
+	return maxBytes, maxPixels
+}
+
+// countPixels adds the pixels of an uploaded image to the usage of the API key of the request
+func countPixels(ctx context.Context, pixels int64) {
+	if usage, ok := requestKey(ctx); ok {
+		usage.pixels.Add(pixels)
+	}
+}
+
+// operationName names the operation of the route after its path (resize for /image-resize, luts for /luts,
+// static for the conversions of /static/*)
+func operationName(c echo.Context) string {
+	return strings.TrimSuffix(strings.TrimPrefix(strings.TrimPrefix(c.Path(), "/image-"), "/"), "/*")
+}
+
+// LogURI writes the URI of the request into the access log, with the API key of the query redacted (for the
+// ${custom} tag of the echo logger)
+func LogURI(c echo.Context, buf *bytes.Buffer) (int, error) {
+	uri := c.Request().RequestURI
+	if u, err := url.ParseRequestURI(uri); err == nil && u.Query().Has(apiKeyParam) {
+		query := u.Query()
+		query.Set(apiKeyParam, "REDACTED")
+		u.RawQuery = query.Encode()
+		uri = u.RequestURI()
+	}
+	return buf.WriteString(uri)
+}
+
+// credential returns the key sent with the request
+func credential(c echo.Context) string {
+	if key := c.Request().Header.Get(apiKeyHeader); key != "" {
+		return key
+	}
+	return c.QueryParam(apiKeyParam)
+}
+
+// Authenticate requires an API key allowed to run the operation of the route, within its quotas, when the
+// authentication is enabled. The request is counted by CountRequest, the megapixels of the uploaded images once
+// the operation succeeds.
+func Authenticate(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if !settings.Auth.Enabled {
+			return next(c)
+		}
+		if keys == nil {
+			return respondError(c, echo.NewHTTPError(http.StatusServiceUnavailable, "API keys not loaded"))
+		}
+		key, err := keys.Check(credential(c), operationName(c))
+		if err != nil {
+			return respondError(c, err)
+		}
+		usage := &keyUsage{key: key}
+		c.Set(apiKeyContextKey, key)
+		c.SetRequest(c.Request().WithContext(context.WithValue(c.Request().Context(), keyUsageContextKey{}, usage)))
+
+		err = next(c)
+		if err == nil && c.Response().Status < http.StatusBadRequest {
+			if err := keys.AddMegapixels(key.ID, float64(usage.pixels.Load())/1e6); err != nil {
+				c.Logger().Error(err)
+			}
+		}
+		return err
+	}
+}
+
+// CountRequest counts the request against the quotas of its API key. It follows RateLimit, so that the rejected
+// requests are not counted.
+func CountRequest(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if usage, ok := requestKey(c.Request().Context()); ok {
+			if err := keys.CountRequest(usage.key.ID); err != nil {
+				return respondError(c, err)
+			}
+		}
+		return next(c)
+	}
+}
+
+// AdminAuth requires the admin key in the X-API-Key header, the admin endpoints are disabled when it is not
+// configured
+func AdminAuth(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if settings.Auth.AdminKey == "" {
+			return respondError(c, helpers.NewError(helpers.CodeForbidden, "", "admin endpoints disabled (no admin key configured)"))
+		}
+		if subtle.ConstantTimeCompare([]byte(c.Request().Header.Get(apiKeyHeader)), []byte(settings.Auth.AdminKey)) != 1 {
+			return respondError(c, helpers.NewError(helpers.CodeUnauthorized, apiKeyHeader, "invalid or missing admin key (X-API-Key header)"))
+		}
+		if keys == nil {
+			return respondError(c, echo.NewHTTPError(http.StatusServiceUnavailable, "API keys not loaded"))
+		}
+		return next(c)
+	}
+}
+
+// keyOperations returns the operations an API key may be restricted to: the image routes and the LUT upload
+func keyOperations(e *echo.Echo) []string {
+	r := []string{"luts"}
+	for _, endpoint := range imageEndpoints(e) {
+		r = append(r, strings.TrimPrefix(endpoint, "/image-"))
+	}
+	return r
+}
+
+// keySpec reads the access of an API key from the form: name, operations (comma separated, all of them when
+// empty), max_upload_bytes, max_pixels and the daily_* and monthly_* quotas (requests and megapixels)
+func keySpec(c echo.Context) (helpers.KeySpec, error) {
+	spec := helpers.KeySpec{Name: strings.TrimSpace(c.FormValue("name"))}
+	if spec.Name == "" {
+		return spec, helpers.InvalidOption("name", "invalid name (must not be empty)")
+	}
+	allowed := keyOperations(c.Echo())
+	for _, operation := range strings.Split(c.FormValue("operations"), ",") {
+		operation = strings.ToLower(strings.TrimSpace(operation))
+		if operation == "" {
+			continue
+		}
+		if !slices.Contains(allowed, operation) {
+			return spec, helpers.InvalidOption("operations", "invalid operation %q (choose among %s)", operation, strings.Join(allowed, ","))
+		}
+		spec.Operations = append(spec.Operations, operation)
+	}
+	var maxUploadBytes, maxPixels, dailyRequests, monthlyRequests int
+	err := formNumbers(c, map[string]*int{
+		"max_upload_bytes": &maxUploadBytes,
+		"max_pixels":       &maxPixels,
+		"daily_requests":   &dailyRequests,
+		"monthly_requests": &monthlyRequests,
+	}, map[string]*float64{
+		"daily_megapixels":   &spec.Quotas.Daily.Megapixels,
+		"monthly_megapixels": &spec.Quotas.Monthly.Megapixels,
+	})
+	spec.MaxUploadBytes, spec.MaxPixels = int64(maxUploadBytes), int64(maxPixels)
+	spec.Quotas.Daily.Requests, spec.Quotas.Monthly.Requests = int64(dailyRequests), int64(monthlyRequests)
+	if err != nil {
+		return spec, err
+	}
+	return spec, spec.Validate()
+}
+
+// ListAPIKeys returns the API keys, with their usage
+func ListAPIKeys(c echo.Context) error {
+	return c.JSON(http.StatusOK, &models.Response{
+		Message: "Ok",
+		Status:  true,
+		Data:    keys.List(),
+	})
+}
+
+// CreateAPIKey adds an API key and returns its secret, which is not stored and cannot be read afterwards
+func CreateAPIKey(c echo.Context) error {
+	spec, err := keySpec(c)
+	if err != nil {
+		return badRequest(c, err)
+	}
+	key, secret, err := keys.Create(spec)
+	if err != nil {
+		return respondError(c, err)
+	}
+	return c.JSON(http.StatusCreated, &models.Response{
+		Message: "Ok",
+		Status:  true,
+		Data:    secret,
+		Meta:    key,
+	})
+}
+
+// RotateAPIKey replaces the secret of the API key and returns the new one, the previous secret stops working
+func RotateAPIKey(c echo.Context) error {
+	key, secret, err := keys.Rotate(c.Param("id"))
+	if err != nil {
+		return respondError(c, err)
+	}
+	return c.JSON(http.StatusOK, &models.Response{
+		Message: "Ok",
+		Status:  true,
+		Data:    secret,
+		Meta:    key,
+	})
+}
+
+// RevokeAPIKey disables the API key for good
+func RevokeAPIKey(c echo.Context) error {
+	key, err := keys.Revoke(c.Param("id"))
+	if err != nil {
+		return respondError(c, err)
+	}
+	return c.JSON(http.StatusOK, &models.Response{
+		Message: "Ok",
+		Status:  true,
+		Data:    key,
+	})
+}
+
+// APIKeyUsage returns the usage of the API key in the current day and month, along with its quotas
+func APIKeyUsage(c echo.Context) error {
+	key, err := keys.Get(c.Param("id"))
+	if err != nil {
+		return respondError(c, err)
+	}
+	return c.JSON(http.StatusOK, &models.Response{
+		Message: "Ok",
+		Status:  true,
+		Data:    key.Usage,
+		Meta:    key.Quotas,
+	})
+}
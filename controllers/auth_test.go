@@ -0,0 +1,210 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/vafrcor/go-http-image-manipulation/config"
+	"github.com/vafrcor/go-http-image-manipulation/models"
+	helpers "github.com/vafrcor/go-http-image-manipulation/services"
+)
+
+// useTestKeys configures the authentication with an empty key store
+func useTestKeys(t *testing.T, adminKey string) *helpers.KeyStore {
+	cfg := config.Default()
+	cfg.Auth.Enabled = true
+	cfg.Auth.AdminKey = adminKey
+	Configure(cfg)
+	store, _ := helpers.OpenKeyStore(filepath.Join(t.TempDir(), "apikeys.json"))
+	UseKeys(store)
+	t.Cleanup(func() {
+		Configure(config.Default())
+		UseKeys(nil)
+	})
+	return store
+}
+
+func TestAuthenticate(t *testing.T) {
+	store := useTestKeys(t, "")
+	key, secret, _ := store.Create(helpers.KeySpec{
+		Name:       "mobile",
+		Operations: []string{"resize"},
+		MaxPixels:  100,
+		Quotas:     helpers.Quotas{Daily: helpers.Quota{Requests: 1}},
+	})
+	handler := Authenticate(CountRequest(func(c echo.Context) error {
+		_, maxPixels := uploadLimits(c.Request().Context())
+		countPixels(c.Request().Context(), 2_000_000)
+		return c.JSON(http.StatusOK, maxPixels)
+	}))
+
+	testCases := []struct {
+		name   string
+		path   string
+		header string
+		query  string
+		status int
+		body   string
+	}{
+		{"missing key", "/image-resize", "", "", http.StatusUnauthorized, "unauthorized"},
+		{"invalid key", "/image-resize", "imk_invalid", "", http.StatusUnauthorized, "unauthorized"},
+		{"operation not allowed", "/image-crop", secret, "", http.StatusForbidden, "forbidden"},
+		{"header", "/image-resize", secret, "", http.StatusOK, "100"},
+		{"quota exceeded", "/image-resize", "", secret, http.StatusTooManyRequests, "quota_exceeded"},
+	}
+	e := echo.New()
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/?"+url.Values{"api_key": {tc.query}}.Encode(), nil)
+			req.Header.Set(apiKeyHeader, tc.header)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.SetPath(tc.path)
+			if assert.NoError(t, handler(c)) {
+				assert.Equal(t, tc.status, rec.Code)
+				assert.Contains(t, rec.Body.String(), tc.body)
+			}
+		})
+	}
+	used, _ := store.Get(key.ID)
+	assert.Equal(t, int64(1), used.Usage.DailyRequests, "Only the accepted request should be counted")
+	assert.Equal(t, 2.0, used.Usage.DailyMegapixels, "Uploaded megapixels should be counted")
+}
+
+func TestRateLimitedRequestNotCounted(t *testing.T) {
+	assert := assert.New(t)
+	store := useTestKeys(t, "")
+	cfg := config.Default()
+	cfg.Auth.Enabled = true
+	cfg.RateLimits.Routes = map[string]config.RateLimit{"resize": {Rate: 0.01, Burst: 1}}
+	Configure(cfg)
+	key, secret, _ := store.Create(helpers.KeySpec{Name: "mobile", Quotas: helpers.Quotas{Daily: helpers.Quota{Requests: 10}}})
+	handler := Authenticate(RateLimit(CountRequest(func(c echo.Context) error {
+		return c.NoContent(http.StatusOK)
+	})))
+
+	e := echo.New()
+	for _, status := range []int{http.StatusOK, http.StatusTooManyRequests, http.StatusTooManyRequests} {
+		req := httptest.NewRequest(http.MethodPost, "/", nil)
+		req.Header.Set(apiKeyHeader, secret)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.SetPath("/image-resize")
+		assert.NoError(handler(c))
+		assert.Equal(status, rec.Code)
+	}
+	used, _ := store.Get(key.ID)
+	assert.Equal(int64(1), used.Usage.DailyRequests, "Rate limited requests should not be counted")
+}
+
+func TestUploadLimits(t *testing.T) {
+	assert := assert.New(t)
+	maxBytes, maxPixels := uploadLimits(context.Background())
+	assert.Equal(settings.Limits.MaxUploadBytes, maxBytes, "Server limit should apply without key")
+	assert.Equal(settings.Limits.MaxPixels, maxPixels, "Server limit should apply without key")
+
+	ctx := context.WithValue(context.Background(), keyUsageContextKey{}, &keyUsage{key: helpers.APIKey{
+		KeySpec: helpers.KeySpec{MaxUploadBytes: settings.Limits.MaxUploadBytes * 2, MaxPixels: 100},
+	}})
+	maxBytes, maxPixels = uploadLimits(ctx)
+	assert.Equal(settings.Limits.MaxUploadBytes, maxBytes, "Key should not raise the server limit")
+	assert.Equal(int64(100), maxPixels, "Key should lower the server limit")
+}
+
+func TestAdminKeys(t *testing.T) {
+	assert := assert.New(t)
+	adminKey := "admin-key-0123456789"
+	store := useTestKeys(t, adminKey)
+	e := echo.New()
+	e.POST("/image-resize", ImageResize)
+	request := func(method string, path string, id string, adminKey string, form url.Values, handler echo.HandlerFunc) (*httptest.ResponseRecorder, models.Response) {
+		req := httptest.NewRequest(method, "/", strings.NewReader(form.Encode()))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+		req.Header.Set(apiKeyHeader, adminKey)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.SetPath(path)
+		c.SetParamNames("id")
+		c.SetParamValues(id)
+		assert.NoError(AdminAuth(handler)(c))
+		var data models.Response
+		json.Unmarshal(rec.Body.Bytes(), &data)
+		return rec, data
+	}
+
+	rec, _ := request(http.MethodGet, "/admin/keys", "", "", nil, ListAPIKeys)
+	assert.Equal(http.StatusUnauthorized, rec.Code, "Admin key should be required")
+	rec, _ = request(http.MethodPost, "/admin/keys", "", adminKey, url.Values{"name": {"mobile"}, "operations": {"resize,tiff"}}, CreateAPIKey)
+	assert.Equal(http.StatusBadRequest, rec.Code, "Unknown operations should be rejected")
+
+	rec, data := request(http.MethodPost, "/admin/keys", "", adminKey, url.Values{
+		"name":               {"mobile"},
+		"operations":         {"resize, luts"},
+		"max_pixels":         {"1000000"},
+		"daily_requests":     {"100"},
+		"monthly_megapixels": {"500.5"},
+	}, CreateAPIKey)
+	assert.Equal(http.StatusCreated, rec.Code)
+	listed := store.List()
+	if assert.Len(listed, 1, "Key should be created") {
+		key := listed[0]
+		assert.Equal([]string{"resize", "luts"}, key.Operations)
+		assert.Equal(int64(1000000), key.MaxPixels)
+		assert.Equal(helpers.Quotas{Daily: helpers.Quota{Requests: 100}, Monthly: helpers.Quota{Megapixels: 500.5}}, key.Quotas)
+		_, err := store.Check(data.Data.(string), "resize")
+		assert.Nil(err, "Returned secret should authenticate the key")
+		store.CountRequest(key.ID)
+
+		rec, data = request(http.MethodPost, "/admin/keys/:id/rotate", key.ID, adminKey, nil, RotateAPIKey)
+		assert.Equal(http.StatusOK, rec.Code)
+		_, err = store.Check(data.Data.(string), "resize")
+		assert.Nil(err, "Rotated secret should authenticate the key")
+		store.CountRequest(key.ID)
+
+		rec, data = request(http.MethodGet, "/admin/keys/:id/usage", key.ID, adminKey, nil, APIKeyUsage)
+		assert.Equal(http.StatusOK, rec.Code)
+		assert.Equal(float64(2), data.Data.(map[string]interface{})["daily_requests"], "Usage should count the requests")
+
+		rec, _ = request(http.MethodDelete, "/admin/keys/:id", key.ID, adminKey, nil, RevokeAPIKey)
+		assert.Equal(http.StatusOK, rec.Code)
+		rec, _ = request(http.MethodPost, "/admin/keys/:id/rotate", key.ID, adminKey, nil, RotateAPIKey)
+		assert.Equal(http.StatusConflict, rec.Code, "Revoked keys should not be rotated")
+	}
+	rec, _ = request(http.MethodGet, "/admin/keys/:id/usage", "key_unknown", adminKey, nil, APIKeyUsage)
+	assert.Equal(http.StatusNotFound, rec.Code)
+
+	// the admin key is not accepted in the query, which is logged
+	req := httptest.NewRequest(http.MethodGet, "/admin/keys?"+apiKeyParam+"="+adminKey, nil)
+	rec = httptest.NewRecorder()
+	assert.NoError(AdminAuth(ListAPIKeys)(e.NewContext(req, rec)))
+	assert.Equal(http.StatusUnauthorized, rec.Code, "Admin key should only be read from the header")
+
+	Configure(config.Default())
+	rec, _ = request(http.MethodGet, "/admin/keys", "", adminKey, nil, ListAPIKeys)
+	assert.Equal(http.StatusForbidden, rec.Code, "Admin endpoints should be disabled without admin key")
+}
+
+func TestLogURI(t *testing.T) {
+	assert := assert.New(t)
+	e := echo.New()
+	testCases := map[string]string{
+		"/image-resize?api_key=imk_secret&width=10": "/image-resize?api_key=REDACTED&width=10",
+		"/image-resize?width=10":                    "/image-resize?width=10",
+		"/image-resize":                             "/image-resize",
+	}
+	for uri, expected := range testCases {
+		buf := new(bytes.Buffer)
+		LogURI(e.NewContext(httptest.NewRequest(http.MethodGet, uri, nil), httptest.NewRecorder()), buf)
+		assert.Equal(expected, buf.String(), fmt.Sprintf("URI %s should be logged without the API key", uri))
+	}
+}
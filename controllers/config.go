@@ -0,0 +1,52 @@
+package controllers
+
+import (
+	"net/http"
+	"sync/atomic"
+
+	"github.com/labstack/echo/v4"
+	"github.com/vafrcor/go-http-image-manipulation/config"
+)
+
+// settings is the configuration of the handlers (the built-in defaults until Configure is called)
+var settings = config.Default()
+
+// workers bounds the number of image operations running at once
+var workers = make(chan struct{}, settings.Workers.Processing)
+
+// the image operations waiting for a free worker and running
+var queuedOperations, runningOperations atomic.Int64
+
+// Configure applies the configuration to the handlers. It must be called before serving requests.
+func Configure(cfg *config.Config) {
+	settings = cfg
+	workers = make(chan struct{}, cfg.Workers.Processing)
+	limiters = newClientLimits()
+}
+
+// inputFormats returns the image formats accepted by the image endpoints
+func inputFormats() []string {
+	return settings.Images.InputFormats
+}
+
+// Worker runs the image operations of the routes on the worker pool: the requests wait for a free worker, and
+// give up when they are canceled meanwhile
+func Worker(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		pool := workers
+		queuedOperations.Add(1)
+		select {
+		case pool <- struct{}{}:
+			queuedOperations.Add(-1)
+		case <-c.Request().Context().Done():
+			queuedOperations.Add(-1)
+			return respondError(c, echo.NewHTTPError(http.StatusServiceUnavailable, "request canceled while waiting for a worker"))
+		}
+		runningOperations.Add(1)
+		defer func() {
+			runningOperations.Add(-1)
+			<-pool
+		}()
+		return next(c)
+	}
+}
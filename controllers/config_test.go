@@ -0,0 +1,99 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/png"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/vafrcor/go-http-image-manipulation/config"
+)
+
+func TestWorkerLimitsConcurrency(t *testing.T) {
+	assert := assert.New(t)
+	cfg := config.Default()
+	cfg.Workers.Processing = 2
+	Configure(cfg)
+	defer Configure(config.Default())
+
+	e := echo.New()
+	var running, peak atomic.Int32
+	handler := Worker(func(c echo.Context) error {
+		n := running.Add(1)
+		for p := peak.Load(); n > p && !peak.CompareAndSwap(p, n); p = peak.Load() {
+		}
+		time.Sleep(20 * time.Millisecond)
+		running.Add(-1)
+		return c.NoContent(http.StatusOK)
+	})
+	wg := sync.WaitGroup{}
+	for i := 0; i < 6; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rec := httptest.NewRecorder()
+			handler(e.NewContext(httptest.NewRequest(http.MethodPost, "/", nil), rec))
+			assert.Equal(http.StatusOK, rec.Code)
+		}()
+	}
+	wg.Wait()
+	assert.Equal(int32(2), peak.Load(), "At most 2 operations should run at once")
+
+	// a canceled request gives up waiting for a worker
+	workers <- struct{}{}
+	workers <- struct{}{}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	rec := httptest.NewRecorder()
+	handler(e.NewContext(httptest.NewRequest(http.MethodPost, "/", nil).WithContext(ctx), rec))
+	assert.Equal(http.StatusServiceUnavailable, rec.Code)
+}
+
+func TestSaveImageUploadLimits(t *testing.T) {
+	cwd, _ := os.Getwd()
+	testFilePath := filepath.Join(filepath.Clean(filepath.Join(cwd, "..")), "storages", "test", "sample-test.png")
+	testFile, _ := os.Open(testFilePath)
+	defer testFile.Close()
+	imageData, _, _ := image.Decode(testFile)
+	body := new(bytes.Buffer)
+	writer := multipart.NewWriter(body)
+	part, _ := writer.CreateFormFile("file", "sample-test.png")
+	png.Encode(part, imageData)
+	writer.Close()
+	req := httptest.NewRequest(http.MethodPost, "/", body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	req.ParseMultipartForm(32 << 20)
+	file := req.MultipartForm.File["file"][0]
+
+	testCases := []struct {
+		name    string
+		limits  config.Limits
+		message string
+	}{
+		{"upload size", config.Limits{MaxUploadBytes: 16, MaxPixels: 100_000_000}, "image exceeds the maximum upload size (16 bytes)"},
+		{"dimensions", config.Limits{MaxUploadBytes: 32 << 20, MaxPixels: 100}, "image exceeds the maximum dimensions (100 pixels)"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := config.Default()
+			cfg.Limits = tc.limits
+			Configure(cfg)
+			defer Configure(config.Default())
+			err := saveImageUpload(context.Background(), file, "file", filepath.Join(t.TempDir(), file.Filename), inputFormats())
+			if assert.NotNil(t, err, "Error should not be nil") {
+				assert.Equal(t, tc.message, err.Error())
+			}
+		})
+	}
+}
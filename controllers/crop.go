@@ -0,0 +1,66 @@
+package controllers
+
+import (
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/vafrcor/go-http-image-manipulation/models"
+	helpers "github.com/vafrcor/go-http-image-manipulation/services"
+)
+
+// ImageCrop cuts a window out of the image, placed by gravity (gravity=smart picks the most interesting
+// region, gravity=face centers it on the faces). With debug=1, smart crops also return the interest heatmap.
+func ImageCrop(c echo.Context) error {
+	width, errWidth := strconv.Atoi(c.FormValue("width"))
+	height, errHeight := strconv.Atoi(c.FormValue("height"))
+	if errWidth != nil || errHeight != nil {
+		return badRequest(c, helpers.InvalidOption("", "invalid width or height"))
+	}
+	crop := helpers.CropOptions{
+		Width:    width,
+		Height:   height,
+		Gravity:  strings.ToLower(c.FormValue("gravity")),
+		Fallback: strings.ToLower(c.FormValue("fallback")),
+	}.WithDefaults()
+	if err := crop.Validate(); err != nil {
+		return badRequest(c, err)
+	}
+	debug, err := formBool(c, "debug")
+	if err != nil {
+		return badRequest(c, err)
+	}
+	encode, err := formEncodeOptions(c)
+	if err != nil {
+		return badRequest(c, err)
+	}
+	if encode.Format == "" {
+		encode.Format = helpers.FormatJpeg
+	}
+	if err := checkEncodeOptions(encode); err != nil {
+		return badRequest(c, err)
+	}
+	data, err := ValidateImageFileUpload(c, inputFormats(), "file")
+	if err != nil {
+		return badRequest(c, err)
+	}
+	// fmt.Printf("DATA: %#v\n", data)
+	negotiateEncodeFormat(c, &encode, filepath.Join(data["upload_path"], data["filename"]))
+	im := helpers.NewImageManipulation(c.Request().Context())
+	result, err := im.Crop(data["cwd"], data["upload_path"], data["output_path"], data["filename"], crop, encode, debug)
+	if err != nil {
+		return respondError(c, err)
+	}
+	if result.HeatmapFilePath != "" {
+		result.Heatmap = staticURL(c, result.HeatmapFilePath, data["output_path"])
+	}
+
+	return c.JSON(http.StatusOK, &models.Response{
+		Message: "Ok",
+		Status:  true,
+		Data:    outputURL(c, result.OutputFilePath, data["output_path"]),
+		Meta:    result,
+	})
+}
@@ -0,0 +1,84 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/vafrcor/go-http-image-manipulation/models"
+)
+
+func TestImageCropSmart(t *testing.T) {
+	// Setup
+	e := echo.New()
+	cwd, _ := os.Getwd()
+	rootDir := filepath.Clean(filepath.Join(cwd, ".."))
+	testFilePath := filepath.Join(rootDir, "storages", "test", "sample-test.png")
+	body := new(bytes.Buffer)
+	writer := multipart.NewWriter(body)
+	writer.WriteField("width", "300")
+	writer.WriteField("height", "300")
+	writer.WriteField("gravity", "smart")
+	writer.WriteField("debug", "1")
+	part, _ := writer.CreateFormFile("file", "sample-test.png")
+	testFile, _ := os.Open(testFilePath)
+	defer testFile.Close()
+	io.Copy(part, testFile)
+	writer.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/", body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	c.SetPath("/image-crop")
+
+	if assert.NoError(t, ImageCrop(c)) {
+		assert.Equal(t, http.StatusOK, rec.Code)
+		jsonData := []byte(rec.Body.Bytes())
+		var data models.Response
+		err := json.Unmarshal(jsonData, &data)
+		if err == nil {
+			assert.True(t, data.Status)
+			meta := data.Meta.(map[string]interface{})
+			assert.Equal(t, "smart", meta["gravity"])
+			assert.Equal(t, float64(300), meta["width"])
+			assert.Contains(t, meta["heatmap"], "-heatmap.png")
+		}
+	}
+}
+
+func TestImageCropInvalidGravity(t *testing.T) {
+	// Setup
+	e := echo.New()
+	body := new(bytes.Buffer)
+	writer := multipart.NewWriter(body)
+	writer.WriteField("width", "300")
+	writer.WriteField("height", "300")
+	writer.WriteField("gravity", "middle")
+	writer.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/", body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	c.SetPath("/image-crop")
+
+	if assert.NoError(t, ImageCrop(c)) {
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		jsonData := []byte(rec.Body.Bytes())
+		var data models.Response
+		err := json.Unmarshal(jsonData, &data)
+		if err == nil {
+			assert.True(t, data.Status == false)
+			assert.Equal(t, "invalid gravity", data.Message)
+		}
+	}
+}
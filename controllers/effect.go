@@ -0,0 +1,61 @@
+package controllers
+
+import (
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/vafrcor/go-http-image-manipulation/models"
+	helpers "github.com/vafrcor/go-http-image-manipulation/services"
+)
+
+// effectOptions reads the color effect form options
+func effectOptions(c echo.Context) (helpers.EffectOptions, error) {
+	options := helpers.EffectOptions{
+		Effect:    strings.ToLower(c.FormValue("effect")),
+		Shadow:    c.FormValue("shadow"),
+		Highlight: c.FormValue("highlight"),
+		Lut:       c.FormValue("lut"),
+	}
+	err := formNumbers(c, nil, map[string]*float64{"intensity": &options.Intensity})
+	return options.WithDefaults(), err
+}
+
+// ImageEffect applies a grayscale, sepia, duotone, invert or LUT (lut, the name of an uploaded LUT) effect
+func ImageEffect(c echo.Context) error {
+	options, err := effectOptions(c)
+	if err == nil {
+		err = options.Validate()
+	}
+	if err != nil {
+		return badRequest(c, err)
+	}
+	encode, err := formEncodeOptions(c)
+	if err != nil {
+		return badRequest(c, err)
+	}
+	if encode.Format != "" {
+		if err := checkEncodeOptions(encode); err != nil {
+			return badRequest(c, err)
+		}
+	}
+	data, err := ValidateImageFileUpload(c, inputFormats(), "file")
+	if err != nil {
+		return badRequest(c, err)
+	}
+	// fmt.Printf("DATA: %#v\n", data)
+	negotiateEncodeFormat(c, &encode, filepath.Join(data["upload_path"], data["filename"]))
+	im := helpers.NewImageManipulation(c.Request().Context())
+	result, err := im.Filter(data["cwd"], data["upload_path"], data["output_path"], data["filename"], options, encode, false)
+	if err != nil {
+		return respondError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, &models.Response{
+		Message: "Ok",
+		Status:  true,
+		Data:    outputURL(c, result.OutputFilePath, data["output_path"]),
+		Meta:    result,
+	})
+}
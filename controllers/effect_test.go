@@ -0,0 +1,51 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/vafrcor/go-http-image-manipulation/models"
+)
+
+func TestImageEffectInvalid(t *testing.T) {
+	cases := map[string]map[string]string{
+		"invalid effect":                  {"effect": "vintage"},
+		"set both shadow and highlight":   {"effect": "duotone", "shadow": "#000000"},
+		"invalid lut name":                {"effect": "lut", "lut": "../warm"},
+		"invalid intensity":               {"effect": "sepia", "intensity": "1.5"},
+		"only used by the duotone effect": {"effect": "sepia", "highlight": "#ffffff"},
+	}
+	for message, fields := range cases {
+		// Setup
+		e := echo.New()
+		body := new(bytes.Buffer)
+		writer := multipart.NewWriter(body)
+		for name, value := range fields {
+			writer.WriteField(name, value)
+		}
+		writer.Close()
+
+		req := httptest.NewRequest(http.MethodPost, "/", body)
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.SetPath("/image-effect")
+
+		if assert.NoError(t, ImageEffect(c)) {
+			assert.Equal(t, http.StatusBadRequest, rec.Code)
+			jsonData := []byte(rec.Body.Bytes())
+			var data models.Response
+			err := json.Unmarshal(jsonData, &data)
+			if err == nil {
+				assert.True(t, data.Status == false)
+				assert.Contains(t, data.Message, message)
+			}
+		}
+	}
+}
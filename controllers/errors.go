@@ -0,0 +1,126 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/vafrcor/go-http-image-manipulation/models"
+	helpers "github.com/vafrcor/go-http-image-manipulation/services"
+)
+
+// errorStatuses maps the error codes to the HTTP status codes. The unsupported upload formats keep the 400 of
+// the first releases, only the output formats without encoder are answered with 415 (see describeError).
+var errorStatuses = map[helpers.Code]int{
+	helpers.CodeInvalidOption:      http.StatusBadRequest,
+	helpers.CodeMissingFile:        http.StatusBadRequest,
+	helpers.CodeDecodeFailed:       http.StatusBadRequest,
+	helpers.CodeUnsupportedFormat:  http.StatusBadRequest,
+	helpers.CodeUploadTooLarge:     http.StatusRequestEntityTooLarge,
+	helpers.CodeDimensionsTooLarge: http.StatusRequestEntityTooLarge,
+	helpers.CodeNotFound:           http.StatusNotFound,
+	helpers.CodeConflict:           http.StatusConflict,
+	helpers.CodeUnreachableTarget:  http.StatusUnprocessableEntity,
+	helpers.CodeUnauthorized:       http.StatusUnauthorized,
+	helpers.CodeForbidden:          http.StatusForbidden,
+	helpers.CodeQuotaExceeded:      http.StatusTooManyRequests,
+	helpers.CodeInternal:           http.StatusInternalServerError,
+}
+
+// httpErrorCodes name the HTTP errors of echo and of the middlewares (the others are named after their status
+// text, e.g. method_not_allowed)
+var httpErrorCodes = map[int]helpers.Code{
+	http.StatusBadRequest:            helpers.CodeInvalidOption,
+	http.StatusNotFound:              helpers.CodeNotFound,
+	http.StatusRequestEntityTooLarge: helpers.CodeUploadTooLarge,
+	http.StatusUnsupportedMediaType:  helpers.CodeUnsupportedFormat,
+	http.StatusTooManyRequests:       "rate_limited",
+	http.StatusServiceUnavailable:    "unavailable",
+	http.StatusInternalServerError:   helpers.CodeInternal,
+}
+
+// describeError returns the status code and the typed error answering the error. The errors not caused by the
+// request are internal errors, their message is not disclosed.
+func describeError(err error) (int, *helpers.Error) {
+	he := &echo.HTTPError{}
+	if errors.As(err, &he) {
+		code, ok := httpErrorCodes[he.Code]
+		if !ok {
+			code = helpers.Code(strings.ReplaceAll(strings.ToLower(http.StatusText(he.Code)), " ", "_"))
+		}
+		return he.Code, helpers.NewError(code, "", fmt.Sprint(he.Message))
+	}
+	if e := helpers.ErrorOf(err); e != nil {
+		status, ok := errorStatuses[e.Code]
+		if !ok {
+			status = http.StatusBadRequest
+		}
+		if errors.Is(err, helpers.ErrUnsupportedOutputFormat) {
+			status = http.StatusUnsupportedMediaType
+		}
+		// the message of the wrapping errors gives more context
+		return status, helpers.NewError(e.Code, e.Field, err.Error())
+	}
+	return http.StatusInternalServerError, helpers.NewError(helpers.CodeInternal, "", "internal server error")
+}
+
+// errorStatus returns the status code answering the error
+func errorStatus(err error) int {
+	status, _ := describeError(err)
+	return status
+}
+
+// requestID returns the ID of the request, set by the RequestID middleware (or the client)
+func requestID(c echo.Context) string {
+	if id := c.Response().Header().Get(echo.HeaderXRequestID); id != "" {
+		return id
+	}
+	return c.Request().Header.Get(echo.HeaderXRequestID)
+}
+
+// respondError answers the failed request with the code, the message and the field of the error and the
+// request ID
+func respondError(c echo.Context, err error) error {
+	status, e := describeError(err)
+	if e.Code == helpers.CodeInternal {
+		c.Logger().Errorf("request %s: %s", requestID(c), err.Error())
+	}
+	body := &models.Error{
+		Code:      string(e.Code),
+		RequestID: requestID(c),
+	}
+	if e.Field != "" {
+		body.Details = []models.FieldError{{Field: e.Field, Message: e.Message}}
+	}
+	return c.JSON(status, &models.Response{
+		Message: e.Message,
+		Status:  false,
+		Error:   body,
+	})
+}
+
+// badRequest answers the rejected request: the typed errors keep their code, the others are invalid options
+func badRequest(c echo.Context, err error) error {
+	if helpers.ErrorOf(err) == nil {
+		err = helpers.NewError(helpers.CodeInvalidOption, "", err.Error())
+	}
+	return respondError(c, err)
+}
+
+// ErrorHandler is the HTTP error handler of the server: the errors returned by the handlers and the middlewares
+// are answered like the ones of the handlers
+func ErrorHandler(err error, c echo.Context) {
+	if c.Response().Committed {
+		return
+	}
+	if c.Request().Method == http.MethodHead {
+		err = c.NoContent(errorStatus(err))
+	} else {
+		err = respondError(c, err)
+	}
+	if err != nil {
+		c.Logger().Error(err)
+	}
+}
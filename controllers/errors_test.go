@@ -0,0 +1,68 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/vafrcor/go-http-image-manipulation/models"
+	helpers "github.com/vafrcor/go-http-image-manipulation/services"
+)
+
+func TestErrorHandler(t *testing.T) {
+	testCases := []struct {
+		name    string
+		err     error
+		status  int
+		code    string
+		message string
+		details []models.FieldError
+	}{
+		{"invalid option", helpers.InvalidOption("quality", "invalid quality (must between 1 - 100)"), http.StatusBadRequest, "invalid_option", "invalid quality (must between 1 - 100)", []models.FieldError{{Field: "quality", Message: "invalid quality (must between 1 - 100)"}}},
+		{"wrapped", fmt.Errorf("%w: tiff", helpers.ErrUnsupportedOutputFormat), http.StatusUnsupportedMediaType, "unsupported_format", "unsupported output format: tiff", []models.FieldError{{Field: "format", Message: "unsupported output format: tiff"}}},
+		{"upload format", helpers.NewError(helpers.CodeUnsupportedFormat, "file", "only accept image using specific format (png,jpeg)"), http.StatusBadRequest, "unsupported_format", "only accept image using specific format (png,jpeg)", []models.FieldError{{Field: "file", Message: "only accept image using specific format (png,jpeg)"}}},
+		{"dimensions", helpers.NewError(helpers.CodeDimensionsTooLarge, "file", "image exceeds the maximum dimensions (100 pixels)"), http.StatusRequestEntityTooLarge, "dimensions_too_large", "image exceeds the maximum dimensions (100 pixels)", []models.FieldError{{Field: "file", Message: "image exceeds the maximum dimensions (100 pixels)"}}},
+		{"not found", helpers.ErrPresetNotFound, http.StatusNotFound, "not_found", "preset not found", []models.FieldError{{Field: "preset", Message: "preset not found"}}},
+		{"http error", echo.ErrMethodNotAllowed, http.StatusMethodNotAllowed, "method_not_allowed", "Method Not Allowed", nil},
+		{"internal", errors.New("open /var/storages/public: permission denied"), http.StatusInternalServerError, "internal_error", "internal server error", nil},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			e := echo.New()
+			req := httptest.NewRequest(http.MethodPost, "/", nil)
+			req.Header.Set(echo.HeaderXRequestID, "request-1")
+			rec := httptest.NewRecorder()
+			ErrorHandler(tc.err, e.NewContext(req, rec))
+			assert.Equal(t, tc.status, rec.Code)
+			var data models.Response
+			if assert.Nil(t, json.Unmarshal(rec.Body.Bytes(), &data), "Error should be nil") && assert.NotNil(t, data.Error, "Error should be described") {
+				assert.False(t, data.Status)
+				assert.Equal(t, tc.message, data.Message)
+				assert.Equal(t, tc.code, data.Error.Code)
+				assert.Equal(t, "request-1", data.Error.RequestID)
+				assert.Equal(t, tc.details, data.Error.Details)
+			}
+		})
+	}
+}
+
+func TestBadRequest(t *testing.T) {
+	assert := assert.New(t)
+	e := echo.New()
+	rec := httptest.NewRecorder()
+	c := e.NewContext(httptest.NewRequest(http.MethodPost, "/", nil), rec)
+	c.Response().Header().Set(echo.HeaderXRequestID, "request-2")
+	assert.Nil(badRequest(c, errors.New("invalid steps")), "Error should be nil")
+	assert.Equal(http.StatusBadRequest, rec.Code)
+	var data models.Response
+	json.Unmarshal(rec.Body.Bytes(), &data)
+	if assert.NotNil(data.Error, "Error should be described") {
+		assert.Equal("invalid_option", data.Error.Code, "Untyped errors should be invalid options")
+		assert.Equal("request-2", data.Error.RequestID, "Request ID should be the one of the middleware")
+	}
+}
@@ -0,0 +1,39 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/vafrcor/go-http-image-manipulation/models"
+	helpers "github.com/vafrcor/go-http-image-manipulation/services"
+)
+
+// ImageFaces returns the bounding boxes of the faces found in the image (meta). With debug=1, it also returns the
+// URL of the image annotated with the boxes (data).
+func ImageFaces(c echo.Context) error {
+	debug, err := formBool(c, "debug")
+	if err != nil {
+		return badRequest(c, err)
+	}
+	data, err := ValidateImageFileUpload(c, inputFormats(), "file")
+	if err != nil {
+		return badRequest(c, err)
+	}
+	// fmt.Printf("DATA: %#v\n", data)
+	im := helpers.NewImageManipulation(c.Request().Context())
+	result, err := im.Faces(data["cwd"], data["upload_path"], data["output_path"], data["filename"], debug)
+	if err != nil {
+		return respondError(c, err)
+	}
+	var annotated interface{}
+	if result.OutputFilePath != "" {
+		annotated = outputURL(c, result.OutputFilePath, data["output_path"])
+	}
+
+	return c.JSON(http.StatusOK, &models.Response{
+		Message: "Ok",
+		Status:  true,
+		Data:    annotated,
+		Meta:    result,
+	})
+}
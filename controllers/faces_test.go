@@ -0,0 +1,52 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/vafrcor/go-http-image-manipulation/models"
+)
+
+func TestImageFaces(t *testing.T) {
+	// Setup
+	e := echo.New()
+	cwd, _ := os.Getwd()
+	rootDir := filepath.Clean(filepath.Join(cwd, ".."))
+	testFilePath := filepath.Join(rootDir, "storages", "test", "sample-test.png")
+	body := new(bytes.Buffer)
+	writer := multipart.NewWriter(body)
+	writer.WriteField("debug", "1")
+	part, _ := writer.CreateFormFile("file", "sample-test.png")
+	testFile, _ := os.Open(testFilePath)
+	defer testFile.Close()
+	io.Copy(part, testFile)
+	writer.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/", body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	c.SetPath("/image-faces")
+
+	if assert.NoError(t, ImageFaces(c)) {
+		assert.Equal(t, http.StatusOK, rec.Code)
+		jsonData := []byte(rec.Body.Bytes())
+		var data models.Response
+		err := json.Unmarshal(jsonData, &data)
+		if err == nil {
+			assert.True(t, data.Status)
+			result := data.Meta.(map[string]interface{})
+			assert.NotNil(t, result["faces"])
+			assert.Contains(t, data.Data, ".png")
+		}
+	}
+}
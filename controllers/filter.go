@@ -0,0 +1,84 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/vafrcor/go-http-image-manipulation/models"
+	helpers "github.com/vafrcor/go-http-image-manipulation/services"
+)
+
+// filterOptions reads the options of the requested filter (blur, sharpen or redact)
+func filterOptions(c echo.Context) (helpers.Filter, error) {
+	switch strings.ToLower(c.FormValue("filter")) {
+	case helpers.FilterBlur:
+		options := helpers.BlurOptions{}
+		err := formNumbers(c, nil, map[string]*float64{"radius": &options.Radius})
+		return options.WithDefaults(), err
+	case helpers.FilterSharpen:
+		options := helpers.SharpenOptions{}
+		err := formNumbers(c, nil, map[string]*float64{
+			"amount":    &options.Amount,
+			"radius":    &options.Radius,
+			"threshold": &options.Threshold,
+		})
+		return options.WithDefaults(), err
+	case helpers.FilterRedact:
+		options := helpers.RedactOptions{
+			Mode: strings.ToLower(c.FormValue("mode")),
+		}
+		if regions := c.FormValue("regions"); regions != "" {
+			if err := json.Unmarshal([]byte(regions), &options.Regions); err != nil {
+				return options, helpers.InvalidOption("regions", "invalid regions (must be a JSON array of {\"x\": ..., \"y\": ..., \"width\": ..., \"height\": ...} objects)")
+			}
+		}
+		err := formNumbers(c, map[string]*int{"block_size": &options.BlockSize}, map[string]*float64{"radius": &options.Radius})
+		if err != nil {
+			return options, err
+		}
+		options.Faces, err = formBool(c, "faces")
+		return options.WithDefaults(), err
+	}
+	return nil, helpers.ErrInvalidFilter
+}
+
+// ImageFilter applies a blur, sharpen (unsharp mask) or redact (pixelate or blur regions) filter on the image
+func ImageFilter(c echo.Context) error {
+	filter, err := filterOptions(c)
+	if err == nil {
+		err = filter.Validate()
+	}
+	if err != nil {
+		return badRequest(c, err)
+	}
+	encode, err := formEncodeOptions(c)
+	if err != nil {
+		return badRequest(c, err)
+	}
+	if encode.Format != "" {
+		if err := checkEncodeOptions(encode); err != nil {
+			return badRequest(c, err)
+		}
+	}
+	data, err := ValidateImageFileUpload(c, inputFormats(), "file")
+	if err != nil {
+		return badRequest(c, err)
+	}
+	// fmt.Printf("DATA: %#v\n", data)
+	negotiateEncodeFormat(c, &encode, filepath.Join(data["upload_path"], data["filename"]))
+	im := helpers.NewImageManipulation(c.Request().Context())
+	result, err := im.Filter(data["cwd"], data["upload_path"], data["output_path"], data["filename"], filter, encode, false)
+	if err != nil {
+		return respondError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, &models.Response{
+		Message: "Ok",
+		Status:  true,
+		Data:    outputURL(c, result.OutputFilePath, data["output_path"]),
+		Meta:    result,
+	})
+}
@@ -0,0 +1,90 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/vafrcor/go-http-image-manipulation/models"
+)
+
+func TestImageFilterRedact(t *testing.T) {
+	// Setup
+	e := echo.New()
+	cwd, _ := os.Getwd()
+	rootDir := filepath.Clean(filepath.Join(cwd, ".."))
+	testFilePath := filepath.Join(rootDir, "storages", "test", "sample-test.png")
+	body := new(bytes.Buffer)
+	writer := multipart.NewWriter(body)
+	writer.WriteField("filter", "redact")
+	writer.WriteField("regions", `[{"x": 20, "y": 20, "width": 160, "height": 60}]`)
+	writer.WriteField("block_size", "12")
+	writer.WriteField("format", "jpeg")
+	part, _ := writer.CreateFormFile("file", "sample-test.png")
+	testFile, _ := os.Open(testFilePath)
+	defer testFile.Close()
+	io.Copy(part, testFile)
+	writer.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/", body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	c.SetPath("/image-filter")
+
+	if assert.NoError(t, ImageFilter(c)) {
+		assert.Equal(t, http.StatusOK, rec.Code)
+		jsonData := []byte(rec.Body.Bytes())
+		var data models.Response
+		err := json.Unmarshal(jsonData, &data)
+		if err == nil {
+			assert.True(t, data.Status)
+			meta := data.Meta.(map[string]interface{})
+			assert.Equal(t, "jpeg", meta["format"])
+		}
+	}
+}
+
+func TestImageFilterInvalid(t *testing.T) {
+	cases := map[string]map[string]string{
+		"invalid filter":    {"filter": "emboss"},
+		"invalid radius":    {"filter": "blur", "radius": "-2"},
+		"invalid regions":   {"filter": "redact", "regions": "20,20,160,60"},
+		"set either region": {"filter": "redact"},
+	}
+	for message, fields := range cases {
+		// Setup
+		e := echo.New()
+		body := new(bytes.Buffer)
+		writer := multipart.NewWriter(body)
+		for name, value := range fields {
+			writer.WriteField(name, value)
+		}
+		writer.Close()
+
+		req := httptest.NewRequest(http.MethodPost, "/", body)
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.SetPath("/image-filter")
+
+		if assert.NoError(t, ImageFilter(c)) {
+			assert.Equal(t, http.StatusBadRequest, rec.Code)
+			jsonData := []byte(rec.Body.Bytes())
+			var data models.Response
+			err := json.Unmarshal(jsonData, &data)
+			if err == nil {
+				assert.True(t, data.Status == false)
+				assert.Contains(t, data.Message, message)
+			}
+		}
+	}
+}
@@ -0,0 +1,183 @@
+package controllers
+
+import (
+	"net/http"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/vafrcor/go-http-image-manipulation/models"
+	helpers "github.com/vafrcor/go-http-image-manipulation/services"
+)
+
+// Healthz tells the process is alive
+func Healthz(c echo.Context) error {
+	return c.JSON(http.StatusOK, &models.Response{
+		Message: "Ok",
+		Status:  true,
+	})
+}
+
+// Readyz tells the service can process images: the storage directories are writable and OpenCV is usable.
+// The result of every check is reported, the status is 503 when one fails.
+func Readyz(c echo.Context) error {
+	checks := map[string]func() error{
+		"opencv": helpers.CheckOpenCV,
+	}
+	for name, path := range map[string]string{
+		"storage.uploads": settings.Storage.Uploads,
+		"storage.public":  settings.Storage.Public,
+		"storage.luts":    settings.Storage.Luts,
+	} {
+		dir := filepath.Join(rootPath(), path)
+		checks[name] = func() error {
+			return helpers.CheckWritable(dir)
+		}
+	}
+	results := map[string]string{}
+	ready := true
+	for name, check := range checks {
+		results[name] = "ok"
+		if err := check(); err != nil {
+			results[name] = err.Error()
+			ready = false
+		}
+	}
+	if !ready {
+		return c.JSON(http.StatusServiceUnavailable, &models.Response{
+			Message: "not ready",
+			Status:  false,
+			Data:    results,
+		})
+	}
+	return c.JSON(http.StatusOK, &models.Response{
+		Message: "Ok",
+		Status:  true,
+		Data:    results,
+	})
+}
+
+type capabilities struct {
+	Versions   helpers.Versions `json:"versions"`
+	Codecs     codecs           `json:"codecs"`
+	Operations operations       `json:"operations"`
+	Limits     limits           `json:"limits"`
+}
+
+type codecs struct {
+	Input  []string `json:"input"`
+	Output []string `json:"output"`
+}
+
+type operations struct {
+	// Endpoints are the image processing routes
+	Endpoints []string `json:"endpoints"`
+	Pipeline  []string `json:"pipeline"`
+	Filters   []string `json:"filters"`
+	Effects   []string `json:"effects"`
+	Masks     []string `json:"masks"`
+	PadFills  []string `json:"pad_fills"`
+	Fits      []string `json:"fits"`
+	Gravities []string `json:"gravities"`
+	Animation []string `json:"animation"`
+	Luts      []string `json:"luts"`
+	Presets   []string `json:"presets"`
+}
+
+// limits reports the limits of the requests, max_pixels bounding a single frame and max_animation_pixels all
+// the frames of an animation
+type limits struct {
+	MaxUploadBytes         int64 `json:"max_upload_bytes"`
+	MaxPixels              int64 `json:"max_pixels"`
+	MaxAnimationPixels     int64 `json:"max_animation_pixels"`
+	MaxLutBytes            int64 `json:"max_lut_bytes"`
+	MaxLutSize             int   `json:"max_lut_size"`
+	MaxCanvasSide          int   `json:"max_canvas_side"`
+	MaxPadding             int   `json:"max_padding"`
+	MaxPipelineSteps       int   `json:"max_pipeline_steps"`
+	MaxAnimateFrames       int   `json:"max_animate_frames"`
+	MaxRedactRegions       int   `json:"max_redact_regions"`
+	MaxWatermarkTiles      int   `json:"max_watermark_tiles"`
+	MaxResponsiveWidths    int   `json:"max_responsive_widths"`
+	MaxResponsiveWidth     int   `json:"max_responsive_width"`
+	MaxResponsiveDensities int   `json:"max_responsive_densities"`
+	MaxResponsiveFormats   int   `json:"max_responsive_formats"`
+	DefaultQuality         int   `json:"default_quality"`
+	Workers                int   `json:"workers"`
+}
+
+// imageEndpoints returns the sorted image processing routes of the server
+func imageEndpoints(e *echo.Echo) []string {
+	r := []string{}
+	for _, route := range e.Routes() {
+		if route.Method == http.MethodPost && strings.HasPrefix(route.Path, "/image-") {
+			r = append(r, route.Path)
+		}
+	}
+	sort.Strings(r)
+	return r
+}
+
+// Capabilities reports the linked library versions, the available codecs, the enabled operations and the
+// configured limits, for the clients' feature detection
+func Capabilities(c echo.Context) error {
+	luts, err := helpers.ListLuts(rootPath())
+	if err != nil {
+		c.Logger().Error(err)
+	}
+	presets, err := helpers.ListPresets(rootPath())
+	if err != nil {
+		// the presets previously loaded keep being served
+		c.Logger().Error(err)
+	}
+	presetNames := []string{}
+	for _, preset := range presets {
+		presetNames = append(presetNames, preset.Name)
+	}
+	return c.JSON(http.StatusOK, &models.Response{
+		Message: "Ok",
+		Status:  true,
+		Data: capabilities{
+			Versions: helpers.LibraryVersions(),
+			Codecs: codecs{
+				Input:  inputFormats(),
+				Output: helpers.AvailableEncoders(),
+			},
+			Operations: operations{
+				Endpoints: imageEndpoints(c.Echo()),
+				Pipeline:  helpers.PipelineOperations(),
+				Filters:   helpers.Filters,
+				Effects:   helpers.Effects,
+				Masks:     helpers.Masks,
+				PadFills:  helpers.PadFills,
+				Fits:      helpers.Fits,
+				// the smart and face gravities are only used by the crops
+				Gravities: append(slices.Clone(helpers.Gravities), helpers.GravitySmart, helpers.GravityFace),
+				Animation: helpers.AnimationOperations,
+				Luts:      luts,
+				Presets:   presetNames,
+			},
+			Limits: limits{
+				MaxUploadBytes:         settings.Limits.MaxUploadBytes,
+				MaxPixels:              settings.Limits.MaxPixels,
+				MaxAnimationPixels:     helpers.MaxPixels,
+				MaxLutBytes:            settings.Limits.MaxLutBytes,
+				MaxLutSize:             helpers.MaxLutSize,
+				MaxCanvasSide:          helpers.MaxCanvasSide,
+				MaxPadding:             helpers.MaxPadding,
+				MaxPipelineSteps:       helpers.MaxPipelineSteps,
+				MaxAnimateFrames:       helpers.MaxAnimateFrames,
+				MaxRedactRegions:       helpers.MaxRedactRegions,
+				MaxWatermarkTiles:      helpers.MaxWatermarkTiles,
+				MaxResponsiveWidths:    helpers.MaxResponsiveWidths,
+				MaxResponsiveWidth:     helpers.MaxResponsiveWidth,
+				MaxResponsiveDensities: helpers.MaxResponsiveDensities,
+				MaxResponsiveFormats:   helpers.MaxResponsiveFormats,
+				DefaultQuality:         settings.Images.DefaultQuality,
+				Workers:                settings.Workers.Processing,
+			},
+		},
+	})
+}
@@ -0,0 +1,85 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/vafrcor/go-http-image-manipulation/config"
+)
+
+func TestHealthz(t *testing.T) {
+	e := echo.New()
+	rec := httptest.NewRecorder()
+	c := e.NewContext(httptest.NewRequest(http.MethodGet, "/", nil), rec)
+	c.SetPath("/healthz")
+
+	if assert.NoError(t, Healthz(c)) {
+		assert.Equal(t, http.StatusOK, rec.Code)
+	}
+}
+
+func TestReadyz(t *testing.T) {
+	e := echo.New()
+	rec := httptest.NewRecorder()
+	c := e.NewContext(httptest.NewRequest(http.MethodGet, "/", nil), rec)
+	c.SetPath("/readyz")
+
+	if assert.NoError(t, Readyz(c)) {
+		assert.Equal(t, http.StatusOK, rec.Code)
+		response := struct {
+			Data map[string]string `json:"data"`
+		}{}
+		json.Unmarshal(rec.Body.Bytes(), &response)
+		assert.Equal(t, map[string]string{"opencv": "ok", "storage.uploads": "ok", "storage.public": "ok", "storage.luts": "ok"}, response.Data)
+	}
+}
+
+func TestReadyzStorageNotWritable(t *testing.T) {
+	cfg := config.Default()
+	cfg.Storage.Root = t.TempDir()
+	Configure(cfg)
+	defer Configure(config.Default())
+
+	e := echo.New()
+	rec := httptest.NewRecorder()
+	c := e.NewContext(httptest.NewRequest(http.MethodGet, "/", nil), rec)
+	c.SetPath("/readyz")
+
+	if assert.NoError(t, Readyz(c)) {
+		assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+		response := struct {
+			Data map[string]string `json:"data"`
+		}{}
+		json.Unmarshal(rec.Body.Bytes(), &response)
+		assert.Equal(t, filepath.Join(cfg.Storage.Root, cfg.Storage.Uploads)+" is not writable", response.Data["storage.uploads"])
+		assert.Equal(t, "ok", response.Data["opencv"])
+	}
+}
+
+func TestCapabilities(t *testing.T) {
+	e := echo.New()
+	e.POST("/image-resize", ImageResize)
+	e.GET("/presets", ListPresets)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(httptest.NewRequest(http.MethodGet, "/", nil), rec)
+	c.SetPath("/capabilities")
+
+	if assert.NoError(t, Capabilities(c)) {
+		assert.Equal(t, http.StatusOK, rec.Code)
+		response := struct {
+			Data capabilities `json:"data"`
+		}{}
+		json.Unmarshal(rec.Body.Bytes(), &response)
+		assert.NotEmpty(t, response.Data.Versions.OpenCV)
+		assert.Equal(t, []string{"/image-resize"}, response.Data.Operations.Endpoints)
+		assert.Contains(t, response.Data.Codecs.Output, "jpeg")
+		assert.Contains(t, response.Data.Operations.Pipeline, "resize")
+		assert.Contains(t, response.Data.Operations.Presets, "thumb")
+		assert.Equal(t, int64(32<<20), response.Data.Limits.MaxUploadBytes)
+	}
+}
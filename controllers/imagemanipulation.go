@@ -1,6 +1,7 @@
 package controllers
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"image"
@@ -8,6 +9,7 @@ import (
 	_ "image/jpeg"
 	_ "image/png"
 	"io"
+	"mime/multipart"
 	"net/http"
 	"os"
 	"path/filepath"
@@ -19,184 +21,508 @@ import (
 	"github.com/labstack/echo/v4"
 	"github.com/vafrcor/go-http-image-manipulation/models"
 	helpers "github.com/vafrcor/go-http-image-manipulation/services"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	_ "golang.org/x/image/bmp"
 )
 
 func ValidateImageFileUpload(c echo.Context, allowedFormat []string, fieldName string) (map[string]string, error) {
-	data := map[string]string{
-		"cwd":              "",
-		"base_upload_path": "",
-		"upload_path":      "",
-		"output_path":      "",
-		"filename":         "",
-	}
-	now := time.Now()
-	ts := now.UnixNano()
-
 	// Get uploaded file
 	file, err := c.FormFile(fieldName)
 	if err != nil {
+		rejectedUploads.WithLabelValues(rejectMissing).Inc()
+		return nil, helpers.NewError(helpers.CodeMissingFile, fieldName, err.Error())
+	}
+	data := uploadPaths()
+	if err := saveImageUpload(c.Request().Context(), file, fieldName, filepath.Join(data["upload_path"], file.Filename), allowedFormat); err != nil {
 		return nil, err
 	}
 
-	// Validate Source
-	src, err := file.Open()
+	// Return data for next process
+	data["filename"] = file.Filename
+	return data, nil
+}
+
+// ValidateImageFilesUpload stores every (ordered) file uploaded under the field name. The stored file
+// names are prefixed with their position, so uploads sharing a name do not overwrite each other.
+func ValidateImageFilesUpload(c echo.Context, allowedFormat []string, fieldName string) (map[string]string, []string, error) {
+	form, err := c.MultipartForm()
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
-	defer src.Close()
+	files := form.File[fieldName]
+	if len(files) == 0 {
+		rejectedUploads.WithLabelValues(rejectMissing).Inc()
+		return nil, nil, helpers.NewError(helpers.CodeMissingFile, fieldName, http.ErrMissingFile.Error())
+	}
+	data := uploadPaths()
+	filenames := []string{}
+	for i, file := range files {
+		filename := fmt.Sprintf("%03d-%s", i, filepath.Base(file.Filename))
+		if err := saveImageUpload(c.Request().Context(), file, fieldName, filepath.Join(data["upload_path"], filename), allowedFormat); err != nil {
+			return nil, nil, err
+		}
+		filenames = append(filenames, filename)
+	}
+	return data, filenames, nil
+}
 
-	// Move File into destination directory
+// rootPath returns the application directory (the base path of the services): the configured storage root,
+// or the working directory
+func rootPath() string {
+	if settings.Storage.Root != "" {
+		return settings.Storage.Root
+	}
 	cwd, _ := os.Getwd()
-	cwd = strings.TrimSuffix(cwd, strings.Join([]string{string(os.PathSeparator), "controllers"}, ""))
+	return strings.TrimSuffix(cwd, strings.Join([]string{string(os.PathSeparator), "controllers"}, ""))
+}
+
+// uploadPaths creates a new upload directory and returns the paths used by the upload handlers
+func uploadPaths() map[string]string {
+	now := time.Now()
+	ts := now.UnixNano()
+	// Move File into destination directory
+	cwd := rootPath()
 	// fmt.Printf("CWD: %v\n", cwd)
-	baseUploadPath := filepath.Join(cwd, "storages", "uploads")
+	baseUploadPath := filepath.Join(cwd, settings.Storage.Uploads)
 	uploadPath := filepath.Join(baseUploadPath, fmt.Sprintf("%d", ts))
-	outputPath := filepath.Join(cwd, "storages", "public")
+	outputPath := filepath.Join(cwd, settings.Storage.Public)
 	_ = os.Mkdir(uploadPath, os.ModePerm)
-	tempFilepath := filepath.Join(uploadPath, file.Filename)
+	return map[string]string{
+		"cwd":              cwd,
+		"base_upload_path": baseUploadPath,
+		"upload_path":      uploadPath,
+		"output_path":      outputPath,
+		"filename":         "",
+	}
+}
+
+// saveImageUpload copies the file uploaded under the field to the destination and checks its size, dimensions
+// and image format, traced as the image.upload and image.validate stages
+func saveImageUpload(ctx context.Context, file *multipart.FileHeader, field string, tempFilepath string, allowedFormat []string) error {
+	_, span := tracer.Start(ctx, "image.upload", trace.WithAttributes(attribute.Int64("image.bytes", file.Size)))
+	maxBytes, maxPixels := uploadLimits(ctx)
+	err := copyImageUpload(file, field, tempFilepath, maxBytes)
+	helpers.EndSpan(span, err)
+	if err != nil {
+		return err
+	}
+
+	_, span = tracer.Start(ctx, "image.validate")
+	pixels, err := validateImageFile(span, field, tempFilepath, allowedFormat, maxPixels)
+	helpers.EndSpan(span, err)
+	if err == nil {
+		countPixels(ctx, pixels)
+	}
+	return err
+}
+
+// copyImageUpload checks the size of the uploaded file and copies it to the destination
+func copyImageUpload(file *multipart.FileHeader, field string, tempFilepath string, maxBytes int64) error {
+	if file.Size > maxBytes {
+		rejectedUploads.WithLabelValues(rejectSize).Inc()
+		return helpers.NewError(helpers.CodeUploadTooLarge, field, fmt.Sprintf("image exceeds the maximum upload size (%d bytes)", maxBytes))
+	}
+	// Validate Source
+	src, err := file.Open()
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
 	dst, err := os.Create(tempFilepath)
 	if err != nil {
-		return nil, err
+		return err
 	}
 	defer dst.Close()
 
-	if _, err = io.Copy(dst, src); err != nil {
-		return nil, err
-	}
+	_, err = io.Copy(dst, src)
+	return err
+}
 
+// validateImageFile checks the dimensions and the image format of the file, described on the span, and returns
+// its number of pixels. The dimensions are the ones of a single frame (the logical screen of a gif), the frames
+// of the animations being bounded together when decoded (see services.MaxPixels).
+func validateImageFile(span trace.Span, field string, tempFilepath string, allowedFormat []string, maxPixels int64) (int64, error) {
 	// Validate MimeType
 	tempFile, err := os.Open(tempFilepath)
 	if err != nil {
-		return nil, err
+		return 0, err
 	}
 	defer tempFile.Close()
-	_, imageType, err := image.Decode(tempFile)
+	// the dimensions are checked before decoding the pixels
+	imageConfig, imageType, err := image.DecodeConfig(tempFile)
 	if err != nil {
-		return nil, err
+		rejectedUploads.WithLabelValues(rejectDecode).Inc()
+		return 0, helpers.NewError(helpers.CodeDecodeFailed, field, err.Error())
+	}
+	span.SetAttributes(
+		attribute.Int("image.width", imageConfig.Width),
+		attribute.Int("image.height", imageConfig.Height),
+		attribute.String("image.format", imageType),
+	)
+	pixels := int64(imageConfig.Width) * int64(imageConfig.Height)
+	if pixels > maxPixels {
+		rejectedUploads.WithLabelValues(rejectDimensions).Inc()
+		return 0, helpers.NewError(helpers.CodeDimensionsTooLarge, field, fmt.Sprintf("image exceeds the maximum dimensions (%d pixels)", maxPixels))
+	}
+	if _, err := tempFile.Seek(0, io.SeekStart); err != nil {
+		return 0, err
+	}
+	_, imageType, err = image.Decode(tempFile)
+	if err != nil {
+		rejectedUploads.WithLabelValues(rejectDecode).Inc()
+		return 0, helpers.NewError(helpers.CodeDecodeFailed, field, err.Error())
 	}
 
 	if !slices.Contains(allowedFormat, imageType) {
+		rejectedUploads.WithLabelValues(rejectFormat).Inc()
 		// fmt.Printf("invalid mime %s\n", imageType)
 		msg := fmt.Sprintf("only accept image using specific format (%s)", strings.Join(allowedFormat, ","))
-		return nil, errors.New(msg)
+		return 0, helpers.NewError(helpers.CodeUnsupportedFormat, field, msg)
 	}
+	return pixels, nil
+}
 
-	// Return data for next process
-	data["filename"] = file.Filename
-	data["cwd"] = cwd
-	data["base_upload_path"] = baseUploadPath
-	data["upload_path"] = uploadPath
-	data["output_path"] = outputPath
-	return data, nil
+// formBool reads a 1 or 0 form option (defaulting to 0)
+func formBool(c echo.Context, name string) (bool, error) {
+	value := c.FormValue(name)
+	if value == "" {
+		return false, nil
+	}
+	if !slices.Contains([]string{"0", "1"}, value) {
+		return false, helpers.InvalidOption(name, "invalid %s option value (choose either 1 or 0)", name)
+	}
+	return value == "1", nil
+}
+
+// formNumbers reads the optional number form options into the given fields
+func formNumbers(c echo.Context, ints map[string]*int, floats map[string]*float64) error {
+	for name, value := range ints {
+		if v := c.FormValue(name); v != "" {
+			parsed, err := strconv.Atoi(v)
+			if err != nil {
+				return helpers.InvalidOption(name, "invalid %s (must be a number)", name)
+			}
+			*value = parsed
+		}
+	}
+	for name, value := range floats {
+		if v := c.FormValue(name); v != "" {
+			parsed, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				return helpers.InvalidOption(name, "invalid %s (must be a number)", name)
+			}
+			*value = parsed
+		}
+	}
+	return nil
+}
+
+// formSharpenOptions reads the post-resize sharpening options (sharpen, sharpen_amount, sharpen_radius and
+// sharpen_threshold). Sharpening is disabled (zero options) unless sharpen=1.
+func formSharpenOptions(c echo.Context) (helpers.SharpenOptions, error) {
+	sharpen := helpers.SharpenOptions{}
+	enabled, err := formBool(c, "sharpen")
+	if err != nil || !enabled {
+		return sharpen, err
+	}
+	err = formNumbers(c, nil, map[string]*float64{
+		"sharpen_amount":    &sharpen.Amount,
+		"sharpen_radius":    &sharpen.Radius,
+		"sharpen_threshold": &sharpen.Threshold,
+	})
+	if err != nil {
+		return sharpen, err
+	}
+	sharpen = sharpen.WithDefaults()
+	return sharpen, sharpen.Validate()
+}
+
+// formJpegOptions reads the jpeg encoding options (progressive, optimize, subsampling, restart_interval)
+func formJpegOptions(c echo.Context, encode *helpers.EncodeOptions) error {
+	var err error
+	if encode.Progressive, err = formBool(c, "progressive"); err != nil {
+		return err
+	}
+	if encode.Optimize, err = formBool(c, "optimize"); err != nil {
+		return err
+	}
+	// both 4:2:0 and 420 notations are accepted
+	encode.Subsampling = strings.ReplaceAll(c.FormValue("subsampling"), ":", "")
+	restartInterval := c.FormValue("restart_interval")
+	if restartInterval != "" {
+		encode.RestartInterval, err = strconv.Atoi(restartInterval)
+		if err != nil || encode.RestartInterval < 0 || encode.RestartInterval > 65535 {
+			return helpers.InvalidOption("restart_interval", "invalid restart_interval (must between 0 - 65535)")
+		}
+	}
+	return nil
+}
+
+// formEncodeOptions reads the output format, quality and lossless options (format specific options excluded)
+func formEncodeOptions(c echo.Context) (helpers.EncodeOptions, error) {
+	encode := helpers.EncodeOptions{
+		Format: strings.ToLower(c.FormValue("format")),
+	}
+	if quality := c.FormValue("quality"); quality != "" {
+		qualityInt, err := strconv.Atoi(quality)
+		if err != nil || qualityInt < 1 || qualityInt > 100 {
+			return encode, helpers.InvalidOption("quality", "invalid quality (must between 1 - 100)")
+		}
+		encode.Quality = qualityInt
+	}
+	var err error
+	encode.Lossless, err = formBool(c, "lossless")
+	return encode, err
+}
+
+// checkEncodeOptions validates the output options (output formats without an available encoder list the
+// available ones). format=auto is resolved after the upload, so it is always accepted here.
+func checkEncodeOptions(encode helpers.EncodeOptions) error {
+	if encode.Format == helpers.FormatAuto {
+		if encode.Palette || encode.Dither || encode.Progressive || encode.Optimize || encode.Subsampling != "" || encode.RestartInterval > 0 {
+			return helpers.InvalidOption("format", "format specific options can not be combined with format=auto")
+		}
+		return nil
+	}
+	err := encode.Validate()
+	if errors.Is(err, helpers.ErrUnsupportedOutputFormat) {
+		return fmt.Errorf("%w (available: %s)", err, strings.Join(helpers.AvailableEncoders(), ","))
+	}
+	return err
+}
+
+// negotiateEncodeFormat resolves format=auto against the client Accept header
+func negotiateEncodeFormat(c echo.Context, encode *helpers.EncodeOptions, inputFilePath string) {
+	if encode.Format != helpers.FormatAuto {
+		return
+	}
+	c.Response().Header().Add(echo.HeaderVary, echo.HeaderAccept)
+	encode.Format = helpers.NegotiateFileFormat(c.Request().Header.Get(echo.HeaderAccept), inputFilePath, encode.Lossless)
+	if (encode.MaxBytes > 0 || encode.TargetSSIM > 0) && !helpers.IsLossyFormat(encode.Format) {
+		// quality searches need a lossy format
+		encode.Format = helpers.FormatJpeg
+	}
+}
+
+// negotiateAlphaEncodeFormat resolves format=auto for transparent outputs, which fall back to png
+func negotiateAlphaEncodeFormat(c echo.Context, encode *helpers.EncodeOptions) {
+	if encode.Format != helpers.FormatAuto {
+		return
+	}
+	c.Response().Header().Add(echo.HeaderVary, echo.HeaderAccept)
+	encode.Format = helpers.NegotiateFormat(c.Request().Header.Get(echo.HeaderAccept), true, false)
+}
+
+// checkAlphaEncodeFormat rejects the output formats which can not keep transparent pixels (an empty format
+// defaults to png and format=auto is negotiated among the transparent ones)
+func checkAlphaEncodeFormat(encode helpers.EncodeOptions) error {
+	if encode.Format == "" || encode.Format == helpers.FormatAuto || encode.SupportsAlpha() {
+		return nil
+	}
+	return helpers.ErrAlphaFormatRequired
 }
 
 func ImageConvertPngToJpeg(c echo.Context) error {
+	encode := helpers.EncodeOptions{Format: helpers.FormatJpeg, Quality: 100}
+	quality := c.FormValue("quality")
+	if quality != "" {
+		qualityInt, err := strconv.Atoi(quality)
+		if err != nil || qualityInt < 1 || qualityInt > 100 {
+			return badRequest(c, helpers.InvalidOption("quality", "invalid quality (must between 1 - 100)"))
+		}
+		encode.Quality = qualityInt
+	}
+	if err := formJpegOptions(c, &encode); err != nil {
+		return badRequest(c, err)
+	}
+	if err := checkEncodeOptions(encode); err != nil {
+		return badRequest(c, err)
+	}
 	data, err := ValidateImageFileUpload(c, []string{"png"}, "file")
 	if err != nil {
-		return c.JSON(http.StatusBadRequest, &models.Response{
-			Message: err.Error(),
-			Status:  false,
-		})
+		return badRequest(c, err)
 	}
 	// fmt.Printf("DATA: %#v\n", data)
-	im := helpers.ImageManipulation{}
-	output, err := im.PngToJpeg(data["cwd"], data["upload_path"], data["output_path"], data["filename"], false)
+	im := helpers.NewImageManipulation(c.Request().Context())
+	output, err := im.PngToJpegWithOptions(data["cwd"], data["upload_path"], data["output_path"], data["filename"], encode, false)
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, err)
+		return respondError(c, err)
 	}
 
 	return c.JSON(http.StatusOK, &models.Response{
 		Message: "Ok",
 		Status:  true,
-		Data:    fmt.Sprintf("%s://%s/static%s", helpers.GetEchoRequestScheme(c), c.Request().Host, strings.Replace(output, data["output_path"], "", 100)),
+		Data:    outputURL(c, output, data["output_path"]),
 	})
 }
 
 func ImageResize(c echo.Context) error {
+	if preset := c.FormValue("preset"); preset != "" {
+		return imagePreset(c, preset)
+	}
 	keepAspectRatio := c.FormValue("keep_aspect_ratio")
 	possibleAR := []string{"0", "1"}
 	if keepAspectRatio == "" {
 		keepAspectRatio = "1"
 	}
 	if !slices.Contains(possibleAR, keepAspectRatio) {
-		return c.JSON(http.StatusBadRequest, &models.Response{
-			Message: "invalid keep_aspect_ratio option value (choose either 1 or 0)",
-			Status:  false,
-		})
+		return badRequest(c, helpers.InvalidOption("keep_aspect_ratio", "invalid keep_aspect_ratio option value (choose either 1 or 0)"))
 	}
 	width := c.FormValue("width")
 	height := c.FormValue("height")
 	if width == "" || height == "" {
-		return c.JSON(http.StatusBadRequest, &models.Response{
-			Message: "invalid width or height",
-			Status:  false,
-		})
+		return badRequest(c, helpers.InvalidOption("", "invalid width or height"))
 	}
 	widthFloat, _ := strconv.ParseFloat(width, 64)
 	heightFloat, _ := strconv.ParseFloat(height, 64)
 	if widthFloat < 0 || heightFloat < 0 {
-		return c.JSON(http.StatusBadRequest, &models.Response{
-			Message: "invalid width or height",
-			Status:  false,
-		})
+		return badRequest(c, helpers.InvalidOption("", "invalid width or height"))
+	}
+	sharpen, err := formSharpenOptions(c)
+	if err != nil {
+		return badRequest(c, err)
+	}
+	// fit overrides keep_aspect_ratio, fit=cover crops the overflow according to the gravity
+	fit := strings.ToLower(c.FormValue("fit"))
+	if fit != "" && !slices.Contains(helpers.Fits, fit) {
+		return badRequest(c, helpers.InvalidOption("fit", "invalid fit option value (choose either contain, fill or cover)"))
+	}
+	crop := helpers.CropOptions{
+		Width:    int(widthFloat),
+		Height:   int(heightFloat),
+		Gravity:  strings.ToLower(c.FormValue("gravity")),
+		Fallback: strings.ToLower(c.FormValue("fallback")),
+	}.WithDefaults()
+	if fit == helpers.FitCover {
+		if err := crop.Validate(); err != nil {
+			return badRequest(c, err)
+		}
+	}
+
+	encode := helpers.EncodeOptions{
+		Format:  strings.ToLower(c.FormValue("format")),
+		Quality: 100,
+	}
+	if encode.Format != "" {
+		if err := checkEncodeOptions(encode); err != nil {
+			return badRequest(c, err)
+		}
 	}
 
-	data, err := ValidateImageFileUpload(c, []string{"png", "jpg", "jpeg", "bmp"}, "file")
+	data, err := ValidateImageFileUpload(c, inputFormats(), "file")
 	if err != nil {
-		return c.JSON(http.StatusBadRequest, &models.Response{
-			Message: err.Error(),
-			Status:  false,
-		})
+		return badRequest(c, err)
 	}
 	// fmt.Printf("DATA: %#v\n", data)
-	im := helpers.ImageManipulation{}
+	negotiateEncodeFormat(c, &encode, filepath.Join(data["upload_path"], data["filename"]))
+	im := helpers.NewImageManipulation(c.Request().Context())
+	if fit == helpers.FitCover {
+		result, err := im.ResizeCover(data["cwd"], data["upload_path"], data["output_path"], data["filename"], crop, sharpen, encode, false)
+		if err != nil {
+			return respondError(c, err)
+		}
+		return c.JSON(http.StatusOK, &models.Response{
+			Message: "Ok",
+			Status:  true,
+			Data:    outputURL(c, result.OutputFilePath, data["output_path"]),
+			Meta:    result,
+		})
+	}
 	keepAspectRatioBool, _ := strconv.ParseBool(keepAspectRatio)
-	output, err := im.Resize(data["cwd"], data["upload_path"], data["output_path"], data["filename"], widthFloat, heightFloat, 100, keepAspectRatioBool, false)
+	if fit != "" {
+		keepAspectRatioBool = fit == helpers.FitContain
+	}
+	output, err := im.ResizeWithOptions(data["cwd"], data["upload_path"], data["output_path"], data["filename"], widthFloat, heightFloat, keepAspectRatioBool, sharpen, encode, false)
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, err)
+		return respondError(c, err)
 	}
 
 	return c.JSON(http.StatusOK, &models.Response{
 		Message: "Ok",
 		Status:  true,
-		Data:    fmt.Sprintf("%s://%s/static%s", helpers.GetEchoRequestScheme(c), c.Request().Host, strings.Replace(output, data["output_path"], "", 100)),
+		Data:    outputURL(c, output, data["output_path"]),
 	})
 }
 
 func ImageCompress(c echo.Context) error {
-	quality := c.FormValue("quality")
-	queryError := ""
-	if quality == "" {
-		queryError = "invalid quality (must between 1 - 100)"
+	if preset := c.FormValue("preset"); preset != "" {
+		return imagePreset(c, preset)
+	}
+	losslessBool, err := formBool(c, "lossless")
+	if err != nil {
+		return badRequest(c, err)
+	}
+	allowDownscaleBool, err := formBool(c, "allow_downscale")
+	if err != nil {
+		return badRequest(c, err)
+	}
+	paletteBool, err := formBool(c, "palette")
+	if err != nil {
+		return badRequest(c, err)
+	}
+	ditherBool, err := formBool(c, "dither")
+	if err != nil {
+		return badRequest(c, err)
+	}
+	maxBytes := c.FormValue("max_bytes")
+	maxBytesInt, err := strconv.Atoi(maxBytes)
+	if maxBytes != "" && (maxBytesInt <= 0 || err != nil) {
+		return badRequest(c, helpers.InvalidOption("max_bytes", "invalid max_bytes (must be a positive number of bytes)"))
 	}
+	targetSSIM := c.FormValue("target_ssim")
+	targetSSIMFloat, err := strconv.ParseFloat(targetSSIM, 64)
+	if targetSSIM != "" && (targetSSIMFloat <= 0 || targetSSIMFloat >= 1 || err != nil) {
+		return badRequest(c, helpers.InvalidOption("target_ssim", "invalid target_ssim (must be greater than 0 and lower than 1)"))
+	}
+	quality := c.FormValue("quality")
+	format := strings.ToLower(c.FormValue("format"))
+	// the quality is required unless the format ignores it (jpeg by default, auto being negotiated later)
+	ignoresQuality := losslessBool || (format != "" && format != helpers.FormatAuto && !helpers.IsLossyFormat(format))
+	invalidQuality := quality == "" && maxBytesInt == 0 && targetSSIMFloat == 0 && !ignoresQuality
 	qualityInt, err := strconv.Atoi(quality)
-	if qualityInt < 0 || err != nil {
-		queryError = "invalid quality (must between 1 - 100)"
+	if quality != "" && (qualityInt < 0 || qualityInt > 100 || err != nil) {
+		invalidQuality = true
 	}
-	if queryError != "" {
-		return c.JSON(http.StatusBadRequest, &models.Response{
-			Message: queryError,
-			Status:  false,
-		})
+	if invalidQuality {
+		return badRequest(c, helpers.InvalidOption("quality", "invalid quality (must between 1 - 100)"))
+	}
+	encode := helpers.EncodeOptions{
+		Format:         format,
+		Quality:        qualityInt,
+		Lossless:       losslessBool,
+		MaxBytes:       maxBytesInt,
+		AllowDownscale: allowDownscaleBool,
+		TargetSSIM:     targetSSIMFloat,
+		Palette:        paletteBool,
+		Dither:         ditherBool,
 	}
-	data, err := ValidateImageFileUpload(c, []string{"png", "jpg", "jpeg", "bmp"}, "file")
+	if err := formJpegOptions(c, &encode); err != nil {
+		return badRequest(c, err)
+	}
+	if encode.Format == "" {
+		encode.Format = helpers.FormatJpeg
+	}
+	if err := checkEncodeOptions(encode); err != nil {
+		return badRequest(c, err)
+	}
+	data, err := ValidateImageFileUpload(c, inputFormats(), "file")
 	if err != nil {
-		return c.JSON(http.StatusBadRequest, &models.Response{
-			Message: err.Error(),
-			Status:  false,
-		})
+		return badRequest(c, err)
 	}
 	// fmt.Printf("DATA: %#v\n", data)
-	im := helpers.ImageManipulation{}
-	output, err := im.Compress(data["cwd"], data["upload_path"], data["output_path"], data["filename"], qualityInt, false)
+	negotiateEncodeFormat(c, &encode, filepath.Join(data["upload_path"], data["filename"]))
+	im := helpers.NewImageManipulation(c.Request().Context())
+	result, err := im.CompressWithOptions(data["cwd"], data["upload_path"], data["output_path"], data["filename"], encode, false)
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, err)
+		return respondError(c, err)
 	}
 
 	return c.JSON(http.StatusOK, &models.Response{
 		Message: "Ok",
 		Status:  true,
-		Data:    fmt.Sprintf("%s://%s/static%s", helpers.GetEchoRequestScheme(c), c.Request().Host, strings.Replace(output, data["output_path"], "", 100)),
+		Data:    outputURL(c, result.OutputFilePath, data["output_path"]),
+		Meta:    result,
 	})
 }
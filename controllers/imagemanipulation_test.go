@@ -12,6 +12,7 @@ import (
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"testing"
 
@@ -20,6 +21,7 @@ import (
 	"github.com/labstack/echo/v4"
 	"github.com/stretchr/testify/assert"
 	"github.com/vafrcor/go-http-image-manipulation/models"
+	helpers "github.com/vafrcor/go-http-image-manipulation/services"
 )
 
 func TestImageManipulationImageConvertPngToJpeg(t *testing.T) {
@@ -451,3 +453,373 @@ func TestImageManipulationImageCompressInvalidFileFormat(t *testing.T) {
 		}
 	}
 }
+
+func TestImageManipulationImageCompressUnsupportedFormat(t *testing.T) {
+	// Setup
+	e := echo.New()
+	cwd, _ := os.Getwd()
+	rootDir := filepath.Clean(filepath.Join(cwd, ".."))
+	testFilePath := filepath.Join(rootDir, "storages", "test", "sample-test.png")
+	body := new(bytes.Buffer)
+	writer := multipart.NewWriter(body)
+	writer.WriteField("quality", "80")
+	writer.WriteField("format", "tiff")
+	part, _ := writer.CreateFormFile("file", "sample-test.png")
+	testFile, _ := os.Open(testFilePath)
+	defer testFile.Close()
+	imageData, _, _ := image.Decode(testFile)
+
+	png.Encode(body, imageData)
+	part.Write([]byte(body.Bytes()))
+	writer.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/", body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	c.SetPath("/image-compression")
+
+	if assert.NoError(t, ImageCompress(c)) {
+		assert.Equal(t, http.StatusUnsupportedMediaType, rec.Code)
+		jsonData := []byte(rec.Body.Bytes())
+		var data models.Response
+		err := json.Unmarshal(jsonData, &data)
+		if err == nil {
+			assert.True(t, data.Status == false)
+			assert.True(t, strings.HasPrefix(data.Message, "unsupported output format: tiff"))
+		}
+	}
+}
+
+func TestImageManipulationImageCompressLosslessWebp(t *testing.T) {
+	// Setup
+	e := echo.New()
+	cwd, _ := os.Getwd()
+	rootDir := filepath.Clean(filepath.Join(cwd, ".."))
+	testFilePath := filepath.Join(rootDir, "storages", "test", "sample-test.png")
+	body := new(bytes.Buffer)
+	writer := multipart.NewWriter(body)
+	writer.WriteField("format", "webp")
+	writer.WriteField("lossless", "1")
+	part, _ := writer.CreateFormFile("file", "sample-test.png")
+	testFile, _ := os.Open(testFilePath)
+	defer testFile.Close()
+	imageData, _, _ := image.Decode(testFile)
+
+	png.Encode(body, imageData)
+	part.Write([]byte(body.Bytes()))
+	writer.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/", body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	c.SetPath("/image-compression")
+
+	expectedCode := http.StatusUnsupportedMediaType
+	if helpers.IsEncoderAvailable(helpers.FormatWebp) {
+		expectedCode = http.StatusOK
+	}
+	if assert.NoError(t, ImageCompress(c)) {
+		assert.Equal(t, expectedCode, rec.Code)
+		assert.True(t, len(rec.Body.String()) > 0)
+	}
+}
+
+func TestImageManipulationImageResizeFormatAuto(t *testing.T) {
+	// Setup
+	e := echo.New()
+	cwd, _ := os.Getwd()
+	rootDir := filepath.Clean(filepath.Join(cwd, ".."))
+	testFilePath := filepath.Join(rootDir, "storages", "test", "sample-test.png")
+	body := new(bytes.Buffer)
+	writer := multipart.NewWriter(body)
+	writer.WriteField("width", "480")
+	writer.WriteField("height", "320")
+	writer.WriteField("format", "auto")
+	part, _ := writer.CreateFormFile("file", "sample-test.png")
+	testFile, _ := os.Open(testFilePath)
+	defer testFile.Close()
+	imageData, _, _ := image.Decode(testFile)
+
+	png.Encode(body, imageData)
+	part.Write([]byte(body.Bytes()))
+	writer.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/", body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	req.Header.Set(echo.HeaderAccept, "image/webp,*/*")
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	c.SetPath("/image-resize")
+
+	if assert.NoError(t, ImageResize(c)) {
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, echo.HeaderAccept, rec.Header().Get(echo.HeaderVary))
+		jsonData := []byte(rec.Body.Bytes())
+		var data models.Response
+		err := json.Unmarshal(jsonData, &data)
+		if err == nil {
+			assert.True(t, data.Status)
+		}
+	}
+}
+
+func TestImageManipulationImageCompressMaxBytes(t *testing.T) {
+	// Setup
+	e := echo.New()
+	cwd, _ := os.Getwd()
+	rootDir := filepath.Clean(filepath.Join(cwd, ".."))
+	testFilePath := filepath.Join(rootDir, "storages", "test", "sample-test.png")
+	body := new(bytes.Buffer)
+	writer := multipart.NewWriter(body)
+	writer.WriteField("max_bytes", "30000")
+	writer.WriteField("allow_downscale", "1")
+	part, _ := writer.CreateFormFile("file", "sample-test.png")
+	testFile, _ := os.Open(testFilePath)
+	defer testFile.Close()
+	imageData, _, _ := image.Decode(testFile)
+
+	png.Encode(body, imageData)
+	part.Write([]byte(body.Bytes()))
+	writer.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/", body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	c.SetPath("/image-compression")
+
+	if assert.NoError(t, ImageCompress(c)) {
+		assert.Equal(t, http.StatusOK, rec.Code)
+		jsonData := []byte(rec.Body.Bytes())
+		var data models.Response
+		err := json.Unmarshal(jsonData, &data)
+		if err == nil {
+			assert.True(t, data.Status)
+			meta := data.Meta.(map[string]interface{})
+			assert.True(t, meta["bytes"].(float64) <= 30000)
+			assert.Contains(t, meta, "quality")
+		}
+	}
+}
+
+func TestImageManipulationImageCompressInvalidMaxBytes(t *testing.T) {
+	// Setup
+	e := echo.New()
+	body := new(bytes.Buffer)
+	writer := multipart.NewWriter(body)
+	writer.WriteField("max_bytes", "-10")
+	writer.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/", body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	c.SetPath("/image-compression")
+
+	if assert.NoError(t, ImageCompress(c)) {
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		jsonData := []byte(rec.Body.Bytes())
+		var data models.Response
+		err := json.Unmarshal(jsonData, &data)
+		if err == nil {
+			assert.True(t, data.Status == false)
+			assert.Equal(t, "invalid max_bytes (must be a positive number of bytes)", data.Message)
+		}
+	}
+}
+
+func TestImageManipulationImageCompressQualityAbove100(t *testing.T) {
+	// Setup
+	e := echo.New()
+	body := new(bytes.Buffer)
+	writer := multipart.NewWriter(body)
+	writer.WriteField("format", "webp")
+	writer.WriteField("quality", "150")
+	writer.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/", body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	c.SetPath("/image-compression")
+
+	if assert.NoError(t, ImageCompress(c)) {
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		jsonData := []byte(rec.Body.Bytes())
+		var data models.Response
+		err := json.Unmarshal(jsonData, &data)
+		if err == nil {
+			assert.True(t, data.Status == false)
+			assert.Equal(t, "invalid quality (must between 1 - 100)", data.Message)
+		}
+	}
+}
+
+func TestImageManipulationImageCompressTargetSSIM(t *testing.T) {
+	// Setup
+	e := echo.New()
+	cwd, _ := os.Getwd()
+	rootDir := filepath.Clean(filepath.Join(cwd, ".."))
+	testFilePath := filepath.Join(rootDir, "storages", "test", "sample-test.png")
+	body := new(bytes.Buffer)
+	writer := multipart.NewWriter(body)
+	writer.WriteField("target_ssim", "0.95")
+	part, _ := writer.CreateFormFile("file", "sample-test.png")
+	testFile, _ := os.Open(testFilePath)
+	defer testFile.Close()
+	imageData, _, _ := image.Decode(testFile)
+
+	png.Encode(body, imageData)
+	part.Write([]byte(body.Bytes()))
+	writer.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/", body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	c.SetPath("/image-compression")
+
+	if assert.NoError(t, ImageCompress(c)) {
+		assert.Equal(t, http.StatusOK, rec.Code)
+		jsonData := []byte(rec.Body.Bytes())
+		var data models.Response
+		err := json.Unmarshal(jsonData, &data)
+		if err == nil {
+			assert.True(t, data.Status)
+			meta := data.Meta.(map[string]interface{})
+			assert.True(t, meta["ssim"].(float64) >= 0.95)
+			assert.Contains(t, meta, "saved_bytes")
+		}
+	}
+}
+
+func TestImageManipulationImageCompressPngPalette(t *testing.T) {
+	// Setup
+	e := echo.New()
+	cwd, _ := os.Getwd()
+	rootDir := filepath.Clean(filepath.Join(cwd, ".."))
+	testFilePath := filepath.Join(rootDir, "storages", "test", "sample-test.png")
+	body := new(bytes.Buffer)
+	writer := multipart.NewWriter(body)
+	writer.WriteField("format", "png")
+	writer.WriteField("palette", "1")
+	writer.WriteField("dither", "1")
+	part, _ := writer.CreateFormFile("file", "sample-test.png")
+	testFile, _ := os.Open(testFilePath)
+	defer testFile.Close()
+	imageData, _, _ := image.Decode(testFile)
+
+	png.Encode(body, imageData)
+	part.Write([]byte(body.Bytes()))
+	writer.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/", body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	c.SetPath("/image-compression")
+
+	if assert.NoError(t, ImageCompress(c)) {
+		assert.Equal(t, http.StatusOK, rec.Code)
+		jsonData := []byte(rec.Body.Bytes())
+		var data models.Response
+		err := json.Unmarshal(jsonData, &data)
+		if err == nil {
+			assert.True(t, data.Status)
+			assert.True(t, strings.HasSuffix(data.Data.(string), ".png"))
+			meta := data.Meta.(map[string]interface{})
+			assert.Contains(t, meta, "saved_bytes")
+			assert.Contains(t, meta, "colors")
+		}
+	}
+}
+
+func TestImageManipulationImageConvertPngToJpegProgressive(t *testing.T) {
+	// Setup
+	e := echo.New()
+	cwd, _ := os.Getwd()
+	rootDir := filepath.Clean(filepath.Join(cwd, ".."))
+	testFilePath := filepath.Join(rootDir, "storages", "test", "sample-test.png")
+	body := new(bytes.Buffer)
+	writer := multipart.NewWriter(body)
+	writer.WriteField("quality", "85")
+	writer.WriteField("progressive", "1")
+	writer.WriteField("optimize", "1")
+	writer.WriteField("subsampling", "4:2:0")
+	writer.WriteField("restart_interval", "8")
+	part, _ := writer.CreateFormFile("file", "sample-test.png")
+	testFile, _ := os.Open(testFilePath)
+	defer testFile.Close()
+	imageData, _, _ := image.Decode(testFile)
+
+	png.Encode(body, imageData)
+	part.Write([]byte(body.Bytes()))
+	writer.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/", body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	c.SetPath("/image-png-to-jpeg")
+
+	if assert.NoError(t, ImageConvertPngToJpeg(c)) {
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.True(t, len(rec.Body.String()) > 0)
+	}
+}
+
+func TestImageManipulationImageConvertPngToJpegInvalidSubsampling(t *testing.T) {
+	// Setup
+	e := echo.New()
+	body := new(bytes.Buffer)
+	writer := multipart.NewWriter(body)
+	writer.WriteField("subsampling", "4:1:1")
+	writer.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/", body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	c.SetPath("/image-png-to-jpeg")
+
+	if assert.NoError(t, ImageConvertPngToJpeg(c)) {
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		jsonData := []byte(rec.Body.Bytes())
+		var data models.Response
+		err := json.Unmarshal(jsonData, &data)
+		if err == nil {
+			assert.True(t, data.Status == false)
+			assert.Equal(t, "invalid subsampling (choose either 444, 422 or 420)", data.Message)
+		}
+	}
+}
+
+func TestImageResizeInvalidFit(t *testing.T) {
+	// Setup
+	e := echo.New()
+	body := new(bytes.Buffer)
+	writer := multipart.NewWriter(body)
+	writer.WriteField("width", "300")
+	writer.WriteField("height", "300")
+	writer.WriteField("fit", "stretch")
+	writer.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/", body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	c.SetPath("/image-resize")
+
+	if assert.NoError(t, ImageResize(c)) {
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		jsonData := []byte(rec.Body.Bytes())
+		var data models.Response
+		err := json.Unmarshal(jsonData, &data)
+		if err == nil {
+			assert.True(t, data.Status == false)
+			assert.Contains(t, data.Message, "invalid fit")
+		}
+	}
+}
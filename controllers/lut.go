@@ -0,0 +1,68 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/vafrcor/go-http-image-manipulation/models"
+	helpers "github.com/vafrcor/go-http-image-manipulation/services"
+)
+
+// UploadLut stores the uploaded .cube file (file) under the name, to be referenced by the lut effect.
+// Existing LUTs are only overwritten with replace=1.
+func UploadLut(c echo.Context) error {
+	name := c.FormValue("name")
+	replace, err := formBool(c, "replace")
+	if err != nil {
+		return badRequest(c, err)
+	}
+	file, err := c.FormFile("file")
+	if err != nil {
+		return badRequest(c, helpers.NewError(helpers.CodeMissingFile, "file", err.Error()))
+	}
+	if !strings.EqualFold(filepath.Ext(file.Filename), ".cube") || file.Size > settings.Limits.MaxLutBytes {
+		// the default limit (16MB) fits a 65 points LUT, which takes about 8MB
+		return badRequest(c, helpers.InvalidOption("file", "only accept .cube files up to %d bytes", settings.Limits.MaxLutBytes))
+	}
+	src, err := file.Open()
+	if err != nil {
+		return respondError(c, err)
+	}
+	defer src.Close()
+	data, err := io.ReadAll(io.LimitReader(src, settings.Limits.MaxLutBytes))
+	if err != nil {
+		return respondError(c, err)
+	}
+	lut, err := helpers.SaveLut(rootPath(), name, data, replace)
+	if errors.Is(err, helpers.ErrLutExists) {
+		err = fmt.Errorf("%w (set replace=1 to overwrite it)", err)
+	}
+	if err != nil {
+		return respondError(c, err)
+	}
+
+	return c.JSON(http.StatusCreated, &models.Response{
+		Message: "Ok",
+		Status:  true,
+		Data:    name,
+		Meta:    lut,
+	})
+}
+
+// ListLuts returns the names of the stored LUTs
+func ListLuts(c echo.Context) error {
+	names, err := helpers.ListLuts(rootPath())
+	if err != nil {
+		return respondError(c, err)
+	}
+	return c.JSON(http.StatusOK, &models.Response{
+		Message: "Ok",
+		Status:  true,
+		Data:    names,
+	})
+}
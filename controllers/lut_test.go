@@ -0,0 +1,91 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/vafrcor/go-http-image-manipulation/models"
+	helpers "github.com/vafrcor/go-http-image-manipulation/services"
+)
+
+// identityCube returns a 2 points identity LUT in the .cube format
+func identityCube() string {
+	var b strings.Builder
+	b.WriteString("LUT_3D_SIZE 2\n")
+	for i := 0; i < 8; i++ {
+		b.WriteString(fmt.Sprintf("%d %d %d\n", i&1, (i>>1)&1, (i>>2)&1))
+	}
+	return b.String()
+}
+
+func uploadLutRequest(fields map[string]string, filename string, content string) (*httptest.ResponseRecorder, echo.Context) {
+	e := echo.New()
+	body := new(bytes.Buffer)
+	writer := multipart.NewWriter(body)
+	for name, value := range fields {
+		writer.WriteField(name, value)
+	}
+	part, _ := writer.CreateFormFile("file", filename)
+	part.Write([]byte(content))
+	writer.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/", body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	c.SetPath("/luts")
+	return rec, c
+}
+
+func TestUploadLut(t *testing.T) {
+	cwd, _ := os.Getwd()
+	rootDir := filepath.Clean(filepath.Join(cwd, ".."))
+	defer os.Remove(filepath.Join(rootDir, helpers.LutDirectory, "test-identity.cube"))
+
+	cases := []struct {
+		fields   map[string]string
+		filename string
+		content  string
+		status   int
+	}{
+		{map[string]string{"name": "test-identity", "replace": "1"}, "identity.cube", identityCube(), http.StatusCreated},
+		{map[string]string{"name": "test-identity"}, "identity.cube", identityCube(), http.StatusConflict},
+		{map[string]string{"name": "test-identity", "replace": "1"}, "identity.cube", "LUT_3D_SIZE 2\n0 0 0\n", http.StatusBadRequest},
+		{map[string]string{"name": "../identity"}, "identity.cube", identityCube(), http.StatusBadRequest},
+		{map[string]string{"name": "test-identity"}, "identity.txt", identityCube(), http.StatusBadRequest},
+	}
+	for i, tc := range cases {
+		rec, c := uploadLutRequest(tc.fields, tc.filename, tc.content)
+		if assert.NoError(t, UploadLut(c)) {
+			assert.Equal(t, tc.status, rec.Code, fmt.Sprintf("Case %d status", i))
+		}
+	}
+
+	// Setup
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	c.SetPath("/luts")
+
+	if assert.NoError(t, ListLuts(c)) {
+		assert.Equal(t, http.StatusOK, rec.Code)
+		jsonData := []byte(rec.Body.Bytes())
+		var data models.Response
+		err := json.Unmarshal(jsonData, &data)
+		if err == nil {
+			assert.True(t, data.Status)
+			assert.Contains(t, data.Data, "test-identity")
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package controllers
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/vafrcor/go-http-image-manipulation/models"
+	helpers "github.com/vafrcor/go-http-image-manipulation/services"
+)
+
+// ImageMask rounds the corners of the image (shape=rounded, with an optional radius) or cuts a circle out of it
+// (shape=circle). The output is transparent, encoded into png unless webp or avif is requested.
+func ImageMask(c echo.Context) error {
+	options := helpers.MaskOptions{
+		Shape: strings.ToLower(c.FormValue("shape")),
+	}
+	err := formNumbers(c, map[string]*int{"radius": &options.Radius}, nil)
+	if err == nil {
+		options = options.WithDefaults()
+		err = options.Validate()
+	}
+	if err != nil {
+		return badRequest(c, err)
+	}
+	encode, err := formEncodeOptions(c)
+	if err == nil {
+		err = checkAlphaEncodeFormat(encode)
+	}
+	if err != nil {
+		return badRequest(c, err)
+	}
+	if encode.Format != "" {
+		if err := checkEncodeOptions(encode); err != nil {
+			return badRequest(c, err)
+		}
+	}
+	data, err := ValidateImageFileUpload(c, inputFormats(), "file")
+	if err != nil {
+		return badRequest(c, err)
+	}
+	// fmt.Printf("DATA: %#v\n", data)
+	negotiateAlphaEncodeFormat(c, &encode)
+	im := helpers.NewImageManipulation(c.Request().Context())
+	result, err := im.Filter(data["cwd"], data["upload_path"], data["output_path"], data["filename"], options, encode, false)
+	if err != nil {
+		return respondError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, &models.Response{
+		Message: "Ok",
+		Status:  true,
+		Data:    outputURL(c, result.OutputFilePath, data["output_path"]),
+		Meta:    result,
+	})
+}
@@ -0,0 +1,183 @@
+package controllers
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	helpers "github.com/vafrcor/go-http-image-manipulation/services"
+)
+
+var (
+	durationBuckets = []float64{0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+	// 1KB - 64MB
+	byteBuckets  = prometheus.ExponentialBuckets(1<<10, 4, 9)
+	ratioBuckets = []float64{0.5, 1, 1.5, 2, 3, 5, 10, 20, 50}
+
+	operationsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "image_operations_total",
+		Help: "Image operations by operation and HTTP status code.",
+	}, []string{"operation", "code"})
+	operationDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "image_operation_duration_seconds",
+		Help:    "Duration of the image operations by operation and output format.",
+		Buckets: durationBuckets,
+	}, []string{"operation", "format"})
+	inputBytes = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "image_input_bytes",
+		Help:    "Size of the uploaded files by operation.",
+		Buckets: byteBuckets,
+	}, []string{"operation"})
+	outputBytes = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "image_output_bytes",
+		Help:    "Size of the output images by operation and format.",
+		Buckets: byteBuckets,
+	}, []string{"operation", "format"})
+	compressionRatio = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "image_compression_ratio",
+		Help:    "Uploaded size divided by the output size, by operation and format.",
+		Buckets: ratioBuckets,
+	}, []string{"operation", "format"})
+	rejectedUploads = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "image_rejected_uploads_total",
+		Help: "Uploads rejected by reason.",
+	}, []string{"reason"})
+	rateLimited = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "image_rate_limited_total",
+		Help: "Requests rejected by the client limits, by operation and reason.",
+	}, []string{"operation", "reason"})
+)
+
+// reasons of the rejected uploads
+const (
+	rejectMissing    = "missing"
+	rejectSize       = "size"
+	rejectDimensions = "dimensions"
+	rejectDecode     = "decode"
+	rejectFormat     = "format"
+)
+
+func init() {
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "image_workers",
+		Help: "Image operations able to run at once.",
+	}, func() float64 {
+		return float64(cap(workers))
+	})
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "image_workers_busy",
+		Help: "Image operations running.",
+	}, func() float64 {
+		return float64(runningOperations.Load())
+	})
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "image_worker_queue_depth",
+		Help: "Image operations waiting for a free worker.",
+	}, func() float64 {
+		return float64(queuedOperations.Load())
+	})
+	// the open Mats are only counted when built with -tags matprofile
+	if _, ok := helpers.OpenMats(); ok {
+		promauto.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "gocv_open_mats",
+			Help: "gocv Mats allocated and not closed yet.",
+		}, func() float64 {
+			count, _ := helpers.OpenMats()
+			return float64(count)
+		})
+	}
+}
+
+// Metrics exposes the metrics in the Prometheus text format
+var Metrics = echo.WrapHandler(promhttp.Handler())
+
+// operationOutputsKey stores the output files of the operation in the echo context
+const operationOutputsKey = "operation_outputs"
+
+// recordOutput notes an output file of the operation, measured by Instrument once the request completes
+func recordOutput(c echo.Context, path string) {
+	if outputs, ok := c.Get(operationOutputsKey).(*[]string); ok {
+		*outputs = append(*outputs, path)
+	}
+}
+
+// staticURL returns the public URL of a file of the output path
+func staticURL(c echo.Context, path string, outputPath string) string {
+	return fmt.Sprintf("%s://%s/static%s", helpers.GetEchoRequestScheme(c), c.Request().Host, strings.Replace(path, outputPath, "", 100))
+}
+
+// outputURL records the output file of the operation and returns its public URL
+func outputURL(c echo.Context, path string, outputPath string) string {
+	recordOutput(c, path)
+	return staticURL(c, path, outputPath)
+}
+
+// outputFormat names the format of an output file after its extension
+func outputFormat(path string) string {
+	format := strings.TrimPrefix(strings.ToLower(filepath.Ext(path)), ".")
+	if format == "jpg" {
+		return helpers.FormatJpeg
+	}
+	return format
+}
+
+// uploadedBytes sums the sizes of the files uploaded with the request
+func uploadedBytes(c echo.Context) int64 {
+	form := c.Request().MultipartForm
+	if form == nil {
+		return 0
+	}
+	total := int64(0)
+	for _, files := range form.File {
+		for _, file := range files {
+			total += file.Size
+		}
+	}
+	return total
+}
+
+// Instrument measures the image operations of the routes: count, duration, uploaded and output sizes and
+// compression ratio. The operation is named after the route (resize for /image-resize), the format after the
+// first output (none without output).
+func Instrument(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		start := time.Now()
+		outputs := []string{}
+		c.Set(operationOutputsKey, &outputs)
+		err := next(c)
+
+		operation := operationName(c)
+		code := c.Response().Status
+		if err != nil {
+			code = errorStatus(err)
+		}
+		operationsTotal.WithLabelValues(operation, strconv.Itoa(code)).Inc()
+		format := "none"
+		if len(outputs) > 0 {
+			format = outputFormat(outputs[0])
+		}
+		operationDuration.WithLabelValues(operation, format).Observe(time.Since(start).Seconds())
+		uploaded := uploadedBytes(c)
+		if uploaded > 0 {
+			inputBytes.WithLabelValues(operation).Observe(float64(uploaded))
+		}
+		for _, output := range outputs {
+			info, statErr := os.Stat(output)
+			if statErr != nil || info.Size() == 0 {
+				continue
+			}
+			outputBytes.WithLabelValues(operation, outputFormat(output)).Observe(float64(info.Size()))
+			if uploaded > 0 {
+				compressionRatio.WithLabelValues(operation, outputFormat(output)).Observe(float64(uploaded) / float64(info.Size()))
+			}
+		}
+		return err
+	}
+}
@@ -0,0 +1,94 @@
+package controllers
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+)
+
+// histogramCount returns the number of observations of the histogram series
+func histogramCount(h *prometheus.HistogramVec, labelValues ...string) uint64 {
+	m := &dto.Metric{}
+	h.WithLabelValues(labelValues...).(prometheus.Histogram).Write(m)
+	return m.GetHistogram().GetSampleCount()
+}
+
+func TestInstrument(t *testing.T) {
+	assert := assert.New(t)
+	e := echo.New()
+	output := filepath.Join(t.TempDir(), "output.jpg")
+	os.WriteFile(output, make([]byte, 2000), 0o644)
+
+	body := new(bytes.Buffer)
+	writer := multipart.NewWriter(body)
+	part, _ := writer.CreateFormFile("file", "input.png")
+	part.Write(make([]byte, 5000))
+	writer.Close()
+	req := httptest.NewRequest(http.MethodPost, "/", body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	c.SetPath("/image-instrument-test")
+
+	handler := Instrument(func(c echo.Context) error {
+		c.FormFile("file")
+		return c.String(http.StatusOK, outputURL(c, output, filepath.Dir(output)))
+	})
+	if assert.NoError(handler(c)) {
+		assert.Equal("http://example.com/static/output.jpg", rec.Body.String())
+		assert.Equal(float64(1), testutil.ToFloat64(operationsTotal.WithLabelValues("instrument-test", "200")))
+		assert.Equal(uint64(1), histogramCount(operationDuration, "instrument-test", "jpeg"))
+		assert.Equal(uint64(1), histogramCount(inputBytes, "instrument-test"))
+		assert.Equal(uint64(1), histogramCount(outputBytes, "instrument-test", "jpeg"))
+		assert.Equal(uint64(1), histogramCount(compressionRatio, "instrument-test", "jpeg"))
+	}
+
+	// errors returned by the handlers are counted with their status code
+	c = e.NewContext(httptest.NewRequest(http.MethodPost, "/", nil), httptest.NewRecorder())
+	c.SetPath("/image-instrument-test")
+	Instrument(func(c echo.Context) error {
+		return echo.ErrBadRequest
+	})(c)
+	assert.Equal(float64(1), testutil.ToFloat64(operationsTotal.WithLabelValues("instrument-test", "400")))
+	assert.Equal(uint64(1), histogramCount(operationDuration, "instrument-test", "none"))
+}
+
+func TestMetrics(t *testing.T) {
+	assert := assert.New(t)
+	rejected := testutil.ToFloat64(rejectedUploads.WithLabelValues(rejectMissing))
+	e := echo.New()
+	c := e.NewContext(httptest.NewRequest(http.MethodPost, "/", nil), httptest.NewRecorder())
+	ValidateImageFileUpload(c, inputFormats(), "file")
+	assert.Equal(rejected+1, testutil.ToFloat64(rejectedUploads.WithLabelValues(rejectMissing)))
+
+	// the vectors are only exposed once they have a child
+	operationsTotal.WithLabelValues("metrics-test", "200")
+	operationDuration.WithLabelValues("metrics-test", "none")
+	rec := httptest.NewRecorder()
+	c = e.NewContext(httptest.NewRequest(http.MethodGet, "/", nil), rec)
+	c.SetPath("/metrics")
+	if assert.NoError(Metrics(c)) {
+		assert.Equal(http.StatusOK, rec.Code)
+		assert.True(strings.HasPrefix(rec.Header().Get(echo.HeaderContentType), "text/plain"))
+		for _, line := range []string{
+			"# TYPE image_operations_total counter",
+			"# TYPE image_operation_duration_seconds histogram",
+			"image_rejected_uploads_total{reason=\"missing\"}",
+			"image_worker_queue_depth 0",
+			"image_workers_busy 0",
+		} {
+			assert.Contains(rec.Body.String(), line)
+		}
+	}
+}
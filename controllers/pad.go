@@ -0,0 +1,74 @@
+package controllers
+
+import (
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/vafrcor/go-http-image-manipulation/models"
+	helpers "github.com/vafrcor/go-http-image-manipulation/services"
+)
+
+// padOptions reads the canvas extension form options
+func padOptions(c echo.Context) (helpers.PadOptions, error) {
+	options := helpers.PadOptions{
+		Aspect:  c.FormValue("aspect"),
+		Gravity: strings.ToLower(c.FormValue("gravity")),
+		Fill:    strings.ToLower(c.FormValue("fill")),
+		Color:   strings.ToLower(c.FormValue("color")),
+	}
+	err := formNumbers(c, map[string]*int{
+		"top":    &options.Top,
+		"right":  &options.Right,
+		"bottom": &options.Bottom,
+		"left":   &options.Left,
+	}, nil)
+	return options.WithDefaults(), err
+}
+
+// ImagePad extends the canvas to an aspect ratio (aspect, e.g. 1:1) and / or by fixed borders (top, right,
+// bottom, left), filled with a solid color (possibly transparent), a blurred or a mirrored copy of the image
+func ImagePad(c echo.Context) error {
+	options, err := padOptions(c)
+	if err == nil {
+		err = options.Validate()
+	}
+	if err != nil {
+		return badRequest(c, err)
+	}
+	encode, err := formEncodeOptions(c)
+	if err == nil && helpers.RequiresAlpha(options) {
+		err = checkAlphaEncodeFormat(encode)
+	}
+	if err != nil {
+		return badRequest(c, err)
+	}
+	if encode.Format != "" {
+		if err := checkEncodeOptions(encode); err != nil {
+			return badRequest(c, err)
+		}
+	}
+	data, err := ValidateImageFileUpload(c, inputFormats(), "file")
+	if err != nil {
+		return badRequest(c, err)
+	}
+	// fmt.Printf("DATA: %#v\n", data)
+	if helpers.RequiresAlpha(options) {
+		negotiateAlphaEncodeFormat(c, &encode)
+	} else {
+		negotiateEncodeFormat(c, &encode, filepath.Join(data["upload_path"], data["filename"]))
+	}
+	im := helpers.NewImageManipulation(c.Request().Context())
+	result, err := im.Filter(data["cwd"], data["upload_path"], data["output_path"], data["filename"], options, encode, false)
+	if err != nil {
+		return respondError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, &models.Response{
+		Message: "Ok",
+		Status:  true,
+		Data:    outputURL(c, result.OutputFilePath, data["output_path"]),
+		Meta:    result,
+	})
+}
@@ -0,0 +1,90 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/vafrcor/go-http-image-manipulation/models"
+)
+
+func TestImagePad(t *testing.T) {
+	// Setup
+	e := echo.New()
+	cwd, _ := os.Getwd()
+	rootDir := filepath.Clean(filepath.Join(cwd, ".."))
+	testFilePath := filepath.Join(rootDir, "storages", "test", "sample-test.png")
+	body := new(bytes.Buffer)
+	writer := multipart.NewWriter(body)
+	writer.WriteField("aspect", "1:1")
+	writer.WriteField("fill", "blur")
+	part, _ := writer.CreateFormFile("file", "sample-test.png")
+	testFile, _ := os.Open(testFilePath)
+	defer testFile.Close()
+	io.Copy(part, testFile)
+	writer.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/", body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	c.SetPath("/image-pad")
+
+	if assert.NoError(t, ImagePad(c)) {
+		assert.Equal(t, http.StatusOK, rec.Code)
+		jsonData := []byte(rec.Body.Bytes())
+		var data models.Response
+		err := json.Unmarshal(jsonData, &data)
+		if err == nil {
+			assert.True(t, data.Status)
+			meta := data.Meta.(map[string]interface{})
+			assert.Equal(t, meta["width"], meta["height"])
+		}
+	}
+}
+
+func TestImagePadInvalid(t *testing.T) {
+	cases := map[string]map[string]string{
+		"set either aspect or borders":    {},
+		"invalid aspect":                  {"aspect": "wide"},
+		"invalid top":                     {"top": "ten"},
+		"invalid fill":                    {"aspect": "1:1", "fill": "stretch"},
+		"only used by the color fill":     {"aspect": "1:1", "fill": "mirror", "color": "#000000"},
+		"transparent outputs require the": {"aspect": "1:1", "color": "transparent", "format": "jpeg"},
+	}
+	for message, fields := range cases {
+		// Setup
+		e := echo.New()
+		body := new(bytes.Buffer)
+		writer := multipart.NewWriter(body)
+		for name, value := range fields {
+			writer.WriteField(name, value)
+		}
+		writer.Close()
+
+		req := httptest.NewRequest(http.MethodPost, "/", body)
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.SetPath("/image-pad")
+
+		if assert.NoError(t, ImagePad(c)) {
+			assert.Equal(t, http.StatusBadRequest, rec.Code)
+			jsonData := []byte(rec.Body.Bytes())
+			var data models.Response
+			err := json.Unmarshal(jsonData, &data)
+			if err == nil {
+				assert.True(t, data.Status == false)
+				assert.Contains(t, data.Message, message)
+			}
+		}
+	}
+}
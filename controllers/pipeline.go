@@ -0,0 +1,60 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"path/filepath"
+
+	"github.com/labstack/echo/v4"
+	"github.com/vafrcor/go-http-image-manipulation/models"
+	helpers "github.com/vafrcor/go-http-image-manipulation/services"
+)
+
+// ImagePipeline applies an ordered list of operations (the steps form value, as a JSON array) or a preset on the image
+func ImagePipeline(c echo.Context) error {
+	if preset := c.FormValue("preset"); preset != "" {
+		return imagePreset(c, preset)
+	}
+	var pipeline helpers.Pipeline
+	if err := json.Unmarshal([]byte(c.FormValue("steps")), &pipeline.Steps); err != nil {
+		return badRequest(c, helpers.InvalidOption("steps", "invalid steps (must be a JSON array of {\"op\": ..., \"params\": {...}} objects)"))
+	}
+	if err := pipeline.Validate(); err != nil {
+		return badRequest(c, err)
+	}
+	encode, err := formEncodeOptions(c)
+	if err == nil && pipeline.NeedsAlpha() {
+		err = checkAlphaEncodeFormat(encode)
+	}
+	if err != nil {
+		return badRequest(c, err)
+	}
+	if encode.Format != "" {
+		if err := checkEncodeOptions(encode); err != nil {
+			return badRequest(c, err)
+		}
+	}
+	data, err := ValidateImageFileUpload(c, inputFormats(), "file")
+	if err != nil {
+		return badRequest(c, err)
+	}
+	// fmt.Printf("DATA: %#v\n", data)
+	if pipeline.NeedsAlpha() {
+		negotiateAlphaEncodeFormat(c, &encode)
+	} else {
+		negotiateEncodeFormat(c, &encode, filepath.Join(data["upload_path"], data["filename"]))
+	}
+	pipeline.Encode = encode
+	im := helpers.NewImageManipulation(c.Request().Context())
+	result, err := im.RunPipeline(data["cwd"], data["upload_path"], data["output_path"], data["filename"], pipeline, false)
+	if err != nil {
+		return respondError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, &models.Response{
+		Message: "Ok",
+		Status:  true,
+		Data:    outputURL(c, result.OutputFilePath, data["output_path"]),
+		Meta:    result,
+	})
+}
@@ -0,0 +1,99 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/vafrcor/go-http-image-manipulation/models"
+)
+
+func TestImagePipeline(t *testing.T) {
+	// Setup
+	e := echo.New()
+	cwd, _ := os.Getwd()
+	rootDir := filepath.Clean(filepath.Join(cwd, ".."))
+	testFilePath := filepath.Join(rootDir, "storages", "test", "sample-test.png")
+	body := new(bytes.Buffer)
+	writer := multipart.NewWriter(body)
+	writer.WriteField("steps", `[{"op": "resize", "params": {"width": 320, "height": 320}}, {"op": "watermark", "params": {"text": "(c) Shop"}}]`)
+	writer.WriteField("format", "jpeg")
+	part, _ := writer.CreateFormFile("file", "sample-test.png")
+	testFile, _ := os.Open(testFilePath)
+	defer testFile.Close()
+	io.Copy(part, testFile)
+	writer.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/", body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	c.SetPath("/image-pipeline")
+
+	if assert.NoError(t, ImagePipeline(c)) {
+		assert.Equal(t, http.StatusOK, rec.Code)
+		jsonData := []byte(rec.Body.Bytes())
+		var data models.Response
+		err := json.Unmarshal(jsonData, &data)
+		if err == nil {
+			assert.True(t, data.Status)
+			meta := data.Meta.(map[string]interface{})
+			assert.Equal(t, "jpeg", meta["format"])
+			assert.True(t, meta["width"].(float64) <= 320)
+		}
+	}
+}
+
+func TestImagePipelineInvalidStep(t *testing.T) {
+	// Setup
+	e := echo.New()
+	body := new(bytes.Buffer)
+	writer := multipart.NewWriter(body)
+	writer.WriteField("steps", `[{"op": "rotate", "params": {"angle": 90}}]`)
+	writer.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/", body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	c.SetPath("/image-pipeline")
+
+	if assert.NoError(t, ImagePipeline(c)) {
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		jsonData := []byte(rec.Body.Bytes())
+		var data models.Response
+		err := json.Unmarshal(jsonData, &data)
+		if err == nil {
+			assert.True(t, data.Status == false)
+			assert.True(t, strings.HasPrefix(data.Message, "invalid pipeline: unknown operation \"rotate\""))
+		}
+	}
+}
+
+func TestImagePipelineInvalidSteps(t *testing.T) {
+	// Setup
+	e := echo.New()
+	body := new(bytes.Buffer)
+	writer := multipart.NewWriter(body)
+	writer.WriteField("steps", `resize`)
+	writer.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/", body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	c.SetPath("/image-pipeline")
+
+	if assert.NoError(t, ImagePipeline(c)) {
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	}
+}
@@ -0,0 +1,61 @@
+package controllers
+
+import (
+	"net/http"
+	"path/filepath"
+
+	"github.com/labstack/echo/v4"
+	"github.com/vafrcor/go-http-image-manipulation/models"
+	helpers "github.com/vafrcor/go-http-image-manipulation/services"
+)
+
+// ListPresets returns the presets defined in the configuration file
+func ListPresets(c echo.Context) error {
+	presets, err := helpers.ListPresets(rootPath())
+	if err != nil {
+		// the presets previously loaded keep being served
+		c.Logger().Error(err)
+	}
+	return c.JSON(http.StatusOK, &models.Response{
+		Message: "Ok",
+		Status:  true,
+		Data:    presets,
+	})
+}
+
+// imagePreset applies the named preset (a full pipeline, with its encode options) on the uploaded image. The
+// other form options are ignored.
+func imagePreset(c echo.Context, name string) error {
+	preset, err := helpers.GetPreset(rootPath(), name)
+	if err != nil {
+		return respondError(c, err)
+	}
+	pipeline := preset.Pipeline
+	if pipeline.Encode.Format != "" {
+		if err := checkEncodeOptions(pipeline.Encode); err != nil {
+			return badRequest(c, err)
+		}
+	}
+	data, err := ValidateImageFileUpload(c, inputFormats(), "file")
+	if err != nil {
+		return badRequest(c, err)
+	}
+	// fmt.Printf("DATA: %#v\n", data)
+	if pipeline.NeedsAlpha() {
+		negotiateAlphaEncodeFormat(c, &pipeline.Encode)
+	} else {
+		negotiateEncodeFormat(c, &pipeline.Encode, filepath.Join(data["upload_path"], data["filename"]))
+	}
+	im := helpers.NewImageManipulation(c.Request().Context())
+	result, err := im.RunPipeline(data["cwd"], data["upload_path"], data["output_path"], data["filename"], pipeline, false)
+	if err != nil {
+		return respondError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, &models.Response{
+		Message: "Ok",
+		Status:  true,
+		Data:    outputURL(c, result.OutputFilePath, data["output_path"]),
+		Meta:    result,
+	})
+}
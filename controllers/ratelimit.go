@@ -0,0 +1,136 @@
+package controllers
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/vafrcor/go-http-image-manipulation/config"
+	helpers "github.com/vafrcor/go-http-image-manipulation/services"
+	"golang.org/x/time/rate"
+)
+
+// reasons of the rate limited requests
+const (
+	limitRate        = "rate"
+	limitConcurrency = "concurrency"
+)
+
+// sweepInterval spaces the removals of the idle clients
+const sweepInterval = time.Minute
+
+// clientLimit is the state of a client on a route, its token bucket (nil without rate) and its operations
+// running or waiting for a worker, or the operations of the client over every route
+type clientLimit struct {
+	tokens *rate.Limiter
+	active int
+}
+
+// idle tells whether the client may be forgotten, its bucket being full and no operation running
+func (cl *clientLimit) idle(now time.Time) bool {
+	return cl.active == 0 && (cl.tokens == nil || cl.tokens.TokensAt(now) >= float64(cl.tokens.Burst()))
+}
+
+// clientLimits holds the state of the clients of every route
+type clientLimits struct {
+	mu      sync.Mutex
+	clients map[string]*clientLimit
+	swept   time.Time
+}
+
+// limiters is replaced by Configure, along with the limits
+var limiters = newClientLimits()
+
+func newClientLimits() *clientLimits {
+	return &clientLimits{clients: map[string]*clientLimit{}}
+}
+
+// client returns the state stored under the key, created with the token bucket of the limit
+func (cl *clientLimits) client(key string, limit config.RateLimit) *clientLimit {
+	client, ok := cl.clients[key]
+	if !ok {
+		client = &clientLimit{}
+		if limit.Rate > 0 {
+			client.tokens = rate.NewLimiter(rate.Limit(limit.Rate), limit.Burst)
+		}
+		cl.clients[key] = client
+	}
+	return client
+}
+
+// acquire takes a token of the client on the route and a concurrency slot, bounded by maxActive over every
+// route and by limit.Concurrency on the route. It returns the release of the slot, or the reason of the
+// rejection along with the wait before retrying.
+func (cl *clientLimits) acquire(client string, operation string, limit config.RateLimit, maxActive int, now time.Time) (func(), string, time.Duration) {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+	if now.Sub(cl.swept) >= sweepInterval {
+		for k, client := range cl.clients {
+			if client.idle(now) {
+				delete(cl.clients, k)
+			}
+		}
+		cl.swept = now
+	}
+	route, total := cl.client(operation+" "+client, limit), cl.client(client, config.RateLimit{})
+	if (maxActive > 0 && total.active >= maxActive) || (limit.Concurrency > 0 && route.active >= limit.Concurrency) {
+		// the end of the running operations is unknown
+		return nil, limitConcurrency, time.Second
+	}
+	if route.tokens != nil {
+		reservation := route.tokens.ReserveN(now, 1)
+		if delay := reservation.DelayFrom(now); delay > 0 {
+			reservation.CancelAt(now)
+			return nil, limitRate, delay
+		}
+	}
+	route.active++
+	total.active++
+	return func() {
+		cl.mu.Lock()
+		defer cl.mu.Unlock()
+		route.active--
+		total.active--
+	}, "", 0
+}
+
+// clientID names the client of the request after its API key, or its IP without key
+func clientID(c echo.Context) string {
+	if key, ok := c.Get(apiKeyContextKey).(helpers.APIKey); ok {
+		return "key:" + key.ID
+	}
+	return "ip:" + c.RealIP()
+}
+
+// RateLimit bounds the requests of each client on the route, with a token bucket, and the number of its
+// operations running or waiting for a worker: rate_limits.default.concurrency over every route, and the
+// concurrency of the route limits (if any) on the route. The rejected requests are answered with 429 and a
+// Retry-After header. It must follow Authenticate, the clients with an API key being limited per key.
+func RateLimit(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		operation := operationName(c)
+		limit, maxActive := settings.RateLimits.Route(operation), settings.RateLimits.Default.Concurrency
+		if _, ok := settings.RateLimits.Routes[operation]; !ok {
+			// the default concurrency is counted over every route
+			limit.Concurrency = 0
+		}
+		if limit.Rate <= 0 && limit.Concurrency <= 0 && maxActive <= 0 {
+			return next(c)
+		}
+		release, reason, retryAfter := limiters.acquire(clientID(c), operation, limit, maxActive, time.Now())
+		if release == nil {
+			rateLimited.WithLabelValues(operation, reason).Inc()
+			c.Response().Header().Set(echo.HeaderRetryAfter, strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+			message := "rate limit exceeded, retry later"
+			if reason == limitConcurrency {
+				message = "too many concurrent operations, retry once one completes"
+			}
+			return respondError(c, echo.NewHTTPError(http.StatusTooManyRequests, message))
+		}
+		defer release()
+		return next(c)
+	}
+}
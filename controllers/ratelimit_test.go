@@ -0,0 +1,129 @@
+package controllers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/vafrcor/go-http-image-manipulation/config"
+	helpers "github.com/vafrcor/go-http-image-manipulation/services"
+)
+
+func TestRateLimit(t *testing.T) {
+	cfg := config.Default()
+	cfg.RateLimits.Routes = map[string]config.RateLimit{"resize": {Rate: 0.01, Burst: 2}}
+	Configure(cfg)
+	defer Configure(config.Default())
+
+	e := echo.New()
+	e.IPExtractor = echo.ExtractIPDirect()
+	handler := RateLimit(func(c echo.Context) error {
+		return c.NoContent(http.StatusOK)
+	})
+	testCases := []struct {
+		name       string
+		path       string
+		ip         string
+		key        string
+		status     int
+		retryAfter string
+	}{
+		{"first", "/image-resize", "192.0.2.1", "", http.StatusOK, ""},
+		{"burst", "/image-resize", "192.0.2.1", "", http.StatusOK, ""},
+		{"limited", "/image-resize", "192.0.2.1", "", http.StatusTooManyRequests, "100"},
+		{"other IP", "/image-resize", "192.0.2.2", "", http.StatusOK, ""},
+		{"API key", "/image-resize", "192.0.2.1", "key_a", http.StatusOK, ""},
+		{"other route", "/image-crop", "192.0.2.1", "", http.StatusOK, ""},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/", nil)
+			req.RemoteAddr = tc.ip + ":1234"
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.SetPath(tc.path)
+			if tc.key != "" {
+				c.Set(apiKeyContextKey, helpers.APIKey{ID: tc.key})
+			}
+			if assert.NoError(t, handler(c)) {
+				assert.Equal(t, tc.status, rec.Code)
+				assert.Equal(t, tc.retryAfter, rec.Header().Get(echo.HeaderRetryAfter))
+			}
+		})
+	}
+}
+
+func TestRateLimitConcurrency(t *testing.T) {
+	assert := assert.New(t)
+	cfg := config.Default()
+	cfg.RateLimits.Default = config.RateLimit{Concurrency: 1}
+	Configure(cfg)
+	defer Configure(config.Default())
+
+	e := echo.New()
+	started, finish := make(chan struct{}), make(chan struct{})
+	handler := RateLimit(func(c echo.Context) error {
+		if c.QueryParam("wait") != "" {
+			close(started)
+			<-finish
+		}
+		return c.NoContent(http.StatusOK)
+	})
+	request := func(target string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		c := e.NewContext(httptest.NewRequest(http.MethodPost, target, nil), rec)
+		c.SetPath("/image-resize")
+		assert.NoError(handler(c))
+		return rec
+	}
+
+	done := make(chan *httptest.ResponseRecorder)
+	go func() { done <- request("/?wait=1") }()
+	<-started
+	rec := request("/")
+	assert.Equal(http.StatusTooManyRequests, rec.Code, "Second operation should be rejected")
+	assert.Equal("1", rec.Header().Get(echo.HeaderRetryAfter))
+	close(finish)
+	assert.Equal(http.StatusOK, (<-done).Code)
+	assert.Equal(http.StatusOK, request("/").Code, "Slot should be released once the operation completes")
+}
+
+func TestClientLimitsConcurrencyAcrossRoutes(t *testing.T) {
+	assert := assert.New(t)
+	limits := newClientLimits()
+	now := time.Now()
+	release, _, _ := limits.acquire("ip:192.0.2.1", "resize", config.RateLimit{}, 2, now)
+	limits.acquire("ip:192.0.2.1", "crop", config.RateLimit{}, 2, now)
+	_, reason, _ := limits.acquire("ip:192.0.2.1", "pad", config.RateLimit{}, 2, now)
+	assert.Equal(limitConcurrency, reason, "Client concurrency should be counted over every route")
+	_, reason2, _ := limits.acquire("ip:192.0.2.2", "pad", config.RateLimit{}, 2, now)
+	assert.Equal("", reason2, "Other clients should not be limited")
+	release()
+	_, reason3, _ := limits.acquire("ip:192.0.2.1", "pad", config.RateLimit{}, 2, now)
+	assert.Equal("", reason3, "Released slot should be available")
+
+	// the concurrency of the route limits applies on top
+	limits.acquire("ip:192.0.2.3", "resize", config.RateLimit{Concurrency: 1}, 2, now)
+	_, reason4, _ := limits.acquire("ip:192.0.2.3", "resize", config.RateLimit{Concurrency: 1}, 2, now)
+	assert.Equal(limitConcurrency, reason4, "Route concurrency should be reached")
+}
+
+func TestClientLimitsSweep(t *testing.T) {
+	assert := assert.New(t)
+	limits := newClientLimits()
+	limit := config.RateLimit{Rate: 1, Burst: 1}
+	now := time.Now()
+	release, _, _ := limits.acquire("ip:192.0.2.1", "resize", limit, 0, now)
+	release()
+	_, reason, retryAfter := limits.acquire("ip:192.0.2.1", "resize", limit, 0, now)
+	assert.Equal(limitRate, reason, "Bucket should be empty")
+	assert.Equal(time.Second, retryAfter)
+
+	// the clients whose bucket is full again are forgotten
+	limits.acquire("ip:192.0.2.2", "resize", limit, 0, now.Add(sweepInterval))
+	assert.Len(limits.clients, 2, "Idle client should be removed")
+	assert.NotContains(limits.clients, "ip:192.0.2.1", "Idle client should be removed")
+}
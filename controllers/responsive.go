@@ -0,0 +1,96 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/vafrcor/go-http-image-manipulation/models"
+	helpers "github.com/vafrcor/go-http-image-manipulation/services"
+)
+
+// formList splits a comma separated form value (empty items are ignored)
+func formList(c echo.Context, name string) []string {
+	r := []string{}
+	for _, item := range strings.Split(c.FormValue(name), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			r = append(r, item)
+		}
+	}
+	return r
+}
+
+// responsiveOptions reads the responsive image set form options
+func responsiveOptions(c echo.Context) (helpers.ResponsiveOptions, error) {
+	options := helpers.ResponsiveOptions{
+		Sizes: c.FormValue("sizes"),
+		Alt:   c.FormValue("alt"),
+	}
+	for _, width := range formList(c, "widths") {
+		widthInt, err := strconv.Atoi(width)
+		if err != nil {
+			return options, helpers.InvalidOption("widths", "invalid widths (must be a comma separated list of numbers)")
+		}
+		options.Widths = append(options.Widths, widthInt)
+	}
+	for _, density := range formList(c, "dpr") {
+		densityFloat, err := strconv.ParseFloat(strings.TrimSuffix(density, "x"), 64)
+		if err != nil {
+			return options, helpers.InvalidOption("dpr", "invalid dpr (must be a comma separated list of numbers)")
+		}
+		options.Densities = append(options.Densities, densityFloat)
+	}
+	for _, format := range formList(c, "formats") {
+		options.Formats = append(options.Formats, strings.ToLower(format))
+	}
+	if quality := c.FormValue("quality"); quality != "" {
+		qualityInt, err := strconv.Atoi(quality)
+		if err != nil || qualityInt < 1 || qualityInt > 100 {
+			return options, helpers.InvalidOption("quality", "invalid quality (must between 1 - 100)")
+		}
+		options.Quality = qualityInt
+	}
+	return options.WithDefaults(), nil
+}
+
+// ImageResponsive renders the image at every breakpoint width (widths) and device pixel ratio (dpr), in every
+// format, and returns the manifest of the renditions with their srcset and <picture> markup
+func ImageResponsive(c echo.Context) error {
+	options, err := responsiveOptions(c)
+	if err == nil {
+		err = options.Validate()
+	}
+	if errors.Is(err, helpers.ErrUnsupportedOutputFormat) {
+		err = fmt.Errorf("%w (available: %s)", err, strings.Join(helpers.AvailableEncoders(), ","))
+	}
+	if err != nil {
+		return badRequest(c, err)
+	}
+	sharpen, err := formSharpenOptions(c)
+	if err != nil {
+		return badRequest(c, err)
+	}
+	data, err := ValidateImageFileUpload(c, inputFormats(), "file")
+	if err != nil {
+		return badRequest(c, err)
+	}
+	// fmt.Printf("DATA: %#v\n", data)
+	baseURL := fmt.Sprintf("%s://%s/static", helpers.GetEchoRequestScheme(c), c.Request().Host)
+	im := helpers.NewImageManipulation(c.Request().Context())
+	result, err := im.Responsive(data["cwd"], data["upload_path"], data["output_path"], data["filename"], options, sharpen, baseURL, false)
+	if err != nil {
+		return respondError(c, err)
+	}
+	for _, img := range result.Images {
+		recordOutput(c, img.OutputFilePath)
+	}
+
+	return c.JSON(http.StatusOK, &models.Response{
+		Message: "Ok",
+		Status:  true,
+		Data:    result,
+	})
+}
@@ -0,0 +1,93 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/vafrcor/go-http-image-manipulation/models"
+)
+
+func TestImageResponsive(t *testing.T) {
+	// Setup
+	e := echo.New()
+	cwd, _ := os.Getwd()
+	rootDir := filepath.Clean(filepath.Join(cwd, ".."))
+	testFilePath := filepath.Join(rootDir, "storages", "test", "sample-test.png")
+	body := new(bytes.Buffer)
+	writer := multipart.NewWriter(body)
+	writer.WriteField("widths", "64,128")
+	writer.WriteField("dpr", "1,2")
+	writer.WriteField("formats", "jpeg")
+	part, _ := writer.CreateFormFile("file", "sample-test.png")
+	testFile, _ := os.Open(testFilePath)
+	defer testFile.Close()
+	io.Copy(part, testFile)
+	writer.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/", body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	c.SetPath("/image-responsive")
+
+	if assert.NoError(t, ImageResponsive(c)) {
+		assert.Equal(t, http.StatusOK, rec.Code)
+		jsonData := []byte(rec.Body.Bytes())
+		var data models.Response
+		err := json.Unmarshal(jsonData, &data)
+		if err == nil {
+			assert.True(t, data.Status)
+			manifest := data.Data.(map[string]interface{})
+			assert.Equal(t, 3, len(manifest["images"].([]interface{})))
+			assert.Contains(t, manifest["picture"], "<img src=")
+		}
+	}
+}
+
+func TestImageResponsiveInvalid(t *testing.T) {
+	cases := map[string]map[string]string{
+		"invalid widths (set":             {},
+		"invalid widths (must be a comma": {"widths": "320,large"},
+		"invalid dpr (must between":       {"widths": "320", "dpr": "1x,8x"},
+		"unsupported output format":       {"widths": "320", "formats": "tiff"},
+		"invalid formats (every format":   {"widths": "320", "formats": "jpeg,png,jpeg"},
+		"invalid quality":                 {"widths": "320", "quality": "0"},
+		"invalid sharpen":                 {"widths": "320", "sharpen": "yes"},
+	}
+	for message, fields := range cases {
+		// Setup
+		e := echo.New()
+		body := new(bytes.Buffer)
+		writer := multipart.NewWriter(body)
+		for name, value := range fields {
+			writer.WriteField(name, value)
+		}
+		writer.Close()
+
+		req := httptest.NewRequest(http.MethodPost, "/", body)
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.SetPath("/image-responsive")
+
+		if assert.NoError(t, ImageResponsive(c)) {
+			assert.NotEqual(t, http.StatusOK, rec.Code)
+			jsonData := []byte(rec.Body.Bytes())
+			var data models.Response
+			err := json.Unmarshal(jsonData, &data)
+			if err == nil {
+				assert.True(t, data.Status == false)
+				assert.Contains(t, data.Message, message)
+			}
+		}
+	}
+}
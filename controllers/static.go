@@ -0,0 +1,75 @@
+package controllers
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	helpers "github.com/vafrcor/go-http-image-manipulation/services"
+)
+
+// variantName returns the path of the converted variant of the file, keyed by every encode option so that
+// variants encoded differently (e.g. after a default quality change) are not mixed up
+func variantName(name string, encode helpers.EncodeOptions) string {
+	options, _ := json.Marshal(encode)
+	sum := sha256.Sum256(options)
+	return fmt.Sprintf("%s.%x.%s", name, sum[:6], encode.Format)
+}
+
+// StaticImage serves files from the root directory. Images can be requested in another format
+// through the format query parameter (format=auto negotiates it from the Accept header),
+// converted variants are cached next to the original file. The conversions run through the convert
+// middlewares (rate limit, worker pool...), the files and the cached variants are served directly.
+func StaticImage(root string, convert ...echo.MiddlewareFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		p, err := url.PathUnescape(c.Param("*"))
+		if err != nil {
+			return err
+		}
+		name := filepath.Join(root, filepath.Clean("/"+p))
+		if helpers.IsPartialOutput(name) {
+			return echo.ErrNotFound
+		}
+		format := strings.ToLower(c.QueryParam("format"))
+		ext := strings.TrimPrefix(strings.ToLower(filepath.Ext(name)), ".")
+		if format == "" || !slices.Contains([]string{"png", "jpg", "jpeg", "bmp"}, ext) {
+			return c.File(name)
+		}
+		if _, err := os.Stat(name); err != nil {
+			return echo.ErrNotFound
+		}
+
+		encode := helpers.EncodeOptions{Format: format, Quality: helpers.DefaultQuality}
+		if err := checkEncodeOptions(encode); err != nil {
+			return badRequest(c, err)
+		}
+		negotiateEncodeFormat(c, &encode, name)
+		if encode.Format == ext || (encode.Format == helpers.FormatJpeg && ext == "jpg") {
+			return c.File(name)
+		}
+		variant := variantName(name, encode)
+		if _, err := os.Stat(variant); err == nil {
+			return c.File(variant)
+		}
+		h := func(c echo.Context) error {
+			// converted by another request while waiting for a worker
+			if _, err := os.Stat(variant); err != nil {
+				if err := helpers.ConvertImage(name, variant, encode); err != nil {
+					return respondError(c, err)
+				}
+				recordOutput(c, variant)
+			}
+			return c.File(variant)
+		}
+		for i := len(convert) - 1; i >= 0; i-- {
+			h = convert[i](h)
+		}
+		return h(c)
+	}
+}
@@ -0,0 +1,142 @@
+package controllers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	helpers "github.com/vafrcor/go-http-image-manipulation/services"
+)
+
+func TestStaticImage(t *testing.T) {
+	// Setup
+	e := echo.New()
+	cwd, _ := os.Getwd()
+	rootDir := filepath.Clean(filepath.Join(cwd, "..", "storages", "test"))
+
+	req := httptest.NewRequest(http.MethodGet, "/static/sample-test.png", nil)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	c.SetPath("/static/*")
+	c.SetParamNames("*")
+	c.SetParamValues("sample-test.png")
+
+	if assert.NoError(t, StaticImage(rootDir)(c)) {
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Empty(t, rec.Header().Get(echo.HeaderVary))
+	}
+}
+
+func TestStaticImageFormatAuto(t *testing.T) {
+	// Setup
+	e := echo.New()
+	cwd, _ := os.Getwd()
+	rootDir := filepath.Clean(filepath.Join(cwd, "..", "storages", "test"))
+
+	req := httptest.NewRequest(http.MethodGet, "/static/sample-test.png?format=auto", nil)
+	req.Header.Set(echo.HeaderAccept, "image/avif,image/webp,*/*")
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	c.SetPath("/static/*")
+	c.SetParamNames("*")
+	c.SetParamValues("sample-test.png")
+
+	if assert.NoError(t, StaticImage(rootDir)(c)) {
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, echo.HeaderAccept, rec.Header().Get(echo.HeaderVary))
+	}
+	// remove converted variants
+	variants, _ := filepath.Glob(filepath.Join(rootDir, "sample-test.png.*"))
+	for _, variant := range variants {
+		os.Remove(variant)
+	}
+}
+
+func TestVariantName(t *testing.T) {
+	assert := assert.New(t)
+	webp := helpers.EncodeOptions{Format: helpers.FormatWebp, Quality: 80}
+	name := variantName("sample.png", webp)
+	assert.True(strings.HasPrefix(name, "sample.png.") && strings.HasSuffix(name, ".webp"), "Variant should be named after the file and the format")
+	assert.Equal(name, variantName("sample.png", webp), "Same options should share the variant")
+	for _, encode := range []helpers.EncodeOptions{
+		{Format: helpers.FormatWebp, Quality: 60},
+		{Format: helpers.FormatWebp, Quality: 80, Lossless: true},
+		{Format: helpers.FormatAvif, Quality: 80},
+	} {
+		assert.NotEqual(name, variantName("sample.png", encode), "Other options should have their own variant")
+	}
+}
+
+func TestStaticImageNotFound(t *testing.T) {
+	// Setup
+	e := echo.New()
+	cwd, _ := os.Getwd()
+	rootDir := filepath.Clean(filepath.Join(cwd, "..", "storages", "test"))
+
+	req := httptest.NewRequest(http.MethodGet, "/static/missing.png?format=auto", nil)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	c.SetPath("/static/*")
+	c.SetParamNames("*")
+	c.SetParamValues("missing.png")
+
+	err := StaticImage(rootDir)(c)
+	assert.Equal(t, echo.ErrNotFound, err)
+}
+
+func TestStaticImagePartialOutput(t *testing.T) {
+	// Setup
+	e := echo.New()
+	rootDir := t.TempDir()
+	os.WriteFile(filepath.Join(rootDir, ".partial-123-output.png"), []byte("trunc"), 0o644)
+
+	req := httptest.NewRequest(http.MethodGet, "/static/.partial-123-output.png", nil)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	c.SetPath("/static/*")
+	c.SetParamNames("*")
+	c.SetParamValues(".partial-123-output.png")
+
+	err := StaticImage(rootDir)(c)
+	assert.Equal(t, echo.ErrNotFound, err)
+}
+
+func TestStaticImageConvertMiddlewares(t *testing.T) {
+	// Setup
+	assert := assert.New(t)
+	e := echo.New()
+	rootDir := t.TempDir()
+	os.WriteFile(filepath.Join(rootDir, "sample.png"), []byte("png"), 0o644)
+	calls := 0
+	limit := func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			calls++
+			return c.JSON(http.StatusTooManyRequests, nil)
+		}
+	}
+	serve := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/static/sample.png?format=jpeg", nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.SetPath("/static/*")
+		c.SetParamNames("*")
+		c.SetParamValues("sample.png")
+		assert.NoError(StaticImage(rootDir, limit)(c))
+		return rec
+	}
+
+	rec := serve()
+	assert.Equal(http.StatusTooManyRequests, rec.Code, "Error 1 should run the conversion through the middlewares")
+	assert.Equal(1, calls)
+
+	variant := variantName(filepath.Join(rootDir, "sample.png"), helpers.EncodeOptions{Format: helpers.FormatJpeg, Quality: helpers.DefaultQuality})
+	os.WriteFile(variant, []byte("jpg"), 0o644)
+	rec = serve()
+	assert.Equal(http.StatusOK, rec.Code, "Error 2 should serve the cached variant directly")
+	assert.Equal(1, calls)
+}
@@ -0,0 +1,6 @@
+package controllers
+
+import "go.opentelemetry.io/otel"
+
+// tracer creates the spans of the upload stages (the processing stages are traced by the services)
+var tracer = otel.Tracer("github.com/vafrcor/go-http-image-manipulation/controllers")
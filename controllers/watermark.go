@@ -0,0 +1,89 @@
+package controllers
+
+import (
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/vafrcor/go-http-image-manipulation/models"
+	helpers "github.com/vafrcor/go-http-image-manipulation/services"
+)
+
+// watermarkOptions reads the watermark form options
+func watermarkOptions(c echo.Context) (helpers.WatermarkOptions, error) {
+	options := helpers.WatermarkOptions{
+		Text:    c.FormValue("text"),
+		Font:    strings.ToLower(c.FormValue("font")),
+		Color:   c.FormValue("color"),
+		Logo:    c.FormValue("logo"),
+		Gravity: strings.ToLower(c.FormValue("gravity")),
+	}
+	err := formNumbers(c, map[string]*int{
+		"font_size":    &options.FontSize,
+		"offset_x":     &options.OffsetX,
+		"offset_y":     &options.OffsetY,
+		"tile_spacing": &options.TileSpacing,
+	}, map[string]*float64{
+		"scale":    &options.Scale,
+		"opacity":  &options.Opacity,
+		"rotation": &options.Rotation,
+	})
+	if err != nil {
+		return options, err
+	}
+	options.Tile, err = formBool(c, "tile")
+	return options, err
+}
+
+// ImageWatermark overlays a text, a preconfigured logo (logo) or an uploaded logo (logo_file) on the image
+func ImageWatermark(c echo.Context) error {
+	options, err := watermarkOptions(c)
+	if err != nil {
+		return badRequest(c, err)
+	}
+	logoFile, _ := c.FormFile("logo_file")
+	if logoFile != nil {
+		// replaced by the stored logo path once uploaded
+		options.LogoPath = logoFile.Filename
+	}
+	options = options.WithDefaults()
+	if err := options.Validate(); err != nil {
+		return badRequest(c, err)
+	}
+	encode, err := formEncodeOptions(c)
+	if err != nil {
+		return badRequest(c, err)
+	}
+	if encode.Format == "" {
+		encode.Format = helpers.FormatJpeg
+	}
+	if err := checkEncodeOptions(encode); err != nil {
+		return badRequest(c, err)
+	}
+	allowedFormat := inputFormats()
+	data, err := ValidateImageFileUpload(c, allowedFormat, "file")
+	if err != nil {
+		return badRequest(c, err)
+	}
+	if logoFile != nil {
+		options.LogoPath = filepath.Join(data["upload_path"], "logo-"+filepath.Base(logoFile.Filename))
+		if err := saveImageUpload(c.Request().Context(), logoFile, "logo_file", options.LogoPath, allowedFormat); err != nil {
+			return badRequest(c, err)
+		}
+	}
+	// fmt.Printf("DATA: %#v\n", data)
+	negotiateEncodeFormat(c, &encode, filepath.Join(data["upload_path"], data["filename"]))
+	im := helpers.NewImageManipulation(c.Request().Context())
+	result, err := im.Watermark(data["cwd"], data["upload_path"], data["output_path"], data["filename"], options, encode, false)
+	if err != nil {
+		return respondError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, &models.Response{
+		Message: "Ok",
+		Status:  true,
+		Data:    outputURL(c, result.OutputFilePath, data["output_path"]),
+		Meta:    result,
+	})
+}
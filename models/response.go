@@ -4,4 +4,18 @@ type Response struct {
 	Message string      `json:"message"`
 	Status  bool        `json:"status"`
 	Data    interface{} `json:"data"`
+	Meta    interface{} `json:"meta,omitempty"`
+	Error   *Error      `json:"error,omitempty"`
+}
+
+// Error describes a failed request: Code is stable and machine-readable, Details name the invalid fields
+type Error struct {
+	Code      string       `json:"code"`
+	RequestID string       `json:"request_id,omitempty"`
+	Details   []FieldError `json:"details,omitempty"`
+}
+
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
 }
@@ -1,14 +1,27 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"html/template"
 	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 
 	"net/http"
+	"strconv"
 
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
+	"github.com/vafrcor/go-http-image-manipulation/config"
 	"github.com/vafrcor/go-http-image-manipulation/controllers"
+	"github.com/vafrcor/go-http-image-manipulation/services"
+	"github.com/vafrcor/go-http-image-manipulation/tracing"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/labstack/echo/otelecho"
+	"gocv.io/x/gocv"
 )
 
 type Template struct {
@@ -19,25 +32,151 @@ func (t *Template) Render(w io.Writer, name string, data interface{}, c echo.Con
 	return t.templates.ExecuteTemplate(w, name, data)
 }
 
+// configure applies the configuration to the services and the handlers
+func configure(cfg *config.Config) {
+	services.DefaultQuality = cfg.Images.DefaultQuality
+	services.RestrictEncoders(cfg.Images.OutputFormats)
+	services.FaceCascadePath = cfg.Storage.FaceCascade
+	services.WatermarkDirectory = cfg.Storage.Watermarks
+	services.LutDirectory = cfg.Storage.Luts
+	services.PresetsPath = cfg.Storage.Presets
+	services.MaxPixels = cfg.Limits.MaxPixels
+	if cfg.Workers.OpenCVThreads > 0 {
+		gocv.SetNumThreads(cfg.Workers.OpenCVThreads)
+	}
+	controllers.Configure(cfg)
+}
+
 func main() {
 	// Initial setup
 	e := echo.New()
-	e.Use(middleware.Logger())
+	cfg, err := config.Load()
+	if err != nil {
+		e.Logger.Fatal(err)
+	}
+	configure(cfg)
+	shutdownTracing, err := tracing.Setup(cfg.Tracing)
+	if err != nil {
+		e.Logger.Fatal(err)
+	}
+	keys, err := services.OpenKeyStore(cfg.Path(cfg.Auth.KeysFile))
+	if err != nil {
+		e.Logger.Fatal(err)
+	}
+	controllers.UseKeys(keys)
+	go keys.FlushEvery(services.UsageFlushInterval, func(err error) {
+		e.Logger.Printf("failed to save the API keys usage: %s", err.Error())
+	})
+	// outputs left half-written by a killed process
+	if n, err := services.CleanPartialOutputs(cfg.Path(cfg.Storage.Public)); err == nil && n > 0 {
+		e.Logger.Printf("removed %d partial outputs", n)
+	}
+	// the client IP identifies the clients without API key, behind a proxy it is the one it forwards
+	if cfg.Server.TrustProxy {
+		e.IPExtractor = echo.ExtractIPFromXFFHeader()
+	} else {
+		e.IPExtractor = echo.ExtractIPDirect()
+	}
+	// the errors are answered with a stable code and the request ID
+	e.HTTPErrorHandler = controllers.ErrorHandler
+	e.Use(middleware.RequestID())
+	// the API keys sent in the query are redacted from the logged URI
+	e.Use(middleware.LoggerWithConfig(middleware.LoggerConfig{
+		Format:        strings.Replace(middleware.DefaultLoggerConfig.Format, "${uri}", "${custom}", 1),
+		CustomTagFunc: controllers.LogURI,
+	}))
 	e.Use(middleware.Recover())
-	e.Static("/static", "storages/public")
+	// the request spans are the parents of the spans of the upload and processing stages
+	e.Use(otelecho.Middleware(cfg.Tracing.ServiceName, otelecho.WithSkipper(func(c echo.Context) bool {
+		return cfg.Tracing.Exporter == config.TracingNone
+	})))
+	// the requests carry a single image, but the ones of /image-animate whose frames are limited one by one
+	e.Use(middleware.BodyLimitWithConfig(middleware.BodyLimitConfig{
+		Limit: strconv.FormatInt(cfg.Limits.MaxUploadBytes, 10),
+		Skipper: func(c echo.Context) bool {
+			return c.Path() == "/image-animate"
+		},
+	}))
+	// the format conversions of the static files are limited per client and run on the worker pool, the files
+	// and the cached variants are served directly
+	e.GET("/static/*", controllers.StaticImage(cfg.Path(cfg.Storage.Public), controllers.RateLimit, controllers.Worker, controllers.Instrument))
 	t := &Template{
-		templates: template.Must(template.ParseGlob("views/*.html")),
+		templates: template.Must(template.ParseGlob(cfg.Server.Views)),
 	}
 	e.Renderer = t
 
+	// Probe available output encoders
+	e.Logger.Printf("available output encoders: %s", strings.Join(services.AvailableEncoders(), ","))
+
 	// Routes Definition
+	// the image operations require an API key (when enabled), are limited per client, counted against the quotas
+	// of the key once accepted, run on the worker pool and are measured
+	operation := []echo.MiddlewareFunc{controllers.Authenticate, controllers.RateLimit, controllers.CountRequest, controllers.Worker, controllers.Instrument}
 	e.GET("/", func(c echo.Context) error {
 		return c.Render(http.StatusOK, "index.html", nil)
 	})
-	e.POST("/image-png-to-jpeg", controllers.ImageConvertPngToJpeg)
-	e.POST("/image-resize", controllers.ImageResize)
-	e.POST("/image-compression", controllers.ImageCompress)
+	e.POST("/image-png-to-jpeg", controllers.ImageConvertPngToJpeg, operation...)
+	e.POST("/image-resize", controllers.ImageResize, operation...)
+	e.POST("/image-compression", controllers.ImageCompress, operation...)
+	e.POST("/image-crop", controllers.ImageCrop, operation...)
+	e.POST("/image-faces", controllers.ImageFaces, operation...)
+	e.POST("/image-filter", controllers.ImageFilter, operation...)
+	e.POST("/image-adjust", controllers.ImageAdjust, operation...)
+	e.POST("/image-effect", controllers.ImageEffect, operation...)
+	e.POST("/image-pad", controllers.ImagePad, operation...)
+	e.POST("/image-mask", controllers.ImageMask, operation...)
+	e.POST("/image-responsive", controllers.ImageResponsive, operation...)
+	e.POST("/image-animation", controllers.ImageAnimation, operation...)
+	e.POST("/image-animate", controllers.ImageAnimate, append([]echo.MiddlewareFunc{
+		middleware.BodyLimit(strconv.FormatInt(cfg.Limits.MaxUploadBytes*services.MaxAnimateFrames, 10)),
+	}, operation...)...)
+	e.POST("/image-watermark", controllers.ImageWatermark, operation...)
+	e.POST("/image-pipeline", controllers.ImagePipeline, operation...)
+	e.GET("/healthz", controllers.Healthz)
+	e.GET("/readyz", controllers.Readyz)
+	e.GET("/capabilities", controllers.Capabilities)
+	e.GET("/metrics", controllers.Metrics)
+	e.GET("/presets", controllers.ListPresets)
+	e.GET("/luts", controllers.ListLuts)
+	e.POST("/luts", controllers.UploadLut, controllers.Authenticate, controllers.RateLimit, controllers.CountRequest)
+	admin := e.Group("/admin", controllers.AdminAuth)
+	admin.GET("/keys", controllers.ListAPIKeys)
+	admin.POST("/keys", controllers.CreateAPIKey)
+	admin.POST("/keys/:id/rotate", controllers.RotateAPIKey)
+	admin.DELETE("/keys/:id", controllers.RevokeAPIKey)
+	admin.GET("/keys/:id/usage", controllers.APIKeyUsage)
 
 	// Run the application
-	e.Logger.Fatal(e.Start(":9000"))
+	go func() {
+		var err error
+		if cfg.Server.TLSCert != "" {
+			err = e.StartTLS(cfg.Server.Address, cfg.Server.TLSCert, cfg.Server.TLSKey)
+		} else {
+			err = e.Start(cfg.Server.Address)
+		}
+		if !errors.Is(err, http.ErrServerClosed) {
+			e.Logger.Fatal(err)
+		}
+	}()
+
+	// Graceful shutdown: stop accepting requests, then wait for the running and queued image operations
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	<-ctx.Done()
+	timeout := time.Duration(cfg.Server.ShutdownTimeout)
+	e.Logger.Printf("shutting down (waiting up to %s for the running operations)", timeout)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := e.Shutdown(shutdownCtx); err != nil {
+		e.Logger.Printf("operations interrupted by the shutdown: %s", err.Error())
+	}
+	if n, err := services.CleanPartialOutputs(cfg.Path(cfg.Storage.Public)); err == nil && n > 0 {
+		e.Logger.Printf("removed %d partial outputs", n)
+	}
+	if err := keys.Close(); err != nil {
+		e.Logger.Printf("failed to save the API keys usage: %s", err.Error())
+	}
+	if err := shutdownTracing(shutdownCtx); err != nil {
+		e.Logger.Printf("failed to flush the traces: %s", err.Error())
+	}
 }
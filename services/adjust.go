@@ -0,0 +1,248 @@
+package services
+
+import (
+	"image"
+	"math"
+
+	"gocv.io/x/gocv"
+)
+
+// share of the darkest and brightest pixels clipped by auto levels (per channel)
+const autoLevelsClip = 0.005
+
+// CLAHE defaults
+const (
+	defaultClaheClipLimit = 2
+	defaultClaheTileSize  = 8
+)
+
+// AdjustOptions corrects the tones and colors of the image. Every adjustment is optional (zero values leave
+// the image untouched) and they are applied in order: auto levels, CLAHE, brightness and contrast, gamma,
+// then saturation and hue.
+type AdjustOptions struct {
+	// Brightness and Contrast are percentages (-100 - 100)
+	Brightness float64 `json:"brightness"`
+	Contrast   float64 `json:"contrast"`
+	// Gamma brightens the midtones when greater than 1 and darkens them when lower (0.1 - 10)
+	Gamma float64 `json:"gamma"`
+	// Saturation is a percentage (-100 - 100, -100 being grayscale)
+	Saturation float64 `json:"saturation"`
+	// Hue rotates the colors (in degrees, -180 - 180)
+	Hue float64 `json:"hue"`
+	// AutoLevels stretches every channel to the full range
+	AutoLevels bool `json:"auto_levels"`
+	// Clahe equalizes the lightness histogram by tiles (contrast limited adaptive histogram equalization)
+	Clahe          bool    `json:"clahe"`
+	ClaheClipLimit float64 `json:"clahe_clip_limit"`
+	ClaheTileSize  int     `json:"clahe_tile_size"`
+}
+
+// WithDefaults fills the CLAHE clip limit (2) and tile size (8) when CLAHE is enabled
+func (ao AdjustOptions) WithDefaults() AdjustOptions {
+	if ao.Clahe {
+		if ao.ClaheClipLimit == 0 {
+			ao.ClaheClipLimit = defaultClaheClipLimit
+		}
+		if ao.ClaheTileSize == 0 {
+			ao.ClaheTileSize = defaultClaheTileSize
+		}
+	}
+	return ao
+}
+
+func (ao AdjustOptions) Validate() error {
+	if ao == (AdjustOptions{}) {
+		return InvalidOption("", "set at least one adjustment (brightness, contrast, gamma, saturation, hue, auto_levels or clahe)")
+	}
+	if ao.Brightness < -100 || ao.Brightness > 100 || ao.Contrast < -100 || ao.Contrast > 100 {
+		return InvalidOption("", "invalid brightness or contrast (must between -100 - 100)")
+	}
+	if ao.Gamma != 0 && (ao.Gamma < 0.1 || ao.Gamma > 10) {
+		return InvalidOption("gamma", "invalid gamma (must between 0.1 - 10)")
+	}
+	if ao.Saturation < -100 || ao.Saturation > 100 {
+		return InvalidOption("saturation", "invalid saturation (must between -100 - 100)")
+	}
+	if ao.Hue < -180 || ao.Hue > 180 {
+		return InvalidOption("hue", "invalid hue (must between -180 - 180)")
+	}
+	if !ao.Clahe && (ao.ClaheClipLimit != 0 || ao.ClaheTileSize != 0) {
+		return InvalidOption("", "invalid clahe_clip_limit or clahe_tile_size (only used with clahe)")
+	}
+	if ao.Clahe && (ao.ClaheClipLimit <= 0 || ao.ClaheClipLimit > 40) {
+		return InvalidOption("clahe_clip_limit", "invalid clahe_clip_limit (must be greater than 0 and up to 40)")
+	}
+	if ao.Clahe && (ao.ClaheTileSize < 1 || ao.ClaheTileSize > 64) {
+		return InvalidOption("clahe_tile_size", "invalid clahe_tile_size (must between 1 - 64)")
+	}
+	return nil
+}
+
+// clampByte rounds the value into the 0 - 255 range
+func clampByte(v float64) byte {
+	return byte(math.Round(min(255, max(0, v))))
+}
+
+// toneLUT maps every value through the brightness, contrast (around the middle gray) and gamma adjustments
+func toneLUT(brightness float64, contrast float64, gamma float64) [256]byte {
+	var lut [256]byte
+	alpha := 1 + contrast/100
+	beta := brightness * 255 / 100
+	for i := range lut {
+		v := alpha*(float64(i)-128) + 128 + beta
+		if gamma != 0 && gamma != 1 {
+			v = 255 * math.Pow(min(255, max(0, v))/255, 1/gamma)
+		}
+		lut[i] = clampByte(v)
+	}
+	return lut
+}
+
+// hueLUT rotates the 8 bits OpenCV hue (0 - 179, 2 degrees per unit) by the given degrees
+func hueLUT(degrees float64) [256]byte {
+	var lut [256]byte
+	shift := int(math.Round(degrees / 2))
+	for i := range lut {
+		lut[i] = byte(i)
+		if i < 180 {
+			lut[i] = byte(((i+shift)%180 + 180) % 180)
+		}
+	}
+	return lut
+}
+
+// scaleLUT multiplies every value by the factor
+func scaleLUT(factor float64) [256]byte {
+	var lut [256]byte
+	for i := range lut {
+		lut[i] = clampByte(float64(i) * factor)
+	}
+	return lut
+}
+
+// levelsLUT stretches the histogram range, once the clip share of the darkest and brightest values is
+// ignored, to 0 - 255
+func levelsLUT(histogram [256]int, clip float64) [256]byte {
+	total := 0
+	for _, count := range histogram {
+		total += count
+	}
+	limit := int(float64(total) * clip)
+	low, high := 0, 255
+	for count := 0; low < 255 && count+histogram[low] <= limit; low++ {
+		count += histogram[low]
+	}
+	for count := 0; high > 0 && count+histogram[high] <= limit; high-- {
+		count += histogram[high]
+	}
+	var lut [256]byte
+	for i := range lut {
+		lut[i] = byte(i)
+		if high > low {
+			lut[i] = clampByte(float64(i-low) * 255 / float64(high-low))
+		}
+	}
+	return lut
+}
+
+// applyLUT maps every channel value of the 8 bits image through the table
+func applyLUT(src gocv.Mat, lut [256]byte, dst *gocv.Mat) error {
+	table, err := gocv.NewMatFromBytes(1, 256, gocv.MatTypeCV8U, lut[:])
+	if err != nil {
+		return err
+	}
+	defer table.Close()
+	gocv.LUT(src, table, dst)
+	return nil
+}
+
+// autoLevels stretches every channel of the BGR image independently
+func autoLevels(bgr *gocv.Mat) error {
+	channels := gocv.Split(*bgr)
+	defer func() {
+		for _, channel := range channels {
+			channel.Close()
+		}
+	}()
+	for i := range channels {
+		var histogram [256]int
+		for _, v := range channels[i].ToBytes() {
+			histogram[v]++
+		}
+		if err := applyLUT(channels[i], levelsLUT(histogram, autoLevelsClip), &channels[i]); err != nil {
+			return err
+		}
+	}
+	gocv.Merge(channels, bgr)
+	return nil
+}
+
+// clahe equalizes the lightness (L channel of the Lab color space) of the BGR image
+func (ao AdjustOptions) clahe(bgr *gocv.Mat) {
+	lab := gocv.NewMat()
+	defer lab.Close()
+	gocv.CvtColor(*bgr, &lab, gocv.ColorBGRToLab)
+	channels := gocv.Split(lab)
+	defer func() {
+		for _, channel := range channels {
+			channel.Close()
+		}
+	}()
+	clahe := gocv.NewCLAHEWithParams(ao.ClaheClipLimit, image.Pt(ao.ClaheTileSize, ao.ClaheTileSize))
+	defer clahe.Close()
+	clahe.Apply(channels[0], &channels[0])
+	gocv.Merge(channels, &lab)
+	gocv.CvtColor(lab, bgr, gocv.ColorLabToBGR)
+}
+
+// saturationHue scales the saturation and rotates the hue in the HSV color space
+func (ao AdjustOptions) saturationHue(bgr *gocv.Mat) error {
+	hsv := gocv.NewMat()
+	defer hsv.Close()
+	gocv.CvtColor(*bgr, &hsv, gocv.ColorBGRToHSV)
+	channels := gocv.Split(hsv)
+	defer func() {
+		for _, channel := range channels {
+			channel.Close()
+		}
+	}()
+	if ao.Hue != 0 {
+		if err := applyLUT(channels[0], hueLUT(ao.Hue), &channels[0]); err != nil {
+			return err
+		}
+	}
+	if ao.Saturation != 0 {
+		if err := applyLUT(channels[1], scaleLUT(1+ao.Saturation/100), &channels[1]); err != nil {
+			return err
+		}
+	}
+	gocv.Merge(channels, &hsv)
+	gocv.CvtColor(hsv, bgr, gocv.ColorHSVToBGR)
+	return nil
+}
+
+func (ao AdjustOptions) apply(src gocv.Mat, basePath string) (gocv.Mat, error) {
+	return withBGR(src, func(bgr *gocv.Mat) error {
+		if ao.AutoLevels {
+			if err := autoLevels(bgr); err != nil {
+				return err
+			}
+		}
+		if ao.Clahe {
+			ao.clahe(bgr)
+		}
+		if ao.Brightness != 0 || ao.Contrast != 0 || (ao.Gamma != 0 && ao.Gamma != 1) {
+			if err := applyLUT(*bgr, toneLUT(ao.Brightness, ao.Contrast, ao.Gamma), bgr); err != nil {
+				return err
+			}
+		}
+		if ao.Saturation != 0 || ao.Hue != 0 {
+			return ao.saturationHue(bgr)
+		}
+		return nil
+	})
+}
+
+func init() {
+	registerPipelineStep("adjust", filterStepBuilder(AdjustOptions.WithDefaults))
+}
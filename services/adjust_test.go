@@ -0,0 +1,83 @@
+package services
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestToneLUT(t *testing.T) {
+	assert := assert.New(t)
+	identity := toneLUT(0, 0, 1)
+	assert.Equal(byte(0), identity[0], "Identity should keep black")
+	assert.Equal(byte(200), identity[200], "Identity should keep the values")
+	brighter := toneLUT(10, 0, 0)
+	assert.Equal(byte(126), brighter[100], "Brightness should shift the values by 10% of 255")
+	assert.Equal(byte(255), brighter[250], "Brightness should saturate")
+	contrast := toneLUT(0, 100, 0)
+	assert.Equal(byte(128), contrast[128], "Contrast should keep the middle gray")
+	assert.Equal(byte(88), contrast[108], "Contrast should double the distance to the middle gray")
+	gamma := toneLUT(0, 0, 2)
+	assert.Equal(byte(180), gamma[127], "Gamma greater than 1 should brighten the midtones")
+}
+
+func TestHueLUT(t *testing.T) {
+	assert := assert.New(t)
+	lut := hueLUT(90)
+	assert.Equal(byte(45), lut[0], "Hue should be rotated by 45 units")
+	assert.Equal(byte(5), lut[140], "Hue should wrap around 180")
+	assert.Equal(byte(200), lut[200], "Values above 179 should be kept")
+	assert.Equal(byte(175), hueLUT(-10)[0], "Negative rotations should wrap around 0")
+}
+
+func TestLevelsLUT(t *testing.T) {
+	assert := assert.New(t)
+	var histogram [256]int
+	histogram[50], histogram[100], histogram[150] = 100, 100, 100
+	lut := levelsLUT(histogram, 0.005)
+	assert.Equal(byte(0), lut[50], "Darkest value should become black")
+	assert.Equal(byte(128), lut[100], "Middle value should be stretched")
+	assert.Equal(byte(255), lut[150], "Brightest value should become white")
+	var flat [256]int
+	flat[80] = 10
+	assert.Equal(byte(80), levelsLUT(flat, 0.005)[80], "Flat images should be kept")
+}
+
+func TestAdjustValidate(t *testing.T) {
+	assert := assert.New(t)
+	assert.NotNil(AdjustOptions{}.Validate(), "Empty adjustments should be rejected")
+	assert.Nil(AdjustOptions{Brightness: 20, Gamma: 1.2}.Validate(), "Error should be nil")
+	assert.NotNil(AdjustOptions{Contrast: 150}.Validate(), "Contrast above 100 should be rejected")
+	assert.NotNil(AdjustOptions{Gamma: 0.01}.Validate(), "Gamma below 0.1 should be rejected")
+	assert.NotNil(AdjustOptions{Hue: 270}.Validate(), "Hue above 180 should be rejected")
+	assert.Nil(AdjustOptions{Clahe: true}.WithDefaults().Validate(), "Default CLAHE should be valid")
+	assert.NotNil(AdjustOptions{AutoLevels: true, ClaheTileSize: 8}.Validate(), "CLAHE options without CLAHE should be rejected")
+	step := Pipeline{Steps: []PipelineStep{{Op: "adjust", Params: json.RawMessage(`{"saturation": -100, "auto_levels": true}`)}}}
+	assert.Nil(step.Validate(), "Adjust step should be valid")
+}
+
+func TestImageManipulationAdjust(t *testing.T) {
+	assert := assert.New(t)
+	im := ImageManipulation{}
+	cwd, _ := os.Getwd()
+	rootDir := filepath.Clean(filepath.Join(cwd, ".."))
+	baseUploadPath := filepath.Join(rootDir, "storages", "test")
+	outputPath := filepath.Join(rootDir, "storages", "public")
+	adjustments := []AdjustOptions{
+		{Brightness: 10, Contrast: 20, Gamma: 1.4},
+		{Saturation: 30, Hue: 45},
+		{AutoLevels: true, Clahe: true, ClaheClipLimit: 3, ClaheTileSize: 8},
+	}
+
+	for _, adjust := range adjustments {
+		result, err := im.Filter(rootDir, baseUploadPath, outputPath, "sample-test.png", adjust, EncodeOptions{Format: FormatJpeg}, false)
+		assert.Equal(nil, err, "Error should be nil")
+		assert.Equal(FormatJpeg, result.Format, "Format should be jpeg")
+		if err == nil {
+			_ = os.Remove(result.OutputFilePath)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package services
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+	"path/filepath"
+
+	"go.opentelemetry.io/otel/attribute"
+	"gocv.io/x/gocv"
+)
+
+// bounds of the number of frames of a built animation
+const (
+	MinAnimateFrames = 2
+	MaxAnimateFrames = 100
+)
+
+// DefaultAnimateDelay is the delay of every frame (in milliseconds) when none is requested
+const DefaultAnimateDelay = 100
+
+var ErrInvalidFrameCount = InvalidOption("frames", "invalid number of frames (must between %d - %d)", MinAnimateFrames, MaxAnimateFrames)
+
+type AnimateOptions struct {
+	// Width and Height of the animation, the first frame size is used when not set
+	Width           float64 `json:"width"`
+	Height          float64 `json:"height"`
+	KeepAspectRatio bool    `json:"keep_aspect_ratio"`
+	// Delays of the frames in milliseconds: a single value applies to every frame
+	Delays []int `json:"delays"`
+	// LoopCount uses the gif semantics: 0 loops forever, -1 plays once and n repeats n times
+	LoopCount int `json:"loop_count"`
+	// Palette strategy of gif outputs (local or global)
+	Palette string        `json:"palette"`
+	Dither  bool          `json:"dither"`
+	Encode  EncodeOptions `json:"encode"`
+}
+
+// WithDefaults fills the output format (gif), palette strategy (local) and frame delay
+func (ao AnimateOptions) WithDefaults() AnimateOptions {
+	if ao.Encode.Format == "" {
+		ao.Encode.Format = FormatGif
+	}
+	if ao.Palette == "" {
+		ao.Palette = PaletteLocal
+	}
+	if len(ao.Delays) == 0 {
+		ao.Delays = []int{DefaultAnimateDelay}
+	}
+	return ao
+}
+
+func (ao AnimateOptions) Validate(frames int) error {
+	if frames < MinAnimateFrames || frames > MaxAnimateFrames {
+		return ErrInvalidFrameCount
+	}
+	if ao.Width < 0 || ao.Height < 0 {
+		return InvalidOption("", "invalid width or height")
+	}
+	if len(ao.Delays) != 1 && len(ao.Delays) != frames {
+		return InvalidOption("delay", "invalid delay (set either a single delay or one per frame, %d)", frames)
+	}
+	for _, delay := range ao.Delays {
+		if delay <= 0 || delay > 655350 {
+			return InvalidOption("delay", "invalid delay (must between 1 - 655350 milliseconds)")
+		}
+	}
+	if ao.LoopCount < -1 || ao.LoopCount > 65535 {
+		return InvalidOption("loop_count", "invalid loop_count (must between -1 - 65535)")
+	}
+	if ao.Palette != PaletteLocal && ao.Palette != PaletteGlobal {
+		return InvalidOption("palette", "invalid palette (choose either local or global)")
+	}
+	return validateAnimationEncode(ao.Encode, ao.Dither)
+}
+
+// Animate builds an animation out of ordered still frames. Every frame is resized to the animation size
+// (the first frame size by default) using the same logic as Resize; with the aspect ratio kept, frames are
+// centered onto a transparent canvas.
+func (im *ImageManipulation) Animate(basePath string, inputPath string, outputPath string, filenames []string, options AnimateOptions, debug bool) (AnimationResult, error) {
+	options = options.WithDefaults()
+	if err := options.Validate(len(filenames)); err != nil {
+		return AnimationResult{}, err
+	}
+	// set options value
+	_, err := im.options.init(basePath, inputPath, outputPath, filenames[0], options.Width, options.Height, options.Encode.Quality, options.Encode.Format, options.KeepAspectRatio, debug)
+	if err != nil {
+		return AnimationResult{}, err
+	}
+	options.Encode.Quality = im.options.Quality
+	// main logic
+	anim := &Animation{LoopCount: options.LoopCount}
+	width, height := int(options.Width), int(options.Height)
+	for i, filename := range filenames {
+		src := im.readImage(filepath.Join(im.options.InputPath, filename), true)
+		if src.Empty() {
+			src.Close()
+			return AnimationResult{}, NewError(CodeDecodeFailed, "frames", fmt.Sprintf("failed to read frame %d", i))
+		}
+		if width == 0 || height == 0 {
+			width, height = src.Cols(), src.Rows()
+		}
+		frame, err := im.animateFrame(src, width, height, options.KeepAspectRatio)
+		src.Close()
+		if err != nil {
+			return AnimationResult{}, err
+		}
+		delay := options.Delays[0]
+		if len(options.Delays) > 1 {
+			delay = options.Delays[i]
+		}
+		anim.Frames = append(anim.Frames, frame)
+		// gif delays are in 100ths of a second
+		anim.Delays = append(anim.Delays, max(1, (delay+5)/10))
+	}
+
+	span := im.startSpan("image.encode", attribute.String("image.format", options.Encode.Format), attribute.Int("image.frames", len(anim.Frames)))
+	data, err := anim.encode(options.Encode, options.Palette, options.Dither)
+	span.SetAttributes(attribute.Int("image.bytes", len(data)))
+	EndSpan(span, err)
+	if err != nil {
+		return AnimationResult{}, err
+	}
+	if err := im.storeImage(im.options.OutputFilePath, data); err != nil {
+		return AnimationResult{}, err
+	}
+	return AnimationResult{
+		OutputFilePath: im.options.OutputFilePath,
+		Format:         options.Encode.Format,
+		Frames:         len(anim.Frames),
+		LoopCount:      anim.LoopCount,
+		Width:          width,
+		Height:         height,
+		Bytes:          len(data),
+	}, nil
+}
+
+// animateFrame resizes a frame to width x height. Frames keeping their aspect ratio are fitted inside
+// and centered onto a transparent canvas.
+func (im *ImageManipulation) animateFrame(src gocv.Mat, width int, height int, keepAspectRatio bool) (*image.NRGBA, error) {
+	resized := gocv.NewMat()
+	defer resized.Close()
+	im.resizeMat(src, &resized, float64(width), float64(height), keepAspectRatio)
+	img, err := resized.ToImage()
+	if err != nil {
+		return nil, err
+	}
+	frame := image.NewNRGBA(image.Rect(0, 0, width, height))
+	bounds := img.Bounds()
+	offset := image.Point{X: (width - bounds.Dx()) / 2, Y: (height - bounds.Dy()) / 2}
+	draw.Draw(frame, bounds.Sub(bounds.Min).Add(offset), img, bounds.Min, draw.Src)
+	return frame, nil
+}
@@ -0,0 +1,48 @@
+package services
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAnimateOptionsValidate(t *testing.T) {
+	assert := assert.New(t)
+	options := AnimateOptions{}.WithDefaults()
+	assert.Equal(nil, options.Validate(8), "Default options should be valid")
+	assert.ErrorIs(options.Validate(1), ErrInvalidFrameCount, "A single frame should be rejected")
+	assert.ErrorIs(options.Validate(MaxAnimateFrames+1), ErrInvalidFrameCount, "Too many frames should be rejected")
+
+	options2 := AnimateOptions{Delays: []int{100, 200}}.WithDefaults()
+	assert.NotEqual(nil, options2.Validate(3), "Delays should match the number of frames")
+	options3 := AnimateOptions{Palette: "adaptive"}.WithDefaults()
+	assert.Equal("invalid palette (choose either local or global)", options3.Validate(3).Error(), "Unknown palette strategy should be rejected")
+	options4 := AnimateOptions{LoopCount: -2}.WithDefaults()
+	assert.NotEqual(nil, options4.Validate(3), "Negative loop count should be rejected")
+}
+
+func TestImageManipulationAnimate(t *testing.T) {
+	assert := assert.New(t)
+	im := ImageManipulation{}
+	cwd, _ := os.Getwd()
+	rootDir := filepath.Clean(filepath.Join(cwd, ".."))
+	baseUploadPath := filepath.Join(rootDir, "storages", "test")
+	outputPath := filepath.Join(rootDir, "storages", "public")
+	frames := []string{"sample-test.png", "sample-test.png", "sample-test.png"}
+
+	result, err := im.Animate(rootDir, baseUploadPath, outputPath, frames, AnimateOptions{Width: 64, Height: 64, KeepAspectRatio: true, Delays: []int{80, 120, 500}, Palette: PaletteGlobal}, false)
+	assert.Equal(nil, err, "Error should be nil")
+	assert.Equal(3, result.Frames, "Animation should have 3 frames")
+	assert.Equal(64, result.Width, "Width should be 64")
+	assert.Equal(64, result.Height, "Height should be 64")
+	if err == nil {
+		anim, _ := DecodeAnimation(result.OutputFilePath)
+		assert.Equal([]int{8, 12, 50}, anim.Delays, "Delays should be kept")
+		_ = os.Remove(result.OutputFilePath)
+	}
+
+	_, err2 := im.Animate(rootDir, baseUploadPath, outputPath, frames[:1], AnimateOptions{}, false)
+	assert.ErrorIs(err2, ErrInvalidFrameCount, "Error 2 should be about the number of frames")
+}
@@ -0,0 +1,459 @@
+package services
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
+	"math"
+	"os"
+	"slices"
+
+	"gocv.io/x/gocv"
+)
+
+const (
+	AnimationResize  = "resize"
+	AnimationCrop    = "crop"
+	AnimationConvert = "convert"
+	AnimationFrame   = "frame"
+	AnimationSprite  = "sprite"
+)
+
+var AnimationOperations = []string{AnimationResize, AnimationCrop, AnimationConvert, AnimationFrame, AnimationSprite}
+
+const (
+	SpriteHorizontal = "horizontal"
+	SpriteVertical   = "vertical"
+)
+
+// gif palette strategies
+const (
+	PaletteLocal  = "local"
+	PaletteGlobal = "global"
+)
+
+// number of colors of every gif frame palette
+const gifPaletteSize = 256
+
+// browsers play gif frames without delay at 10 fps, the same is done for animated webp outputs
+const defaultFrameDelay = 10
+
+var (
+	ErrInvalidAnimationOperation = InvalidOption("operation", "invalid operation (choose either resize, crop, convert, frame or sprite)")
+	ErrInvalidFrame              = InvalidOption("frame", "invalid frame index")
+	ErrInvalidSpriteDirection    = InvalidOption("direction", "invalid direction (choose either horizontal or vertical)")
+)
+
+// MaxPixels bounds the pixels rendered by the services besides the uploads: all the frames of an animation
+// (frames x width x height), every frame being rendered onto a full canvas, and the watermark text masks
+var MaxPixels int64 = 100_000_000
+
+// Animation holds the fully composited frames of an animated image
+type Animation struct {
+	Frames []*image.NRGBA
+	// Delays of every frame, in 100ths of a second
+	Delays []int
+	// LoopCount uses the gif semantics: 0 loops forever, -1 plays once and n repeats n times
+	LoopCount int
+}
+
+// DecodeAnimation reads a gif file and renders every frame onto the full canvas (frame disposal included)
+func DecodeAnimation(inputFilePath string) (*Animation, error) {
+	f, err := os.Open(inputFilePath)
+	if err != nil {
+		return nil, errReadInput
+	}
+	defer f.Close()
+	g, err := gif.DecodeAll(f)
+	if err != nil {
+		return nil, errReadInput
+	}
+
+	// the frames are checked before being composited, a small file may hold thousands of them
+	if len(g.Image) > MaxAnimateFrames {
+		return nil, NewError(CodeDimensionsTooLarge, "file", fmt.Sprintf("animation exceeds the maximum number of frames (%d)", MaxAnimateFrames))
+	}
+	if int64(len(g.Image))*int64(g.Config.Width)*int64(g.Config.Height) > MaxPixels {
+		return nil, NewError(CodeDimensionsTooLarge, "file", fmt.Sprintf("animation exceeds the maximum dimensions (%d pixels over all the frames)", MaxPixels))
+	}
+	anim := &Animation{LoopCount: g.LoopCount}
+	canvas := image.NewNRGBA(image.Rect(0, 0, g.Config.Width, g.Config.Height))
+	for i, frame := range g.Image {
+		disposal := byte(0)
+		if i < len(g.Disposal) {
+			disposal = g.Disposal[i]
+		}
+		var previous *image.NRGBA
+		if disposal == gif.DisposalPrevious {
+			previous = cloneNRGBA(canvas)
+		}
+		draw.Draw(canvas, frame.Bounds(), frame, frame.Bounds().Min, draw.Over)
+		anim.Frames = append(anim.Frames, cloneNRGBA(canvas))
+		anim.Delays = append(anim.Delays, g.Delay[i])
+		switch disposal {
+		case gif.DisposalBackground:
+			draw.Draw(canvas, frame.Bounds(), image.Transparent, image.Point{}, draw.Src)
+		case gif.DisposalPrevious:
+			canvas = previous
+		}
+	}
+	if len(anim.Frames) == 0 {
+		return nil, errReadInput
+	}
+	return anim, nil
+}
+
+func cloneNRGBA(img image.Image) *image.NRGBA {
+	bounds := img.Bounds()
+	dst := image.NewNRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(dst, dst.Bounds(), img, bounds.Min, draw.Src)
+	return dst
+}
+
+func (a *Animation) Width() int {
+	return a.Frames[0].Bounds().Dx()
+}
+
+func (a *Animation) Height() int {
+	return a.Frames[0].Bounds().Dy()
+}
+
+// HasAlpha tells whether any frame has a (partially) transparent pixel
+func (a *Animation) HasAlpha() bool {
+	for _, frame := range a.Frames {
+		for i := 3; i < len(frame.Pix); i += 4 {
+			if frame.Pix[i] != 0xff {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// transform applies the gocv operation on every frame
+func (a *Animation) transform(fn func(src gocv.Mat, dst *gocv.Mat)) error {
+	for i, frame := range a.Frames {
+		src, err := gocv.ImageToMatRGBA(frame)
+		if err != nil {
+			return err
+		}
+		dst := gocv.NewMat()
+		fn(src, &dst)
+		img, err := dst.ToImage()
+		src.Close()
+		dst.Close()
+		if err != nil {
+			return err
+		}
+		a.Frames[i] = cloneNRGBA(img)
+	}
+	return nil
+}
+
+// Frame returns a single frame as a standalone image
+func (a *Animation) Frame(index int) (*image.NRGBA, error) {
+	if index < 0 || index >= len(a.Frames) {
+		return nil, fmt.Errorf("%w (must between 0 - %d)", ErrInvalidFrame, len(a.Frames)-1)
+	}
+	return a.Frames[index], nil
+}
+
+// Sprite lays every frame out next to each other, in the given direction
+func (a *Animation) Sprite(direction string) (*image.NRGBA, error) {
+	width, height := a.Width(), a.Height()
+	var step image.Point
+	switch direction {
+	case SpriteHorizontal:
+		step = image.Point{X: width}
+	case SpriteVertical:
+		step = image.Point{Y: height}
+	default:
+		return nil, ErrInvalidSpriteDirection
+	}
+	n := len(a.Frames)
+	sprite := image.NewNRGBA(image.Rect(0, 0, width+step.X*(n-1), height+step.Y*(n-1)))
+	for i, frame := range a.Frames {
+		offset := step.Mul(i)
+		draw.Draw(sprite, frame.Bounds().Add(offset), frame, image.Point{}, draw.Src)
+	}
+	return sprite, nil
+}
+
+// binaryAlpha returns a copy of the frame with binary transparency (gif does not support partial
+// transparency): pixels below half opacity become fully transparent. It also tells whether any pixel is.
+func binaryAlpha(frame *image.NRGBA) (*image.NRGBA, bool) {
+	binary := cloneNRGBA(frame)
+	transparent := false
+	for p := 3; p < len(binary.Pix); p += 4 {
+		if binary.Pix[p] < 0x80 {
+			copy(binary.Pix[p-3:p+1], []byte{0, 0, 0, 0})
+			transparent = true
+		} else {
+			binary.Pix[p] = 0xff
+		}
+	}
+	return binary, transparent
+}
+
+// gifPalette builds the palette of a (binary transparency) image. Transparent images get an exact
+// transparent entry, which the gif encoder uses as the transparent index.
+func gifPalette(img image.Image, transparent bool) color.Palette {
+	if !transparent {
+		return BuildPalette(img, gifPaletteSize)
+	}
+	opaque := slices.DeleteFunc(BuildPalette(img, gifPaletteSize-1), func(c color.Color) bool {
+		_, _, _, alpha := c.RGBA()
+		return alpha != 0xffff
+	})
+	return append(color.Palette{color.NRGBA{}}, opaque...)
+}
+
+// EncodeGif quantises the frames and encodes the animation, keeping delays and loop count. The local palette
+// strategy gives every frame its own palette, the global one shares a single palette built from all frames
+// (fewer color shifts between similar frames). Gif only supports binary transparency: pixels below half
+// opacity become transparent.
+func (a *Animation) EncodeGif(palette string, dither bool) ([]byte, error) {
+	g := &gif.GIF{LoopCount: a.LoopCount}
+	frames := make([]*image.NRGBA, len(a.Frames))
+	transparent := make([]bool, len(a.Frames))
+	for i, frame := range a.Frames {
+		frames[i], transparent[i] = binaryAlpha(frame)
+	}
+	var shared color.Palette
+	if palette == PaletteGlobal {
+		// the sprite strip is used as a sample of every frame
+		sprite, err := (&Animation{Frames: frames}).Sprite(SpriteHorizontal)
+		if err != nil {
+			return nil, err
+		}
+		shared = gifPalette(sprite, slices.Contains(transparent, true))
+		g.Config = image.Config{ColorModel: shared, Width: a.Width(), Height: a.Height()}
+	}
+	for i, frame := range frames {
+		framePalette := shared
+		if framePalette == nil {
+			framePalette = gifPalette(frame, transparent[i])
+		}
+		g.Image = append(g.Image, QuantizeWithPalette(frame, framePalette, dither))
+		g.Delay = append(g.Delay, a.Delays[i])
+		g.Disposal = append(g.Disposal, gif.DisposalBackground)
+	}
+	var buf bytes.Buffer
+	if err := gif.EncodeAll(&buf, g); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// EncodeWebp encodes every frame as a still webp and muxes them into an animated webp file
+func (a *Animation) EncodeWebp(encode EncodeOptions) ([]byte, error) {
+	encode.Format = FormatWebp
+	if !IsEncoderAvailable(FormatWebp) {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedOutputFormat, FormatWebp)
+	}
+	frames := make([][]byte, 0, len(a.Frames))
+	durations := make([]int, 0, len(a.Frames))
+	for i, frame := range a.Frames {
+		mat, err := gocv.ImageToMatRGBA(frame)
+		if err != nil {
+			return nil, err
+		}
+		data, err := encodeMat(mat, encode)
+		mat.Close()
+		if err != nil {
+			return nil, err
+		}
+		frames = append(frames, data)
+		delay := a.Delays[i]
+		if delay <= 0 {
+			delay = defaultFrameDelay
+		}
+		durations = append(durations, delay*10)
+	}
+	// webp counts the total number of plays, gif the number of repetitions (the largest one is capped to
+	// the largest count of plays)
+	loopCount := 0
+	if a.LoopCount < 0 {
+		loopCount = 1
+	} else if a.LoopCount > 0 {
+		loopCount = min(a.LoopCount+1, math.MaxUint16)
+	}
+	return muxAnimatedWebp(frames, durations, a.Width(), a.Height(), loopCount, a.HasAlpha())
+}
+
+// encode outputs the animation in the gif or webp format
+func (a *Animation) encode(encode EncodeOptions, palette string, dither bool) ([]byte, error) {
+	if encode.Format == FormatWebp {
+		return a.EncodeWebp(encode)
+	}
+	return a.EncodeGif(palette, dither)
+}
+
+type AnimationOptions struct {
+	Operation       string  `json:"operation"`
+	Width           float64 `json:"width"`
+	Height          float64 `json:"height"`
+	KeepAspectRatio bool    `json:"keep_aspect_ratio"`
+	Gravity         string  `json:"gravity"`
+	// Frame is the index of the extracted frame
+	Frame int `json:"frame"`
+	// Direction of the sprite strip (horizontal or vertical)
+	Direction string `json:"direction"`
+	// Dither the gif frame palettes
+	Dither bool `json:"dither"`
+	// Encode describes the output: gif or webp for animations, any still format for frames and sprites
+	Encode EncodeOptions `json:"encode"`
+}
+
+// IsStill tells whether the operation outputs a single still image
+func (ao AnimationOptions) IsStill() bool {
+	return ao.Operation == AnimationFrame || ao.Operation == AnimationSprite
+}
+
+// WithDefaults fills the output format (gif for animations, png for still images), gravity and sprite direction
+func (ao AnimationOptions) WithDefaults() AnimationOptions {
+	if ao.Encode.Format == "" {
+		ao.Encode.Format = FormatGif
+		if ao.IsStill() {
+			ao.Encode.Format = FormatPng
+		}
+	}
+	if ao.Gravity == "" {
+		ao.Gravity = GravityCenter
+	}
+	if ao.Direction == "" {
+		ao.Direction = SpriteHorizontal
+	}
+	return ao
+}
+
+func (ao AnimationOptions) Validate() error {
+	if !slices.Contains(AnimationOperations, ao.Operation) {
+		return ErrInvalidAnimationOperation
+	}
+	if (ao.Operation == AnimationResize || ao.Operation == AnimationCrop) && (ao.Width <= 0 || ao.Height <= 0) {
+		return InvalidOption("", "invalid width or height")
+	}
+	if ao.Operation == AnimationCrop && !slices.Contains(Gravities, ao.Gravity) {
+		return ErrInvalidGravity
+	}
+	if ao.Operation == AnimationFrame && ao.Frame < 0 {
+		return ErrInvalidFrame
+	}
+	if ao.Operation == AnimationSprite && ao.Direction != SpriteHorizontal && ao.Direction != SpriteVertical {
+		return ErrInvalidSpriteDirection
+	}
+	if ao.IsStill() {
+		return ao.Encode.Validate()
+	}
+	return validateAnimationEncode(ao.Encode, ao.Dither)
+}
+
+// validateAnimationEncode checks the output options of an animated image (gif or webp)
+func validateAnimationEncode(encode EncodeOptions, dither bool) error {
+	switch encode.Format {
+	case FormatGif:
+		if encode.Lossless {
+			return InvalidOption("lossless", "lossless mode is not supported for gif")
+		}
+		return nil
+	case FormatWebp:
+		if dither {
+			return InvalidOption("dither", "dither option requires the gif output format")
+		}
+		return EncodeOptions{Format: FormatWebp, Quality: encode.Quality, Lossless: encode.Lossless}.Validate()
+	default:
+		return fmt.Errorf("%w: %s (animations support gif and webp)", ErrUnsupportedOutputFormat, encode.Format)
+	}
+}
+
+type AnimationResult struct {
+	OutputFilePath string `json:"-"`
+	Format         string `json:"format"`
+	Frames         int    `json:"frames"`
+	LoopCount      int    `json:"loop_count"`
+	Width          int    `json:"width"`
+	Height         int    `json:"height"`
+	Bytes          int    `json:"bytes"`
+}
+
+// ProcessAnimation applies the operation on every frame of an animated gif. Resized, cropped and converted
+// animations keep their frame timing and loop count; frame and sprite operations output a still image.
+func (im *ImageManipulation) ProcessAnimation(basePath string, inputPath string, outputPath string, filename string, options AnimationOptions, debug bool) (AnimationResult, error) {
+	options = options.WithDefaults()
+	if err := options.Validate(); err != nil {
+		return AnimationResult{}, err
+	}
+	// set options value
+	_, err := im.options.init(basePath, inputPath, outputPath, filename, options.Width, options.Height, options.Encode.Quality, options.Encode.Format, options.KeepAspectRatio, debug)
+	if err != nil {
+		return AnimationResult{}, err
+	}
+	options.Encode.Quality = im.options.Quality
+	// main logic
+	anim, err := DecodeAnimation(im.options.InputFilePath)
+	if err != nil {
+		return AnimationResult{}, err
+	}
+	switch options.Operation {
+	case AnimationResize:
+		err = anim.transform(func(src gocv.Mat, dst *gocv.Mat) {
+			im.resizeMat(src, dst, im.options.Width, im.options.Height, im.options.KeepAspectRatio)
+		})
+	case AnimationCrop:
+		var rect image.Rectangle
+		rect, err = CropRect(anim.Width(), anim.Height(), int(options.Width), int(options.Height), options.Gravity)
+		if err == nil {
+			err = anim.transform(func(src gocv.Mat, dst *gocv.Mat) {
+				cropped := cropMat(src, rect)
+				defer cropped.Close()
+				cropped.CopyTo(dst)
+			})
+		}
+	}
+	if err != nil {
+		return AnimationResult{}, err
+	}
+
+	result := AnimationResult{Format: options.Encode.Format, Frames: len(anim.Frames), LoopCount: anim.LoopCount}
+	var data []byte
+	if options.IsStill() {
+		var still *image.NRGBA
+		if options.Operation == AnimationFrame {
+			still, err = anim.Frame(options.Frame)
+		} else {
+			still, err = anim.Sprite(options.Direction)
+		}
+		if err != nil {
+			return AnimationResult{}, err
+		}
+		result.Frames, result.LoopCount = 1, 0
+		result.Width, result.Height = still.Bounds().Dx(), still.Bounds().Dy()
+		data, err = encodeStill(still, options.Encode)
+	} else {
+		result.Width, result.Height = anim.Width(), anim.Height()
+		data, err = anim.encode(options.Encode, PaletteLocal, options.Dither)
+	}
+	if err != nil {
+		return AnimationResult{}, err
+	}
+	if err := im.storeImage(im.options.OutputFilePath, data); err != nil {
+		return AnimationResult{}, err
+	}
+	result.OutputFilePath = im.options.OutputFilePath
+	result.Bytes = len(data)
+	return result, nil
+}
+
+// encodeStill encodes a single image, dropping the alpha channel for formats which can not keep it
+func encodeStill(img image.Image, encode EncodeOptions) ([]byte, error) {
+	mat, err := gocv.ImageToMatRGBA(img)
+	if err != nil {
+		return nil, err
+	}
+	defer mat.Close()
+	return encodeOutput(mat, encode)
+}
@@ -0,0 +1,141 @@
+package services
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/gif"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecodeAnimation(t *testing.T) {
+	assert := assert.New(t)
+	cwd, _ := os.Getwd()
+	rootDir := filepath.Clean(filepath.Join(cwd, ".."))
+	anim, err := DecodeAnimation(filepath.Join(rootDir, "storages", "test", "sample-animated.gif"))
+	assert.Equal(nil, err, "Error should be nil")
+	assert.Equal(6, len(anim.Frames), "Animation should have 6 frames")
+	assert.Equal(len(anim.Frames), len(anim.Delays), "Every frame should have a delay")
+	assert.Equal(96, anim.Width(), "Width should be 96")
+	assert.Equal(64, anim.Height(), "Height should be 64")
+
+	_, err2 := DecodeAnimation(filepath.Join(rootDir, "storages", "test", "sample-test.png"))
+	assert.NotEqual(nil, err2, "Error 2 should not be nil")
+}
+
+// writeTestGif writes a gif of the given number of blank frames
+func writeTestGif(t *testing.T, frames int, width int, height int) string {
+	g := &gif.GIF{}
+	for i := 0; i < frames; i++ {
+		g.Image = append(g.Image, image.NewPaletted(image.Rect(0, 0, width, height), color.Palette{color.Black, color.White}))
+		g.Delay = append(g.Delay, 10)
+	}
+	path := filepath.Join(t.TempDir(), "animation.gif")
+	f, _ := os.Create(path)
+	defer f.Close()
+	gif.EncodeAll(f, g)
+	return path
+}
+
+func TestDecodeAnimationLimits(t *testing.T) {
+	assert := assert.New(t)
+	_, err := DecodeAnimation(writeTestGif(t, MaxAnimateFrames+1, 1, 1))
+	assert.ErrorIs(err, ErrDimensionsTooLarge, "Error should be about the number of frames")
+	assert.Equal(fmt.Sprintf("animation exceeds the maximum number of frames (%d)", MaxAnimateFrames), err.Error())
+
+	previous := MaxPixels
+	defer func() { MaxPixels = previous }()
+	MaxPixels = 1000
+	_, err2 := DecodeAnimation(writeTestGif(t, 4, 20, 20))
+	assert.ErrorIs(err2, ErrDimensionsTooLarge, "Error 2 should be about the pixels of all the frames")
+	_, err3 := DecodeAnimation(writeTestGif(t, 2, 20, 20))
+	assert.Equal(nil, err3, "Error 3 should be nil")
+}
+
+func TestAnimationFrameAndSprite(t *testing.T) {
+	assert := assert.New(t)
+	cwd, _ := os.Getwd()
+	rootDir := filepath.Clean(filepath.Join(cwd, ".."))
+	anim, _ := DecodeAnimation(filepath.Join(rootDir, "storages", "test", "sample-animated.gif"))
+
+	frame, err := anim.Frame(2)
+	assert.Equal(nil, err, "Error should be nil")
+	assert.Equal(anim.Frames[2], frame, "Frame 2 should be returned")
+	_, err2 := anim.Frame(6)
+	assert.ErrorIs(err2, ErrInvalidFrame, "Error 2 should be about the invalid frame")
+
+	sprite, err3 := anim.Sprite(SpriteHorizontal)
+	assert.Equal(nil, err3, "Error 3 should be nil")
+	assert.Equal(96*6, sprite.Bounds().Dx(), "Horizontal sprite should be 6 frames wide")
+	assert.Equal(64, sprite.Bounds().Dy(), "Horizontal sprite should be 1 frame high")
+	assert.Equal(anim.Frames[1].At(10, 10), sprite.At(96+10, 10), "Second frame should follow the first one")
+	vertical, _ := anim.Sprite(SpriteVertical)
+	assert.Equal(64*6, vertical.Bounds().Dy(), "Vertical sprite should be 6 frames high")
+	_, err4 := anim.Sprite("diagonal")
+	assert.ErrorIs(err4, ErrInvalidSpriteDirection, "Error 4 should be about the invalid direction")
+}
+
+func TestAnimationEncodeGif(t *testing.T) {
+	assert := assert.New(t)
+	cwd, _ := os.Getwd()
+	rootDir := filepath.Clean(filepath.Join(cwd, ".."))
+	anim, _ := DecodeAnimation(filepath.Join(rootDir, "storages", "test", "sample-animated.gif"))
+	anim.LoopCount = 3
+
+	data, err := anim.EncodeGif(PaletteLocal, true)
+	assert.Equal(nil, err, "Error should be nil")
+	g, err2 := gif.DecodeAll(bytes.NewReader(data))
+	assert.Equal(nil, err2, "Error 2 should be nil")
+	assert.Equal(6, len(g.Image), "Frames should be kept")
+	assert.Equal(anim.Delays, g.Delay, "Delays should be kept")
+	assert.Equal(3, g.LoopCount, "Loop count should be kept")
+
+	data2, err3 := anim.EncodeGif(PaletteGlobal, false)
+	assert.Equal(nil, err3, "Error 3 should be nil")
+	g2, _ := gif.DecodeAll(bytes.NewReader(data2))
+	assert.Equal(6, len(g2.Image), "Frames should be kept with a global palette")
+	assert.Equal(g2.Image[0].Palette, g2.Image[5].Palette, "Frames should share the global palette")
+}
+
+func TestAnimationOptionsValidate(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal(nil, AnimationOptions{Operation: AnimationConvert, Encode: EncodeOptions{Format: FormatGif}}.Validate(), "Gif conversion should be valid")
+	assert.ErrorIs(AnimationOptions{Operation: "rotate", Encode: EncodeOptions{Format: FormatGif}}.Validate(), ErrInvalidAnimationOperation, "Unknown operation should be rejected")
+	assert.NotEqual(nil, AnimationOptions{Operation: AnimationResize, Encode: EncodeOptions{Format: FormatGif}}.Validate(), "Resize without size should be rejected")
+	assert.ErrorIs(AnimationOptions{Operation: AnimationCrop, Width: 10, Height: 10, Gravity: "middle", Encode: EncodeOptions{Format: FormatGif}}.Validate(), ErrInvalidGravity, "Unknown gravity should be rejected")
+	assert.ErrorIs(AnimationOptions{Operation: AnimationConvert, Encode: EncodeOptions{Format: FormatJpeg}}.Validate(), ErrUnsupportedOutputFormat, "Animations should not be encoded into jpeg")
+	assert.Equal(nil, AnimationOptions{Operation: AnimationFrame, Encode: EncodeOptions{Format: FormatJpeg}}.Validate(), "Frames can be encoded into jpeg")
+}
+
+func TestImageManipulationProcessAnimation(t *testing.T) {
+	assert := assert.New(t)
+	im := ImageManipulation{}
+	cwd, _ := os.Getwd()
+	rootDir := filepath.Clean(filepath.Join(cwd, ".."))
+	baseUploadPath := filepath.Join(rootDir, "storages", "test")
+	outputPath := filepath.Join(rootDir, "storages", "public")
+
+	result, err := im.ProcessAnimation(rootDir, baseUploadPath, outputPath, "sample-animated.gif", AnimationOptions{Operation: AnimationResize, Width: 48, Height: 48, KeepAspectRatio: true}, false)
+	assert.Equal(nil, err, "Error should be nil")
+	assert.Equal(6, result.Frames, "Frames should be kept")
+	assert.Equal(48, result.Width, "Width should be 48")
+	assert.Equal(32, result.Height, "Height should keep the aspect ratio")
+	if err == nil {
+		_ = os.Remove(result.OutputFilePath)
+	}
+
+	result2, err2 := im.ProcessAnimation(rootDir, baseUploadPath, outputPath, "sample-animated.gif", AnimationOptions{Operation: AnimationSprite, Encode: EncodeOptions{Format: FormatPng}}, false)
+	assert.Equal(nil, err2, "Error 2 should be nil")
+	assert.Equal(96*6, result2.Width, "Sprite should be 6 frames wide")
+	if err2 == nil {
+		_ = os.Remove(result2.OutputFilePath)
+	}
+
+	_, err3 := im.ProcessAnimation(rootDir, baseUploadPath, outputPath, "sample-animated.gif", AnimationOptions{Operation: AnimationFrame, Frame: 10}, false)
+	assert.ErrorIs(err3, ErrInvalidFrame, "Error 3 should be about the invalid frame")
+}
@@ -0,0 +1,411 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+)
+
+// prefixes of the key identifiers and secrets
+const (
+	keyIDPrefix     = "key_"
+	keySecretPrefix = "imk_"
+)
+
+var (
+	ErrInvalidAPIKey        = NewError(CodeUnauthorized, "api_key", "invalid or missing API key")
+	ErrRevokedAPIKey        = NewError(CodeUnauthorized, "api_key", "API key revoked")
+	ErrAPIKeyNotFound       = NewError(CodeNotFound, "id", "API key not found")
+	ErrAPIKeyRevoked        = NewError(CodeConflict, "id", "API key already revoked")
+	ErrOperationNotAllowed  = NewError(CodeForbidden, "api_key", "operation not allowed for the API key")
+	ErrRequestQuotaExceeded = NewError(CodeQuotaExceeded, "api_key", "request quota exceeded")
+	ErrPixelQuotaExceeded   = NewError(CodeQuotaExceeded, "api_key", "megapixel quota exceeded")
+)
+
+// Quota bounds the requests and the processed megapixels of a period (0 means unlimited)
+type Quota struct {
+	Requests   int64   `json:"requests,omitempty"`
+	Megapixels float64 `json:"megapixels,omitempty"`
+}
+
+type Quotas struct {
+	Daily   Quota `json:"daily"`
+	Monthly Quota `json:"monthly"`
+}
+
+// KeySpec is the access granted to a key: the allowed operations (all of them when empty), the maximum size of
+// the uploads (the server limits apply when 0) and the quotas
+type KeySpec struct {
+	Name           string   `json:"name"`
+	Operations     []string `json:"operations,omitempty"`
+	MaxUploadBytes int64    `json:"max_upload_bytes,omitempty"`
+	MaxPixels      int64    `json:"max_pixels,omitempty"`
+	Quotas         Quotas   `json:"quotas"`
+}
+
+func (ks KeySpec) Validate() error {
+	if ks.MaxUploadBytes < 0 {
+		return InvalidOption("max_upload_bytes", "invalid max_upload_bytes (must be 0 or more)")
+	}
+	if ks.MaxPixels < 0 {
+		return InvalidOption("max_pixels", "invalid max_pixels (must be 0 or more)")
+	}
+	for _, quota := range []Quota{ks.Quotas.Daily, ks.Quotas.Monthly} {
+		if quota.Requests < 0 || quota.Megapixels < 0 {
+			return InvalidOption("quotas", "invalid quotas (must be 0 or more)")
+		}
+	}
+	return nil
+}
+
+// Allows tells whether the key may run the operation
+func (ks KeySpec) Allows(operation string) bool {
+	return len(ks.Operations) == 0 || slices.Contains(ks.Operations, operation)
+}
+
+// Usage counts the requests and the processed megapixels of the current day and month (UTC)
+type Usage struct {
+	Day               string  `json:"day"`
+	DailyRequests     int64   `json:"daily_requests"`
+	DailyMegapixels   float64 `json:"daily_megapixels"`
+	Month             string  `json:"month"`
+	MonthlyRequests   int64   `json:"monthly_requests"`
+	MonthlyMegapixels float64 `json:"monthly_megapixels"`
+}
+
+// rollover resets the counters of the elapsed periods
+func (u *Usage) rollover(now time.Time) {
+	if day := now.UTC().Format(time.DateOnly); u.Day != day {
+		u.Day, u.DailyRequests, u.DailyMegapixels = day, 0, 0
+	}
+	if month := now.UTC().Format("2006-01"); u.Month != month {
+		u.Month, u.MonthlyRequests, u.MonthlyMegapixels = month, 0, 0
+	}
+}
+
+// APIKey describes a key (its secret is only known when it is created or rotated)
+type APIKey struct {
+	ID string `json:"id"`
+	KeySpec
+	CreatedAt time.Time  `json:"created_at"`
+	RotatedAt *time.Time `json:"rotated_at,omitempty"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+	Usage     Usage      `json:"usage"`
+}
+
+// UsageFlushInterval spaces the writes of the usage counters (see FlushEvery), the changes of the keys are
+// written at once
+const UsageFlushInterval = 5 * time.Second
+
+// storedKey is an API key as stored, along with the hash of its secret
+type storedKey struct {
+	APIKey
+	Hash string `json:"hash"`
+}
+
+// KeyStore keeps the API keys and their usage in a JSON file. The changes of the keys are written at once, the
+// usage is written by Flush.
+type KeyStore struct {
+	mu   sync.Mutex
+	path string
+	keys map[string]*storedKey
+	// byHash indexes the keys by the hash of their secret
+	byHash map[string]*storedKey
+	// dirty tells whether the usage changed since the last write
+	dirty     bool
+	closed    chan struct{}
+	closeOnce sync.Once
+	// now is replaced by the tests
+	now func() time.Time
+}
+
+// OpenKeyStore loads the keys of the file (a missing file means no keys)
+func OpenKeyStore(path string) (*KeyStore, error) {
+	ks := &KeyStore{path: path, keys: map[string]*storedKey{}, byHash: map[string]*storedKey{}, closed: make(chan struct{}), now: time.Now}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return ks, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &ks.keys); err != nil {
+		return nil, fmt.Errorf("invalid API keys file %s: %w", path, err)
+	}
+	for _, key := range ks.keys {
+		ks.byHash[key.Hash] = key
+	}
+	return ks, nil
+}
+
+// Flush writes the usage counters, when they changed since the last write
+func (ks *KeyStore) Flush() error {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	if !ks.dirty {
+		return nil
+	}
+	return ks.save()
+}
+
+// FlushEvery writes the usage counters every interval until the store is closed, the failed writes are reported
+// to onError and retried on the next tick
+func (ks *KeyStore) FlushEvery(interval time.Duration, onError func(error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := ks.Flush(); err != nil {
+				onError(err)
+			}
+		case <-ks.closed:
+			return
+		}
+	}
+}
+
+// Close stops FlushEvery and writes the last usage counters
+func (ks *KeyStore) Close() error {
+	ks.closeOnce.Do(func() { close(ks.closed) })
+	return ks.Flush()
+}
+
+// save writes the keys into a temporary file (only readable by the owner) renamed once complete. The usage is
+// written along, a failed write leaves it to be written by the next one.
+func (ks *KeyStore) save() error {
+	data, err := json.MarshalIndent(ks.keys, "", "  ")
+	if err != nil {
+		return err
+	}
+	dir, name := filepath.Split(ks.path)
+	tmp, err := os.CreateTemp(dir, partialOutputPrefix+"*-"+name)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), ks.path); err != nil {
+		return err
+	}
+	ks.dirty = false
+	return nil
+}
+
+// hashSecret returns the hash a secret is stored as (the secrets are random, a fast hash is enough)
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomString(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func newSecret() (string, string, error) {
+	secret, err := randomString(32)
+	if err != nil {
+		return "", "", err
+	}
+	secret = keySecretPrefix + secret
+	return secret, hashSecret(secret), nil
+}
+
+// Create adds a key with the access of the spec and returns it along with its secret
+func (ks *KeyStore) Create(spec KeySpec) (APIKey, string, error) {
+	if err := spec.Validate(); err != nil {
+		return APIKey{}, "", err
+	}
+	id, err := randomString(9)
+	if err != nil {
+		return APIKey{}, "", err
+	}
+	secret, hash, err := newSecret()
+	if err != nil {
+		return APIKey{}, "", err
+	}
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	key := &storedKey{
+		APIKey: APIKey{ID: keyIDPrefix + id, KeySpec: spec, CreatedAt: ks.now().UTC()},
+		Hash:   hash,
+	}
+	key.Usage.rollover(ks.now())
+	ks.keys[key.ID], ks.byHash[hash] = key, key
+	if err := ks.save(); err != nil {
+		delete(ks.keys, key.ID)
+		delete(ks.byHash, hash)
+		return APIKey{}, "", err
+	}
+	return key.APIKey, secret, nil
+}
+
+// Rotate replaces the secret of the key (the previous one stops working) and returns the new one
+func (ks *KeyStore) Rotate(id string) (APIKey, string, error) {
+	secret, hash, err := newSecret()
+	if err != nil {
+		return APIKey{}, "", err
+	}
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	key, ok := ks.keys[id]
+	if !ok {
+		return APIKey{}, "", ErrAPIKeyNotFound
+	}
+	if key.RevokedAt != nil {
+		return APIKey{}, "", ErrAPIKeyRevoked
+	}
+	previous, rotatedAt := key.Hash, key.RotatedAt
+	now := ks.now().UTC()
+	key.Hash, key.RotatedAt = hash, &now
+	delete(ks.byHash, previous)
+	ks.byHash[hash] = key
+	if err := ks.save(); err != nil {
+		key.Hash, key.RotatedAt = previous, rotatedAt
+		delete(ks.byHash, hash)
+		ks.byHash[previous] = key
+		return APIKey{}, "", err
+	}
+	return key.APIKey, secret, nil
+}
+
+// Revoke disables the key for good, its usage is kept
+func (ks *KeyStore) Revoke(id string) (APIKey, error) {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	key, ok := ks.keys[id]
+	if !ok {
+		return APIKey{}, ErrAPIKeyNotFound
+	}
+	if key.RevokedAt == nil {
+		now := ks.now().UTC()
+		key.RevokedAt = &now
+		if err := ks.save(); err != nil {
+			key.RevokedAt = nil
+			return APIKey{}, err
+		}
+	}
+	return key.APIKey, nil
+}
+
+// Get returns the key, with the usage of the current periods
+func (ks *KeyStore) Get(id string) (APIKey, error) {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	key, ok := ks.keys[id]
+	if !ok {
+		return APIKey{}, ErrAPIKeyNotFound
+	}
+	key.Usage.rollover(ks.now())
+	return key.APIKey, nil
+}
+
+// List returns the keys sorted by creation
+func (ks *KeyStore) List() []APIKey {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	r := []APIKey{}
+	for _, key := range ks.keys {
+		key.Usage.rollover(ks.now())
+		r = append(r, key.APIKey)
+	}
+	sort.Slice(r, func(i, j int) bool {
+		return r[i].CreatedAt.Before(r[j].CreatedAt) || (r[i].CreatedAt.Equal(r[j].CreatedAt) && r[i].ID < r[j].ID)
+	})
+	return r
+}
+
+// Check authenticates the secret and tells whether the key may run the operation, within its quotas. The
+// request is counted apart by CountRequest, once accepted.
+func (ks *KeyStore) Check(secret string, operation string) (APIKey, error) {
+	if secret == "" {
+		return APIKey{}, ErrInvalidAPIKey
+	}
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	key, ok := ks.byHash[hashSecret(secret)]
+	if !ok {
+		return APIKey{}, ErrInvalidAPIKey
+	}
+	if key.RevokedAt != nil {
+		return APIKey{}, ErrRevokedAPIKey
+	}
+	if !key.Allows(operation) {
+		return APIKey{}, ErrOperationNotAllowed
+	}
+	if err := ks.exhausted(key); err != nil {
+		return APIKey{}, err
+	}
+	return key.APIKey, nil
+}
+
+// CountRequest counts a request of the key, which is rejected when a quota was exhausted since it was checked
+func (ks *KeyStore) CountRequest(id string) error {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	key, ok := ks.keys[id]
+	if !ok {
+		return ErrAPIKeyNotFound
+	}
+	if err := ks.exhausted(key); err != nil {
+		return err
+	}
+	key.Usage.DailyRequests++
+	key.Usage.MonthlyRequests++
+	ks.dirty = true
+	return nil
+}
+
+// exhausted returns the error of the quota of the key exhausted in the current periods, if any
+func (ks *KeyStore) exhausted(key *storedKey) error {
+	usage, quotas := &key.Usage, key.Quotas
+	usage.rollover(ks.now())
+	if (quotas.Daily.Requests > 0 && usage.DailyRequests >= quotas.Daily.Requests) ||
+		(quotas.Monthly.Requests > 0 && usage.MonthlyRequests >= quotas.Monthly.Requests) {
+		return ErrRequestQuotaExceeded
+	}
+	if (quotas.Daily.Megapixels > 0 && usage.DailyMegapixels >= quotas.Daily.Megapixels) ||
+		(quotas.Monthly.Megapixels > 0 && usage.MonthlyMegapixels >= quotas.Monthly.Megapixels) {
+		return ErrPixelQuotaExceeded
+	}
+	return nil
+}
+
+// AddMegapixels counts the megapixels processed with the key. The request being already accepted, the quota may
+// be exceeded by its last request.
+func (ks *KeyStore) AddMegapixels(id string, megapixels float64) error {
+	if megapixels <= 0 {
+		return nil
+	}
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	key, ok := ks.keys[id]
+	if !ok {
+		return ErrAPIKeyNotFound
+	}
+	key.Usage.rollover(ks.now())
+	key.Usage.DailyMegapixels += megapixels
+	key.Usage.MonthlyMegapixels += megapixels
+	ks.dirty = true
+	return nil
+}
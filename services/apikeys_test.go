@@ -0,0 +1,123 @@
+package services
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// use checks the secret and counts the request, as the Authenticate and CountRequest middlewares do
+func use(ks *KeyStore, secret string, operation string) (APIKey, error) {
+	key, err := ks.Check(secret, operation)
+	if err != nil {
+		return APIKey{}, err
+	}
+	return key, ks.CountRequest(key.ID)
+}
+
+func TestKeyStore(t *testing.T) {
+	assert := assert.New(t)
+	path := filepath.Join(t.TempDir(), "apikeys.json")
+	store, err := OpenKeyStore(path)
+	assert.Equal(nil, err, "Error should be nil")
+	assert.Empty(store.List(), "Missing file should mean no keys")
+
+	key, secret, err2 := store.Create(KeySpec{Name: "mobile", Operations: []string{"resize"}})
+	assert.Equal(nil, err2, "Error 2 should be nil")
+	assert.True(strings.HasPrefix(key.ID, keyIDPrefix), "ID should be prefixed")
+	assert.True(strings.HasPrefix(secret, keySecretPrefix), "Secret should be prefixed")
+	data, _ := os.ReadFile(path)
+	assert.NotContains(string(data), secret, "Secret should not be stored")
+
+	used, err3 := use(store, secret, "resize")
+	assert.Equal(nil, err3, "Error 3 should be nil")
+	assert.Equal(key.ID, used.ID, "Secret should authenticate the key")
+	_, err4 := use(store, secret, "crop")
+	assert.ErrorIs(err4, ErrOperationNotAllowed, "Error 4 should be about the operation")
+	_, err5 := use(store, "imk_unknown", "resize")
+	assert.ErrorIs(err5, ErrInvalidAPIKey, "Error 5 should be about the invalid key")
+
+	_, rotated, err6 := store.Rotate(key.ID)
+	assert.Equal(nil, err6, "Error 6 should be nil")
+	_, err7 := use(store, secret, "resize")
+	assert.ErrorIs(err7, ErrInvalidAPIKey, "Previous secret should stop working")
+
+	// the keys and their usage are kept across restarts
+	reopened, err8 := OpenKeyStore(path)
+	assert.Equal(nil, err8, "Error 8 should be nil")
+	_, err9 := use(reopened, rotated, "resize")
+	assert.Equal(nil, err9, "Error 9 should be nil")
+	stored, _ := reopened.Get(key.ID)
+	assert.Equal(int64(2), stored.Usage.DailyRequests, "Usage should be persisted")
+
+	_, err10 := reopened.Revoke(key.ID)
+	assert.Equal(nil, err10, "Error 10 should be nil")
+	_, err11 := use(reopened, rotated, "resize")
+	assert.ErrorIs(err11, ErrRevokedAPIKey, "Revoked key should be rejected")
+	_, _, err12 := reopened.Rotate(key.ID)
+	assert.ErrorIs(err12, ErrAPIKeyRevoked, "Revoked key should not be rotated")
+	_, err13 := reopened.Get("key_unknown")
+	assert.ErrorIs(err13, ErrAPIKeyNotFound, "Error 13 should be about the missing key")
+}
+
+func TestKeyStoreFlush(t *testing.T) {
+	assert := assert.New(t)
+	path := filepath.Join(t.TempDir(), "apikeys.json")
+	store, _ := OpenKeyStore(path)
+	key, secret, _ := store.Create(KeySpec{Name: "mobile"})
+	use(store, secret, "resize")
+	reopened, _ := OpenKeyStore(path)
+	stored, _ := reopened.Get(key.ID)
+	assert.Equal(int64(0), stored.Usage.DailyRequests, "Usage should not be written on every request")
+
+	// a failed write is retried by the next flush
+	store.path = filepath.Join(path, "missing", "apikeys.json")
+	assert.NotNil(store.Flush(), "Flush should fail")
+	store.path = path
+	assert.Equal(nil, store.Close(), "Error should be nil")
+	reopened2, _ := OpenKeyStore(path)
+	stored2, _ := reopened2.Get(key.ID)
+	assert.Equal(int64(1), stored2.Usage.DailyRequests, "Usage should be written on close")
+	used, err2 := use(reopened2, secret, "resize")
+	assert.Equal(nil, err2, "Error 2 should be nil")
+	assert.Equal(key.ID, used.ID, "Reopened keys should be indexed by hash")
+}
+
+func TestKeyStoreQuotas(t *testing.T) {
+	assert := assert.New(t)
+	store, _ := OpenKeyStore(filepath.Join(t.TempDir(), "apikeys.json"))
+	now := time.Date(2024, time.January, 30, 12, 0, 0, 0, time.UTC)
+	store.now = func() time.Time { return now }
+	key, secret, _ := store.Create(KeySpec{Name: "batch", Quotas: Quotas{
+		Daily:   Quota{Requests: 2},
+		Monthly: Quota{Megapixels: 10},
+	}})
+
+	_, err := use(store, secret, "resize")
+	assert.Equal(nil, err, "Error should be nil")
+	_, err2 := use(store, secret, "resize")
+	assert.Equal(nil, err2, "Error 2 should be nil")
+	_, err3 := use(store, secret, "resize")
+	assert.ErrorIs(err3, ErrRequestQuotaExceeded, "Daily requests should be exhausted")
+	assert.ErrorIs(err3, ErrQuotaExceeded, "Error 3 should be a quota error")
+
+	// the daily quota is reset the next day, the monthly one the next month
+	now = now.Add(time.Hour)
+	store.AddMegapixels(key.ID, 12)
+	now = now.Add(12 * time.Hour)
+	_, err4 := use(store, secret, "resize")
+	assert.ErrorIs(err4, ErrPixelQuotaExceeded, "Monthly megapixels should be exhausted")
+	now = now.Add(24 * time.Hour)
+	_, err5 := use(store, secret, "resize")
+	assert.Equal(nil, err5, "Error 5 should be nil")
+	usage, _ := store.Get(key.ID)
+	assert.Equal("2024-02", usage.Usage.Month, "Month should have rolled over")
+	assert.Equal(int64(1), usage.Usage.MonthlyRequests, "Monthly requests should be reset")
+
+	_, _, err6 := store.Create(KeySpec{Name: "invalid", MaxPixels: -1})
+	assert.ErrorIs(err6, ErrInvalidOption, "Error 6 should be about the invalid spec")
+}
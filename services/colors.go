@@ -0,0 +1,18 @@
+package services
+
+import (
+	"encoding/hex"
+	"image/color"
+	"strings"
+)
+
+var ErrInvalidColor = InvalidOption("", "invalid color (use the hex notation, e.g. #ff8800)")
+
+// ParseHexColor parses an opaque color written as #rrggbb (the # is optional)
+func ParseHexColor(value string) (color.NRGBA, error) {
+	b, err := hex.DecodeString(strings.TrimPrefix(value, "#"))
+	if err != nil || len(b) != 3 {
+		return color.NRGBA{}, ErrInvalidColor
+	}
+	return color.NRGBA{R: b[0], G: b[1], B: b[2], A: 0xff}, nil
+}
@@ -0,0 +1,21 @@
+package services
+
+import (
+	"image/color"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseHexColor(t *testing.T) {
+	assert := assert.New(t)
+	c, err := ParseHexColor("#ff8800")
+	assert.Equal(nil, err, "Error should be nil")
+	assert.Equal(color.NRGBA{R: 0xff, G: 0x88, B: 0x00, A: 0xff}, c, "Color should be orange")
+	c2, _ := ParseHexColor("00FF00")
+	assert.Equal(color.NRGBA{G: 0xff, A: 0xff}, c2, "The # prefix should be optional")
+	_, err3 := ParseHexColor("#f80")
+	assert.ErrorIs(err3, ErrInvalidColor, "Short notation should be rejected")
+	_, err4 := ParseHexColor("orange")
+	assert.ErrorIs(err4, ErrInvalidColor, "Color names should be rejected")
+}
@@ -0,0 +1,138 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"path/filepath"
+	"strings"
+
+	"gocv.io/x/gocv"
+)
+
+const (
+	// lowest quality tried by the size budget search
+	minBudgetQuality = 10
+	// scale factor applied on each downscale step of the size budget search
+	budgetDownscaleStep = 0.85
+	// the size budget search gives up below this width/height
+	minBudgetDimension = 16
+)
+
+var (
+	ErrSizeBudgetTooSmall    = NewError(CodeUnreachableTarget, "max_bytes", "unable to fit the image into max_bytes")
+	ErrTargetSSIMUnreachable = NewError(CodeUnreachableTarget, "target_ssim", "unable to reach target_ssim")
+)
+
+type CompressResult struct {
+	OutputFilePath string  `json:"-"`
+	Format         string  `json:"format"`
+	Quality        int     `json:"quality"`
+	Width          int     `json:"width"`
+	Height         int     `json:"height"`
+	Bytes          int     `json:"bytes"`
+	OriginalBytes  int     `json:"original_bytes"`
+	SavedBytes     int     `json:"saved_bytes"`
+	SSIM           float64 `json:"ssim,omitempty"`
+	Colors         int     `json:"colors,omitempty"`
+}
+
+// highestQualityWithin runs a binary search over the encoding quality (up to maxQuality) and returns
+// the largest encoding which still fits into maxBytes. A maxQuality below minBudgetQuality is tried as is.
+func highestQualityWithin(img gocv.Mat, encode EncodeOptions, maxQuality int, maxBytes int) ([]byte, int, error) {
+	var best []byte
+	bestQuality := 0
+	lo, hi := min(minBudgetQuality, maxQuality), maxQuality
+	for lo <= hi {
+		encode.Quality = (lo + hi) / 2
+		data, err := encodeMat(img, encode)
+		if err != nil {
+			return nil, 0, err
+		}
+		if len(data) <= maxBytes {
+			best, bestQuality = data, encode.Quality
+			lo = encode.Quality + 1
+		} else {
+			hi = encode.Quality - 1
+		}
+	}
+	if best == nil {
+		return nil, 0, ErrSizeBudgetTooSmall
+	}
+	return best, bestQuality, nil
+}
+
+// fitToBudget encodes the image using the highest quality meeting encode.MaxBytes. When even the lowest
+// quality is too large and downscaling is allowed, the image is shrunk step by step until it fits.
+func fitToBudget(src gocv.Mat, encode EncodeOptions) ([]byte, CompressResult, error) {
+	result := CompressResult{Format: encode.Format, Width: src.Cols(), Height: src.Rows()}
+	data, quality, err := highestQualityWithin(src, encode, encode.Quality, encode.MaxBytes)
+	if err == nil || !errors.Is(err, ErrSizeBudgetTooSmall) || !encode.AllowDownscale {
+		result.Quality = quality
+		return data, result, err
+	}
+
+	scaled := gocv.NewMat()
+	defer scaled.Close()
+	scale := 1.0
+	for {
+		scale *= budgetDownscaleStep
+		width := int(float64(src.Cols()) * scale)
+		height := int(float64(src.Rows()) * scale)
+		if width < minBudgetDimension || height < minBudgetDimension {
+			return nil, result, ErrSizeBudgetTooSmall
+		}
+		gocv.Resize(src, &scaled, image.Point{X: width, Y: height}, 0, 0, gocv.InterpolationArea)
+		data, quality, err = highestQualityWithin(scaled, encode, encode.Quality, encode.MaxBytes)
+		if err == nil {
+			result.Quality, result.Width, result.Height = quality, width, height
+			return data, result, nil
+		}
+		if !errors.Is(err, ErrSizeBudgetTooSmall) {
+			return nil, result, err
+		}
+	}
+}
+
+// lowestQualityMeeting runs a binary search over the encoding quality (up to maxQuality) and returns the
+// smallest encoding whose decoded image is at least targetSSIM similar to the source
+func lowestQualityMeeting(src gocv.Mat, encode EncodeOptions, maxQuality int, targetSSIM float64) ([]byte, int, float64, error) {
+	var best []byte
+	bestQuality := 0
+	bestSSIM := 0.0
+	lo, hi := 1, maxQuality
+	for lo <= hi {
+		encode.Quality = (lo + hi) / 2
+		data, err := encodeMat(src, encode)
+		if err != nil {
+			return nil, 0, 0, err
+		}
+		decoded, err := gocv.IMDecode(data, gocv.IMReadUnchanged)
+		if err != nil {
+			return nil, 0, 0, err
+		}
+		score := SSIM(src, decoded)
+		decoded.Close()
+		if score >= targetSSIM {
+			best, bestQuality, bestSSIM = data, encode.Quality, score
+			hi = encode.Quality - 1
+		} else {
+			lo = encode.Quality + 1
+		}
+	}
+	if best == nil {
+		return nil, 0, 0, ErrTargetSSIMUnreachable
+	}
+	return best, bestQuality, bestSSIM, nil
+}
+
+// qualityOutputPath renames the output file (named after the requested quality, e.g. photo-1710681145-100.jpeg)
+// after the quality chosen by a search
+func qualityOutputPath(path string, requested int, chosen int) string {
+	ext := filepath.Ext(path)
+	suffix := fmt.Sprintf("-%d%s", requested, ext)
+	if !strings.HasSuffix(path, suffix) {
+		return path
+	}
+	return fmt.Sprintf("%s-%d%s", strings.TrimSuffix(path, suffix), chosen, ext)
+}
@@ -0,0 +1,215 @@
+package services
+
+import (
+	"image"
+	"math"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"gocv.io/x/gocv"
+)
+
+const (
+	GravityCenter    = "center"
+	GravityNorth     = "north"
+	GravitySouth     = "south"
+	GravityEast      = "east"
+	GravityWest      = "west"
+	GravityNorthEast = "northeast"
+	GravityNorthWest = "northwest"
+	GravitySouthEast = "southeast"
+	GravitySouthWest = "southwest"
+)
+
+var Gravities = []string{GravityCenter, GravityNorth, GravitySouth, GravityEast, GravityWest, GravityNorthEast, GravityNorthWest, GravitySouthEast, GravitySouthWest}
+
+var ErrInvalidGravity = InvalidOption("gravity", "invalid gravity")
+
+// CropRect places a width x height window inside a srcWidth x srcHeight image according to the gravity.
+// The window is clamped to the image size.
+func CropRect(srcWidth int, srcHeight int, width int, height int, gravity string) (image.Rectangle, error) {
+	if !slices.Contains(Gravities, gravity) {
+		return image.Rectangle{}, ErrInvalidGravity
+	}
+	width, height = min(width, srcWidth), min(height, srcHeight)
+	pt := gravityPoint(srcWidth, srcHeight, width, height, gravity)
+	return image.Rect(pt.X, pt.Y, pt.X+width, pt.Y+height), nil
+}
+
+// gravityPoint returns the top left corner of a width x height box placed inside a srcWidth x srcHeight
+// image according to the gravity (the box may overflow the image)
+func gravityPoint(srcWidth int, srcHeight int, width int, height int, gravity string) image.Point {
+	x, y := (srcWidth-width)/2, (srcHeight-height)/2
+	switch gravity {
+	case GravityNorth, GravityNorthEast, GravityNorthWest:
+		y = 0
+	case GravitySouth, GravitySouthEast, GravitySouthWest:
+		y = srcHeight - height
+	}
+	switch gravity {
+	case GravityWest, GravityNorthWest, GravitySouthWest:
+		x = 0
+	case GravityEast, GravityNorthEast, GravitySouthEast:
+		x = srcWidth - width
+	}
+	return image.Pt(x, y)
+}
+
+// cropMat copies the region of the image into a new Mat
+func cropMat(src gocv.Mat, rect image.Rectangle) gocv.Mat {
+	region := src.Region(rect)
+	defer region.Close()
+	return region.Clone()
+}
+
+type CropOptions struct {
+	Width   int    `json:"width"`
+	Height  int    `json:"height"`
+	Gravity string `json:"gravity"`
+	// Fallback is the gravity applied by face crops when no face is found
+	Fallback string `json:"fallback"`
+}
+
+// WithDefaults fills the gravity (center) and the fallback of face crops (smart)
+func (co CropOptions) WithDefaults() CropOptions {
+	if co.Gravity == "" {
+		co.Gravity = GravityCenter
+	}
+	if co.Gravity == GravityFace && co.Fallback == "" {
+		co.Fallback = GravitySmart
+	}
+	return co
+}
+
+func (co CropOptions) Validate() error {
+	if co.Width <= 0 || co.Height <= 0 {
+		return InvalidOption("", "invalid width or height")
+	}
+	if !IsCropGravity(co.Gravity) {
+		return ErrInvalidGravity
+	}
+	if co.Gravity != GravityFace && co.Fallback != "" {
+		return InvalidOption("fallback", "invalid fallback (only face crops have a fallback gravity)")
+	}
+	if co.Fallback == GravityFace || (co.Fallback != "" && !IsCropGravity(co.Fallback)) {
+		return InvalidOption("fallback", "invalid fallback (choose either smart or a fixed gravity)")
+	}
+	return nil
+}
+
+// rect places the crop window on the image. It returns the gravity actually applied, which differs from the
+// requested one when a face crop falls back.
+func (co CropOptions) rect(src gocv.Mat, basePath string) (image.Rectangle, string, error) {
+	gravity := co.Gravity
+	if gravity == GravityFace {
+		rect, found, err := FaceCropRect(src, co.Width, co.Height, filepath.Join(basePath, FaceCascadePath))
+		if err != nil || found {
+			return rect, gravity, err
+		}
+		gravity = co.Fallback
+	}
+	if gravity == GravitySmart {
+		rect, err := SmartCropRect(src, co.Width, co.Height)
+		return rect, gravity, err
+	}
+	rect, err := CropRect(src.Cols(), src.Rows(), co.Width, co.Height, gravity)
+	return rect, gravity, err
+}
+
+// resize fit modes: contain fits the image inside the size, fill stretches it and cover fills the size,
+// cropping the overflow
+const (
+	FitContain = "contain"
+	FitFill    = "fill"
+	FitCover   = "cover"
+)
+
+var Fits = []string{FitContain, FitFill, FitCover}
+
+// coverMat scales the image, keeping its aspect ratio, to the smallest size covering width x height
+func coverMat(src gocv.Mat, width int, height int) gocv.Mat {
+	scale := max(float64(width)/float64(src.Cols()), float64(height)/float64(src.Rows()))
+	size := image.Pt(
+		max(width, int(math.Round(float64(src.Cols())*scale))),
+		max(height, int(math.Round(float64(src.Rows())*scale))),
+	)
+	dst := gocv.NewMat()
+	gocv.Resize(src, &dst, size, 0, 0, gocv.InterpolationCubic)
+	return dst
+}
+
+type CropResult struct {
+	CompressResult
+	// Gravity is the gravity actually applied (face crops may fall back)
+	Gravity string `json:"gravity"`
+	X       int    `json:"x"`
+	Y       int    `json:"y"`
+	// HeatmapFilePath is the interest map rendered for smart crops in debug mode
+	HeatmapFilePath string `json:"-"`
+	Heatmap         string `json:"heatmap,omitempty"`
+}
+
+// Crop cuts a window out of the image according to the gravity and encodes it using the given options.
+// In debug mode, smart crops also write the interest map next to the output file.
+func (im *ImageManipulation) Crop(basePath string, inputPath string, outputPath string, filename string, crop CropOptions, encode EncodeOptions, debug bool) (CropResult, error) {
+	return im.crop(basePath, inputPath, outputPath, filename, crop, false, SharpenOptions{}, encode, debug)
+}
+
+// ResizeCover scales the image to cover width x height, keeping its aspect ratio, crops the overflow according to
+// the gravity and sharpens it (a zero SharpenOptions disables it). An empty output format keeps png inputs as png
+// and encodes the others into jpeg.
+func (im *ImageManipulation) ResizeCover(basePath string, inputPath string, outputPath string, filename string, crop CropOptions, sharpen SharpenOptions, encode EncodeOptions, debug bool) (CropResult, error) {
+	if encode.Format == "" {
+		encode.Format = defaultOutputFormat(filename)
+	}
+	return im.crop(basePath, inputPath, outputPath, filename, crop, true, sharpen, encode, debug)
+}
+
+func (im *ImageManipulation) crop(basePath string, inputPath string, outputPath string, filename string, crop CropOptions, cover bool, sharpen SharpenOptions, encode EncodeOptions, debug bool) (CropResult, error) {
+	crop = crop.WithDefaults()
+	if err := crop.Validate(); err != nil {
+		return CropResult{}, err
+	}
+	if sharpen != (SharpenOptions{}) {
+		if err := sharpen.Validate(); err != nil {
+			return CropResult{}, err
+		}
+	}
+	result := CropResult{}
+	compress, err := im.runSteps(basePath, inputPath, outputPath, filename, func(im *ImageManipulation) ([]pipelineStep, error) {
+		steps := []pipelineStep{func(src gocv.Mat) (gocv.Mat, error) {
+			if cover {
+				scaled := coverMat(src, crop.Width, crop.Height)
+				defer scaled.Close()
+				src = scaled
+			}
+			rect, gravity, err := crop.rect(src, im.options.BasePath)
+			if err != nil {
+				return gocv.Mat{}, err
+			}
+			result.Gravity, result.X, result.Y = gravity, rect.Min.X, rect.Min.Y
+			if im.options.Debug && gravity == GravitySmart {
+				heatmap, err := SmartCropHeatmap(src, rect)
+				if err != nil {
+					return gocv.Mat{}, err
+				}
+				defer heatmap.Close()
+				result.HeatmapFilePath = strings.TrimSuffix(im.options.OutputFilePath, filepath.Ext(im.options.OutputFilePath)) + "-heatmap.png"
+				if err := im.writeImage(result.HeatmapFilePath, heatmap, EncodeOptions{Format: FormatPng}.Params()); err != nil {
+					return gocv.Mat{}, err
+				}
+			}
+			return cropMat(src, rect), nil
+		}}
+		if sharpen != (SharpenOptions{}) {
+			steps = append(steps, filterStep(sharpen, im))
+		}
+		return steps, nil
+	}, encode, debug)
+	if err != nil {
+		return CropResult{}, err
+	}
+	result.CompressResult = compress
+	return result, nil
+}
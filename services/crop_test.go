@@ -0,0 +1,21 @@
+package services
+
+import (
+	"image"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCropRect(t *testing.T) {
+	assert := assert.New(t)
+	rect, err := CropRect(200, 100, 50, 40, GravityCenter)
+	assert.Equal(nil, err, "Error should be nil")
+	assert.Equal(image.Rect(75, 30, 125, 70), rect, "Center crop should be centered")
+	rect2, _ := CropRect(200, 100, 50, 40, GravitySouthEast)
+	assert.Equal(image.Rect(150, 60, 200, 100), rect2, "South east crop should touch the bottom right corner")
+	rect3, _ := CropRect(200, 100, 500, 40, GravityNorth)
+	assert.Equal(image.Rect(0, 0, 200, 40), rect3, "Crop window should be clamped to the image size")
+	_, err4 := CropRect(200, 100, 50, 40, "middle")
+	assert.ErrorIs(err4, ErrInvalidGravity, "Error 4 should be about the invalid gravity")
+}
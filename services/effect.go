@@ -0,0 +1,181 @@
+package services
+
+import (
+	"image/color"
+
+	"gocv.io/x/gocv"
+)
+
+const (
+	EffectGrayscale = "grayscale"
+	EffectSepia     = "sepia"
+	EffectDuotone   = "duotone"
+	EffectInvert    = "invert"
+	EffectLut       = "lut"
+)
+
+var Effects = []string{EffectGrayscale, EffectSepia, EffectDuotone, EffectInvert, EffectLut}
+
+// sepia tone matrix, rows and columns in the BGR order
+var sepiaMatrix = [3][3]float32{
+	{0.131, 0.534, 0.272},
+	{0.168, 0.686, 0.349},
+	{0.189, 0.769, 0.393},
+}
+
+// EffectOptions applies a stylised color effect. The effect is blended with the original image according to
+// the intensity.
+type EffectOptions struct {
+	Effect string `json:"effect"`
+	// Shadow and Highlight are the duotone colors (#rrggbb) mapped to the darkest and brightest tones
+	Shadow    string `json:"shadow"`
+	Highlight string `json:"highlight"`
+	// Lut is the name of an uploaded 3D LUT
+	Lut       string  `json:"lut"`
+	Intensity float64 `json:"intensity"`
+}
+
+// WithDefaults fills the intensity (1)
+func (eo EffectOptions) WithDefaults() EffectOptions {
+	if eo.Intensity == 0 {
+		eo.Intensity = 1
+	}
+	return eo
+}
+
+func (eo EffectOptions) Validate() error {
+	switch eo.Effect {
+	case EffectGrayscale, EffectSepia, EffectInvert:
+	case EffectDuotone:
+		if eo.Shadow == "" || eo.Highlight == "" {
+			return InvalidOption("", "set both shadow and highlight colors")
+		}
+		if _, err := ParseHexColor(eo.Shadow); err != nil {
+			return err
+		}
+		if _, err := ParseHexColor(eo.Highlight); err != nil {
+			return err
+		}
+	case EffectLut:
+		if err := validateLutName(eo.Lut); err != nil {
+			return err
+		}
+	default:
+		return InvalidOption("effect", "invalid effect (choose either grayscale, sepia, duotone, invert or lut)")
+	}
+	if eo.Effect != EffectDuotone && (eo.Shadow != "" || eo.Highlight != "") {
+		return InvalidOption("", "invalid shadow or highlight (only used by the duotone effect)")
+	}
+	if eo.Effect != EffectLut && eo.Lut != "" {
+		return InvalidOption("lut", "invalid lut (only used by the lut effect)")
+	}
+	if eo.Intensity <= 0 || eo.Intensity > 1 {
+		return InvalidOption("intensity", "invalid intensity (must be greater than 0 and up to 1)")
+	}
+	return nil
+}
+
+// duotoneLUTs returns the tables mapping the gray levels to the B, G and R channels of the gradient going
+// from the shadow to the highlight color
+func duotoneLUTs(shadow color.NRGBA, highlight color.NRGBA) [3][256]byte {
+	var luts [3][256]byte
+	from := [3]float64{float64(shadow.B), float64(shadow.G), float64(shadow.R)}
+	to := [3]float64{float64(highlight.B), float64(highlight.G), float64(highlight.R)}
+	for c := range luts {
+		for i := range luts[c] {
+			luts[c][i] = clampByte(from[c] + (to[c]-from[c])*float64(i)/255)
+		}
+	}
+	return luts
+}
+
+// duotone maps the luminance of the BGR image onto the gradient
+func duotone(bgr *gocv.Mat, shadow color.NRGBA, highlight color.NRGBA) error {
+	gray := gocv.NewMat()
+	defer gray.Close()
+	gocv.CvtColor(*bgr, &gray, gocv.ColorBGRToGray)
+	channels := []gocv.Mat{}
+	defer func() {
+		for _, channel := range channels {
+			channel.Close()
+		}
+	}()
+	for _, table := range duotoneLUTs(shadow, highlight) {
+		channel := gocv.NewMat()
+		err := applyLUT(gray, table, &channel)
+		channels = append(channels, channel)
+		if err != nil {
+			return err
+		}
+	}
+	gocv.Merge(channels, bgr)
+	return nil
+}
+
+// sepia applies the sepia tone matrix on the BGR image
+func sepia(bgr *gocv.Mat) {
+	m := gocv.NewMatWithSize(3, 3, gocv.MatTypeCV32F)
+	defer m.Close()
+	for row := range sepiaMatrix {
+		for col, v := range sepiaMatrix[row] {
+			m.SetFloatAt(row, col, v)
+		}
+	}
+	gocv.Transform(*bgr, bgr, m)
+}
+
+// gradeLut maps the BGR image through the 3D LUT
+func gradeLut(bgr *gocv.Mat, cube *CubeLUT) error {
+	pix := bgr.ToBytes()
+	cube.applyBGR(pix)
+	graded, err := gocv.NewMatFromBytes(bgr.Rows(), bgr.Cols(), gocv.MatTypeCV8UC3, pix)
+	if err != nil {
+		return err
+	}
+	defer graded.Close()
+	graded.CopyTo(bgr)
+	return nil
+}
+
+func (eo EffectOptions) apply(src gocv.Mat, basePath string) (gocv.Mat, error) {
+	var cube *CubeLUT
+	if eo.Effect == EffectLut {
+		var err error
+		if cube, err = LoadLut(basePath, eo.Lut); err != nil {
+			return gocv.Mat{}, err
+		}
+	}
+	return withBGR(src, func(bgr *gocv.Mat) error {
+		original := bgr.Clone()
+		defer original.Close()
+		switch eo.Effect {
+		case EffectGrayscale:
+			gray := gocv.NewMat()
+			defer gray.Close()
+			gocv.CvtColor(*bgr, &gray, gocv.ColorBGRToGray)
+			gocv.CvtColor(gray, bgr, gocv.ColorGrayToBGR)
+		case EffectSepia:
+			sepia(bgr)
+		case EffectDuotone:
+			shadow, _ := ParseHexColor(eo.Shadow)
+			highlight, _ := ParseHexColor(eo.Highlight)
+			if err := duotone(bgr, shadow, highlight); err != nil {
+				return err
+			}
+		case EffectInvert:
+			gocv.BitwiseNot(*bgr, bgr)
+		case EffectLut:
+			if err := gradeLut(bgr, cube); err != nil {
+				return err
+			}
+		}
+		if eo.Intensity < 1 {
+			gocv.AddWeighted(original, 1-eo.Intensity, *bgr, eo.Intensity, 0, bgr)
+		}
+		return nil
+	})
+}
+
+func init() {
+	registerPipelineStep("effect", filterStepBuilder(EffectOptions.WithDefaults))
+}
@@ -0,0 +1,59 @@
+package services
+
+import (
+	"image/color"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEffectValidate(t *testing.T) {
+	assert := assert.New(t)
+	assert.Nil(EffectOptions{Effect: EffectSepia}.WithDefaults().Validate(), "Sepia should be valid")
+	assert.NotNil(EffectOptions{Effect: "vintage"}.WithDefaults().Validate(), "Unknown effect should be rejected")
+	assert.NotNil(EffectOptions{Effect: EffectDuotone, Shadow: "#112233"}.WithDefaults().Validate(), "Duotone needs both colors")
+	assert.Nil(EffectOptions{Effect: EffectDuotone, Shadow: "#112233", Highlight: "#ffcc00"}.WithDefaults().Validate(), "Duotone should be valid")
+	assert.NotNil(EffectOptions{Effect: EffectGrayscale, Shadow: "#112233"}.WithDefaults().Validate(), "Colors are only used by duotone")
+	assert.ErrorIs(EffectOptions{Effect: EffectLut, Lut: "../x"}.WithDefaults().Validate(), ErrInvalidLutName, "LUT name should be checked")
+	assert.NotNil(EffectOptions{Effect: EffectInvert, Intensity: 2}.Validate(), "Intensity above 1 should be rejected")
+}
+
+func TestDuotoneLUTs(t *testing.T) {
+	assert := assert.New(t)
+	luts := duotoneLUTs(color.NRGBA{R: 0, G: 0, B: 100, A: 255}, color.NRGBA{R: 255, G: 200, B: 0, A: 255})
+	assert.Equal([3]byte{100, 0, 0}, [3]byte{luts[0][0], luts[1][0], luts[2][0]}, "Black should become the shadow color (BGR)")
+	assert.Equal([3]byte{0, 200, 255}, [3]byte{luts[0][255], luts[1][255], luts[2][255]}, "White should become the highlight color (BGR)")
+}
+
+func TestImageManipulationEffect(t *testing.T) {
+	assert := assert.New(t)
+	im := ImageManipulation{}
+	cwd, _ := os.Getwd()
+	rootDir := filepath.Clean(filepath.Join(cwd, ".."))
+	baseUploadPath := filepath.Join(rootDir, "storages", "test")
+	outputPath := filepath.Join(rootDir, "storages", "public")
+	_, err := SaveLut(rootDir, "test-swap", []byte(cubeLUT(17, func(rgb [3]float64) [3]float64 { return [3]float64{rgb[2], rgb[1], rgb[0]} })), true)
+	assert.Equal(nil, err, "Error should be nil")
+	defer os.Remove(lutPath(rootDir, "test-swap"))
+	effects := []EffectOptions{
+		{Effect: EffectGrayscale},
+		{Effect: EffectSepia, Intensity: 0.6},
+		{Effect: EffectDuotone, Shadow: "#1b1464", Highlight: "#f7b733"},
+		{Effect: EffectInvert},
+		{Effect: EffectLut, Lut: "test-swap"},
+	}
+
+	for _, effect := range effects {
+		result, err := im.Filter(rootDir, baseUploadPath, outputPath, "sample-test.png", effect.WithDefaults(), EncodeOptions{}, false)
+		assert.Equal(nil, err, "Error should be nil")
+		assert.Equal(FormatPng, result.Format, "Png inputs should stay png")
+		if err == nil {
+			_ = os.Remove(result.OutputFilePath)
+		}
+	}
+
+	_, err2 := im.Filter(rootDir, baseUploadPath, outputPath, "sample-test.png", EffectOptions{Effect: EffectLut, Lut: "missing"}.WithDefaults(), EncodeOptions{}, false)
+	assert.ErrorIs(err2, ErrLutNotFound, "Error 2 should be about the missing LUT")
+}
@@ -0,0 +1,282 @@
+package services
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+
+	"gocv.io/x/gocv"
+)
+
+const (
+	FormatJpeg = "jpeg"
+	FormatPng  = "png"
+	FormatWebp = "webp"
+	FormatAvif = "avif"
+)
+
+// AVIF write flags (OpenCV >= 4.10), not exposed by gocv yet
+const (
+	imWriteAvifQuality = 512
+	imWriteAvifSpeed   = 514
+)
+
+// JPEG chroma subsampling write flag (OpenCV >= 4.5.5) and its values, not exposed by gocv yet
+const imWriteJpegSamplingFactor = 7
+
+var jpegSamplingFactors = map[string]int{
+	"444": 0x111111,
+	"422": 0x211111,
+	"420": 0x221111,
+}
+
+// Tiny sample images used to probe which optional codecs the linked OpenCV was built with.
+// Probing is done by decoding: asking OpenCV to encode into a format it has no codec for raises
+// a C++ exception, which can not be recovered from Go.
+const (
+	webpProbeSample = "UklGRhoAAABXRUJQVlA4TA0AAAAvAAAAEAcQERGIiP4HAA=="
+	avifProbeSample = "AAAAIGZ0eXBhdmlmAAAAAGF2aWZtaWYxbWlhZk1BMUIAAADybWV0YQAAAAAAAAAoaGRscgAAAAAAAAAAcGljdAAAAAAAAAAAAAAAAGxpYmF2aWYAAAAADnBpdG0AAAAAAAEAAAAeaWxvYwAAAABEAAABAAEAAAABAAABGgAAAB0AAAAoaWluZgAAAAAAAQAAABppbmZlAgAAAAABAABhdjAxQ29sb3IAAAAAamlwcnAAAABLaXBjbwAAABRpc3BlAAAAAAAAAAIAAAACAAAAEHBpeGkAAAAAAwgICAAAAAxhdjFDgQ0MAAAAABNjb2xybmNseAACAAIAAYAAAAAXaXBtYQAAAAAAAAABAAEEAQKDBAAAACVtZGF0EgAKCBgANogQEAwgMg8f8D///8WfhwB8+ErK42A="
+)
+
+// formatCapabilities describes the output formats: the lossy ones are encoded with a quality, the alpha ones keep
+// the transparency
+var formatCapabilities = map[string]struct{ lossy, alpha bool }{
+	FormatJpeg: {lossy: true},
+	FormatPng:  {alpha: true},
+	FormatWebp: {lossy: true, alpha: true},
+	FormatAvif: {lossy: true, alpha: true},
+}
+
+// IsLossyFormat tells whether the output format is encoded with a quality
+func IsLossyFormat(format string) bool {
+	return formatCapabilities[format].lossy
+}
+
+var ErrUnsupportedOutputFormat = NewError(CodeUnsupportedFormat, "format", "unsupported output format")
+
+var (
+	encoderProbe sync.Once
+	encoders     map[string]bool
+	// disabledEncoders are turned off by the configuration
+	disabledEncoders = map[string]bool{}
+)
+
+// RestrictEncoders disables the output formats which are not listed (jpeg and png are always kept)
+func RestrictEncoders(formats []string) {
+	disabled := map[string]bool{FormatWebp: true, FormatAvif: true}
+	for _, format := range formats {
+		delete(disabled, format)
+	}
+	disabledEncoders = disabled
+}
+
+func probeDecoder(sample string) bool {
+	data, err := base64.StdEncoding.DecodeString(sample)
+	if err != nil {
+		return false
+	}
+	mat, err := gocv.IMDecode(data, gocv.IMReadUnchanged)
+	if err != nil {
+		return false
+	}
+	defer mat.Close()
+	return !mat.Empty()
+}
+
+// ProbeEncoders detects (once) which output encoders are usable and returns the result per format
+func ProbeEncoders() map[string]bool {
+	encoderProbe.Do(func() {
+		encoders = map[string]bool{
+			FormatJpeg: true,
+			FormatPng:  true,
+			FormatWebp: probeDecoder(webpProbeSample),
+			FormatAvif: probeDecoder(avifProbeSample),
+		}
+	})
+	r := map[string]bool{}
+	for format, ok := range encoders {
+		r[format] = ok && !disabledEncoders[format]
+	}
+	return r
+}
+
+func IsEncoderAvailable(format string) bool {
+	return ProbeEncoders()[format]
+}
+
+// AvailableEncoders returns the sorted list of usable output formats
+func AvailableEncoders() []string {
+	r := []string{}
+	for format, ok := range ProbeEncoders() {
+		if ok {
+			r = append(r, format)
+		}
+	}
+	sort.Strings(r)
+	return r
+}
+
+type EncodeOptions struct {
+	Format   string `json:"format"`
+	Quality  int    `json:"quality"`
+	Lossless bool   `json:"lossless"`
+	// MaxBytes is the size budget of the output file (0 means no budget)
+	MaxBytes int `json:"max_bytes"`
+	// AllowDownscale lets the size budget search shrink the image when quality alone is not enough
+	AllowDownscale bool `json:"allow_downscale"`
+	// TargetSSIM is the similarity (against the source) the lowest chosen quality has to meet (0 means no target)
+	TargetSSIM float64 `json:"target_ssim"`
+	// Palette quantises png outputs to a 256 colors palette, optionally dithered
+	Palette bool `json:"palette"`
+	Dither  bool `json:"dither"`
+	// jpeg options: progressive encoding, optimised huffman tables, chroma subsampling (444, 422 or 420) and
+	// restart interval (in MCUs, 0 means no restart markers)
+	Progressive     bool   `json:"progressive"`
+	Optimize        bool   `json:"optimize"`
+	Subsampling     string `json:"subsampling"`
+	RestartInterval int    `json:"restart_interval"`
+}
+
+func (eo EncodeOptions) Validate() error {
+	if !IsEncoderAvailable(eo.Format) {
+		return fmt.Errorf("%w: %s", ErrUnsupportedOutputFormat, eo.Format)
+	}
+	// 0 is the default quality, webp encodes anything above 100 losslessly
+	if eo.Quality < 0 || eo.Quality > 100 {
+		return InvalidOption("quality", "invalid quality (must between 1 - 100)")
+	}
+	if eo.Lossless && eo.Format == FormatJpeg {
+		return InvalidOption("lossless", "lossless mode is not supported for jpeg")
+	}
+	if eo.MaxBytes < 0 {
+		return InvalidOption("max_bytes", "invalid max_bytes (must be a positive number of bytes)")
+	}
+	if eo.MaxBytes > 0 && !eo.UsesQuality() {
+		return InvalidOption("max_bytes", "max_bytes requires a lossy output format (jpeg, webp or avif)")
+	}
+	if eo.TargetSSIM < 0 || eo.TargetSSIM >= 1 {
+		return InvalidOption("target_ssim", "invalid target_ssim (must be greater than 0 and lower than 1)")
+	}
+	if eo.TargetSSIM > 0 && !eo.UsesQuality() {
+		return InvalidOption("target_ssim", "target_ssim requires a lossy output format (jpeg, webp or avif)")
+	}
+	if eo.TargetSSIM > 0 && eo.MaxBytes > 0 {
+		return InvalidOption("", "max_bytes and target_ssim can not be combined")
+	}
+	if (eo.Palette || eo.Dither) && eo.Format != FormatPng {
+		return InvalidOption("", "palette and dither options require the png output format")
+	}
+	if eo.Subsampling != "" {
+		if _, ok := jpegSamplingFactors[eo.Subsampling]; !ok {
+			return InvalidOption("subsampling", "invalid subsampling (choose either 444, 422 or 420)")
+		}
+	}
+	if eo.RestartInterval < 0 || eo.RestartInterval > 65535 {
+		return InvalidOption("restart_interval", "invalid restart_interval (must between 0 - 65535)")
+	}
+	if (eo.Progressive || eo.Optimize || eo.Subsampling != "" || eo.RestartInterval > 0) && eo.Format != FormatJpeg {
+		return InvalidOption("", "progressive, optimize, subsampling and restart_interval options require the jpeg output format")
+	}
+	return nil
+}
+
+// SupportsAlpha tells whether the output format can keep the alpha channel of the source
+func (eo EncodeOptions) SupportsAlpha() bool {
+	return formatCapabilities[eo.Format].alpha
+}
+
+// UsesQuality tells whether the quality applies to the encoding: lossy format, not in lossless mode
+func (eo EncodeOptions) UsesQuality() bool {
+	return IsLossyFormat(eo.Format) && !eo.Lossless
+}
+
+// Params builds the gocv.IMWrite parameters of the selected output format
+func (eo EncodeOptions) Params() []int {
+	switch eo.Format {
+	case FormatPng:
+		return []int{gocv.IMWritePngCompression, 3}
+	case FormatWebp:
+		if eo.Lossless {
+			// quality above 100 switches the webp encoder into lossless mode
+			return []int{gocv.IMWriteWebpQuality, 101}
+		}
+		return []int{gocv.IMWriteWebpQuality, eo.Quality}
+	case FormatAvif:
+		if eo.Lossless {
+			return []int{imWriteAvifQuality, 100, imWriteAvifSpeed, 6}
+		}
+		return []int{imWriteAvifQuality, eo.Quality, imWriteAvifSpeed, 6}
+	default:
+		params := []int{gocv.IMWriteJpegQuality, eo.Quality}
+		if eo.Progressive {
+			params = append(params, gocv.IMWriteJpegProgressive, 1)
+		}
+		if eo.Optimize {
+			params = append(params, gocv.IMWriteJpegOptimize, 1)
+		}
+		if factor, ok := jpegSamplingFactors[eo.Subsampling]; ok {
+			params = append(params, imWriteJpegSamplingFactor, factor)
+		}
+		if eo.RestartInterval > 0 {
+			params = append(params, gocv.IMWriteJpegRstInterval, eo.RestartInterval)
+		}
+		return params
+	}
+}
+
+func readInput(path string, keepAlpha bool) gocv.Mat {
+	if keepAlpha {
+		src := gocv.IMRead(path, gocv.IMReadUnchanged)
+		if src.Type() == gocv.MatTypeCV8UC4 {
+			return src
+		}
+		src.Close()
+	}
+	return gocv.IMRead(path, gocv.IMReadColor)
+}
+
+// encodeMat encodes the image in memory using the selected output format
+func encodeMat(img gocv.Mat, encode EncodeOptions) ([]byte, error) {
+	buf, err := gocv.IMEncodeWithParams(gocv.FileExt("."+encode.Format), img, encode.Params())
+	if err != nil {
+		return nil, err
+	}
+	defer buf.Close()
+	if buf.Len() == 0 {
+		return nil, errors.New("failed to encode output image")
+	}
+	return bytes.Clone(buf.GetBytes()), nil
+}
+
+// encodeOutput encodes the image in memory, dropping the alpha channel for formats which can not keep it
+func encodeOutput(img gocv.Mat, encode EncodeOptions) ([]byte, error) {
+	if img.Channels() == 4 && !encode.SupportsAlpha() {
+		bgr := gocv.NewMat()
+		defer bgr.Close()
+		gocv.CvtColor(img, &bgr, gocv.ColorBGRAToBGR)
+		return encodeMat(bgr, encode)
+	}
+	return encodeMat(img, encode)
+}
+
+func writeOutputBytes(path string, data []byte) error {
+	return writeAtomic(path, func(tmpPath string) error {
+		if err := os.WriteFile(tmpPath, data, 0o644); err != nil {
+			return errors.New("failed to write output file")
+		}
+		return nil
+	})
+}
+
+func writeOutput(path string, img gocv.Mat, params []int) error {
+	return writeAtomic(path, func(tmpPath string) error {
+		if ok := gocv.IMWriteWithParams(tmpPath, img, params); !ok {
+			return errors.New("failed to write output file")
+		}
+		return nil
+	})
+}
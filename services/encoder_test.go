@@ -0,0 +1,51 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gocv.io/x/gocv"
+)
+
+func TestProbeEncoders(t *testing.T) {
+	assert := assert.New(t)
+	encoders := ProbeEncoders()
+	assert.True(encoders[FormatJpeg], "JPEG encoder should always be available")
+	assert.True(encoders[FormatPng], "PNG encoder should always be available")
+	assert.Contains(encoders, FormatWebp, "WebP encoder should be probed")
+	assert.Contains(encoders, FormatAvif, "AVIF encoder should be probed")
+	assert.False(IsEncoderAvailable("tiff"), "Unknown encoder should not be available")
+	assert.Contains(AvailableEncoders(), FormatJpeg, "Available encoders should list JPEG")
+}
+
+func TestEncodeOptionsParams(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal([]int{gocv.IMWriteJpegQuality, 70}, EncodeOptions{Format: FormatJpeg, Quality: 70}.Params())
+	assert.Equal([]int{gocv.IMWriteWebpQuality, 70}, EncodeOptions{Format: FormatWebp, Quality: 70}.Params())
+	assert.Equal([]int{gocv.IMWriteWebpQuality, 101}, EncodeOptions{Format: FormatWebp, Quality: 70, Lossless: true}.Params())
+	assert.Equal([]int{imWriteAvifQuality, 100, imWriteAvifSpeed, 6}, EncodeOptions{Format: FormatAvif, Quality: 70, Lossless: true}.Params())
+	assert.False(EncodeOptions{Format: FormatJpeg}.SupportsAlpha(), "JPEG should not support alpha")
+	assert.True(EncodeOptions{Format: FormatWebp}.SupportsAlpha(), "WebP should support alpha")
+	assert.True(EncodeOptions{Format: FormatAvif}.UsesQuality(), "AVIF should use the quality")
+	assert.False(EncodeOptions{Format: FormatPng}.UsesQuality(), "PNG should ignore the quality")
+	assert.False(EncodeOptions{Format: FormatWebp, Lossless: true}.UsesQuality(), "Lossless WebP should ignore the quality")
+	assert.False(IsLossyFormat("tiff"), "Unknown format should not be lossy")
+}
+
+func TestEncodeOptionsJpegParams(t *testing.T) {
+	assert := assert.New(t)
+	encode := EncodeOptions{Format: FormatJpeg, Quality: 85, Progressive: true, Optimize: true, Subsampling: "420", RestartInterval: 4}
+	assert.Equal(nil, encode.Validate(), "Error should be nil")
+	assert.Equal([]int{
+		gocv.IMWriteJpegQuality, 85,
+		gocv.IMWriteJpegProgressive, 1,
+		gocv.IMWriteJpegOptimize, 1,
+		imWriteJpegSamplingFactor, 0x221111,
+		gocv.IMWriteJpegRstInterval, 4,
+	}, encode.Params())
+
+	assert.Equal("invalid subsampling (choose either 444, 422 or 420)", EncodeOptions{Format: FormatJpeg, Subsampling: "411"}.Validate().Error())
+	assert.Equal("invalid restart_interval (must between 0 - 65535)", EncodeOptions{Format: FormatJpeg, RestartInterval: 70000}.Validate().Error())
+	assert.Equal("invalid quality (must between 1 - 100)", EncodeOptions{Format: FormatJpeg, Quality: 150}.Validate().Error())
+	assert.Equal("progressive, optimize, subsampling and restart_interval options require the jpeg output format", EncodeOptions{Format: FormatPng, Progressive: true}.Validate().Error())
+}
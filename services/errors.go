@@ -0,0 +1,91 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Code is the stable, machine-readable code of an error, the clients should rely on it rather than on the message
+type Code string
+
+// codes of the errors
+const (
+	CodeInvalidOption      Code = "invalid_option"
+	CodeMissingFile        Code = "missing_file"
+	CodeUnsupportedFormat  Code = "unsupported_format"
+	CodeUploadTooLarge     Code = "upload_too_large"
+	CodeDimensionsTooLarge Code = "dimensions_too_large"
+	CodeDecodeFailed       Code = "decode_failed"
+	CodeNotFound           Code = "not_found"
+	CodeConflict           Code = "conflict"
+	CodeUnreachableTarget  Code = "unreachable_target"
+	CodeUnauthorized       Code = "unauthorized"
+	CodeForbidden          Code = "forbidden"
+	CodeQuotaExceeded      Code = "quota_exceeded"
+	CodeInternal           Code = "internal_error"
+)
+
+// Error is an error of the image operations caused by the request, such as an invalid option or an unreadable
+// image. Field names the request field at fault (empty when the error is not tied to a single field).
+type Error struct {
+	Code    Code
+	Field   string
+	Message string
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// Is matches the generic error of the code, e.g. errors.Is(err, ErrDecodeFailed) holds for every decoding error
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t == codeErrors[e.Code]
+}
+
+// codeErrors are the generic errors of the codes
+var codeErrors = map[Code]*Error{}
+
+func codeError(code Code, message string) *Error {
+	err := &Error{Code: code, Message: message}
+	codeErrors[code] = err
+	return err
+}
+
+// generic errors of the codes, to be matched with errors.Is
+var (
+	ErrInvalidOption      = codeError(CodeInvalidOption, "invalid option")
+	ErrMissingFile        = codeError(CodeMissingFile, "missing file")
+	ErrUnsupportedFormat  = codeError(CodeUnsupportedFormat, "unsupported format")
+	ErrUploadTooLarge     = codeError(CodeUploadTooLarge, "upload too large")
+	ErrDimensionsTooLarge = codeError(CodeDimensionsTooLarge, "image dimensions too large")
+	ErrDecodeFailed       = codeError(CodeDecodeFailed, "failed to decode the image")
+	ErrNotFound           = codeError(CodeNotFound, "not found")
+	ErrConflict           = codeError(CodeConflict, "conflict")
+	ErrUnreachableTarget  = codeError(CodeUnreachableTarget, "unable to reach the output target")
+	ErrUnauthorized       = codeError(CodeUnauthorized, "unauthorized")
+	ErrForbidden          = codeError(CodeForbidden, "forbidden")
+	ErrQuotaExceeded      = codeError(CodeQuotaExceeded, "quota exceeded")
+)
+
+// NewError returns an error of the code attributed to the request field
+func NewError(code Code, field string, message string) *Error {
+	return &Error{Code: code, Field: field, Message: message}
+}
+
+// InvalidOption returns an invalid_option error attributed to the request field
+func InvalidOption(field string, format string, args ...interface{}) *Error {
+	return NewError(CodeInvalidOption, field, fmt.Sprintf(format, args...))
+}
+
+// errReadInput is returned when OpenCV can not read the input file
+var errReadInput = NewError(CodeDecodeFailed, "", "failed to read input file")
+
+// ErrorOf returns the typed error of the chain (nil for the errors not caused by the request)
+func ErrorOf(err error) *Error {
+	e := &Error{}
+	if errors.As(err, &e) {
+		return e
+	}
+	return nil
+}
@@ -0,0 +1,30 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestErrorCodes(t *testing.T) {
+	assert := assert.New(t)
+	err := fmt.Errorf("%w: tiff", ErrUnsupportedOutputFormat)
+	assert.ErrorIs(err, ErrUnsupportedFormat, "Error should match the generic error of its code")
+	assert.ErrorIs(err, ErrUnsupportedOutputFormat, "Error should match its sentinel")
+	assert.False(errors.Is(err, ErrInvalidOption), "Error should not match the other codes")
+	assert.False(errors.Is(ErrInvalidGravity, ErrInvalidFilter), "Sentinels of a code should not match each other")
+
+	typed := ErrorOf(err)
+	if assert.NotNil(typed, "Typed error should be found in the chain") {
+		assert.Equal(CodeUnsupportedFormat, typed.Code)
+		assert.Equal("format", typed.Field)
+	}
+	assert.Nil(ErrorOf(errors.New("failed to write output file")), "Untyped errors have no code")
+
+	option := InvalidOption("radius", "invalid radius (must between 0 - %d)", MaxPadding)
+	assert.ErrorIs(option, ErrInvalidOption)
+	assert.Equal(fmt.Sprintf("invalid radius (must between 0 - %d)", MaxPadding), option.Error())
+	assert.ErrorIs(SharpenOptions{Amount: 20, Radius: 1}.Validate(), ErrInvalidOption, "Validation errors should be invalid options")
+}
@@ -0,0 +1,189 @@
+package services
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"go.opentelemetry.io/otel/attribute"
+	"gocv.io/x/gocv"
+)
+
+// GravityFace crops around the detected faces, falling back to another gravity when there is none
+const GravityFace = "face"
+
+// FaceCascadePath is the bundled frontal face Haar cascade, relative to the base path
+var FaceCascadePath = filepath.Join("storages", "cascades", "haarcascade_frontalface_default.xml")
+
+const (
+	// faces are detected on a downscaled copy (longest side, in pixels)
+	faceDetectionSize = 1024
+	// smallest detected face, relative to the shortest side of the analysed image
+	faceMinSizeRatio = 0.05
+	faceScaleFactor  = 1.1
+	faceMinNeighbors = 5
+)
+
+var ErrFaceCascadeNotFound = errors.New("face cascade not found")
+
+// faceCascade is a cascade loaded once per path, its detections are serialized as the classifier is not safe
+// for concurrent use
+type faceCascade struct {
+	mu         sync.Mutex
+	classifier gocv.CascadeClassifier
+}
+
+var (
+	faceCascadesMu sync.Mutex
+	faceCascades   = map[string]*faceCascade{}
+)
+
+// loadFaceCascade returns the cascade of the path, loading it on first use (a missing or invalid file is
+// retried on the next use)
+func loadFaceCascade(cascadePath string) (*faceCascade, error) {
+	faceCascadesMu.Lock()
+	defer faceCascadesMu.Unlock()
+	if cascade, ok := faceCascades[cascadePath]; ok {
+		return cascade, nil
+	}
+	if _, err := os.Stat(cascadePath); err != nil {
+		return nil, ErrFaceCascadeNotFound
+	}
+	classifier := gocv.NewCascadeClassifier()
+	if !classifier.Load(cascadePath) {
+		classifier.Close()
+		return nil, ErrFaceCascadeNotFound
+	}
+	cascade := &faceCascade{classifier: classifier}
+	faceCascades[cascadePath] = cascade
+	return cascade, nil
+}
+
+// Box is a rectangle of the image, such as the bounding box of a detected face
+type Box struct {
+	X      int `json:"x"`
+	Y      int `json:"y"`
+	Width  int `json:"width"`
+	Height int `json:"height"`
+}
+
+func newBox(rect image.Rectangle) Box {
+	return Box{X: rect.Min.X, Y: rect.Min.Y, Width: rect.Dx(), Height: rect.Dy()}
+}
+
+func (b Box) Rect() image.Rectangle {
+	return image.Rect(b.X, b.Y, b.X+b.Width, b.Y+b.Height)
+}
+
+// DetectFaces returns the bounding boxes of the frontal faces found in the image, using the Haar cascade at
+// cascadePath
+func DetectFaces(src gocv.Mat, cascadePath string) ([]image.Rectangle, error) {
+	cascade, err := loadFaceCascade(cascadePath)
+	if err != nil {
+		return nil, err
+	}
+
+	bgr := toBGR(src)
+	defer bgr.Close()
+	scale := min(1, float64(faceDetectionSize)/float64(max(bgr.Cols(), bgr.Rows())))
+	gray := gocv.NewMat()
+	defer gray.Close()
+	gocv.CvtColor(bgr, &gray, gocv.ColorBGRToGray)
+	gocv.Resize(gray, &gray, image.Point{}, scale, scale, gocv.InterpolationArea)
+	gocv.EqualizeHist(gray, &gray)
+
+	minSide := int(float64(min(gray.Cols(), gray.Rows())) * faceMinSizeRatio)
+	minSize := image.Pt(max(24, minSide), max(24, minSide))
+	cascade.mu.Lock()
+	faces := cascade.classifier.DetectMultiScaleWithParams(gray, faceScaleFactor, faceMinNeighbors, 0, minSize, image.Point{})
+	cascade.mu.Unlock()
+	bounds := image.Rect(0, 0, src.Cols(), src.Rows())
+	r := []image.Rectangle{}
+	for _, face := range faces {
+		r = append(r, image.Rect(
+			int(float64(face.Min.X)/scale), int(float64(face.Min.Y)/scale),
+			int(float64(face.Max.X)/scale), int(float64(face.Max.Y)/scale),
+		).Intersect(bounds))
+	}
+	return r, nil
+}
+
+// faceWindow returns the top left corner of the width x height window centered on the faces (on the largest
+// one when they don't all fit in the window), clamped to the srcWidth x srcHeight image
+func faceWindow(srcWidth int, srcHeight int, width int, height int, faces []image.Rectangle) image.Point {
+	width, height = min(width, srcWidth), min(height, srcHeight)
+	target, largest := image.Rectangle{}, image.Rectangle{}
+	for _, face := range faces {
+		target = target.Union(face)
+		if face.Dx()*face.Dy() > largest.Dx()*largest.Dy() {
+			largest = face
+		}
+	}
+	if target.Dx() > width || target.Dy() > height {
+		target = largest
+	}
+	x := (target.Min.X + target.Max.X - width) / 2
+	y := (target.Min.Y + target.Max.Y - height) / 2
+	return image.Pt(min(max(0, x), srcWidth-width), min(max(0, y), srcHeight-height))
+}
+
+// FaceCropRect places the width x height window (clamped to the image size) on the faces of the image. It
+// returns false when no face is found.
+func FaceCropRect(src gocv.Mat, width int, height int, cascadePath string) (image.Rectangle, bool, error) {
+	faces, err := DetectFaces(src, cascadePath)
+	if err != nil || len(faces) == 0 {
+		return image.Rectangle{}, false, err
+	}
+	width, height = min(width, src.Cols()), min(height, src.Rows())
+	pt := faceWindow(src.Cols(), src.Rows(), width, height, faces)
+	return image.Rect(pt.X, pt.Y, pt.X+width, pt.Y+height), true, nil
+}
+
+type FacesResult struct {
+	Width  int   `json:"width"`
+	Height int   `json:"height"`
+	Faces  []Box `json:"faces"`
+	// OutputFilePath is the image annotated with the bounding boxes in debug mode
+	OutputFilePath string `json:"-"`
+}
+
+// Faces detects the faces of the image. In debug mode, the image annotated with the bounding boxes is written
+// into the output path (png).
+func (im *ImageManipulation) Faces(basePath string, inputPath string, outputPath string, filename string, debug bool) (FacesResult, error) {
+	// set options value
+	_, err := im.options.init(basePath, inputPath, outputPath, filename, -1, -1, 0, FormatPng, true, debug)
+	if err != nil {
+		return FacesResult{}, err
+	}
+	// main logic
+	src := im.readImage(im.options.InputFilePath, false)
+	defer src.Close()
+	if src.Empty() {
+		return FacesResult{}, errReadInput
+	}
+	span := im.startTransform(src)
+	faces, err := DetectFaces(src, filepath.Join(im.options.BasePath, FaceCascadePath))
+	span.SetAttributes(attribute.Int("image.faces", len(faces)))
+	EndSpan(span, err)
+	if err != nil {
+		return FacesResult{}, err
+	}
+	result := FacesResult{Width: src.Cols(), Height: src.Rows(), Faces: []Box{}}
+	for _, face := range faces {
+		result.Faces = append(result.Faces, newBox(face))
+	}
+	if im.options.Debug {
+		thickness := max(2, src.Cols()/300)
+		for _, face := range faces {
+			gocv.Rectangle(&src, face, color.RGBA{R: 0, G: 255, B: 0, A: 255}, thickness)
+		}
+		if err := im.writeImage(im.options.OutputFilePath, src, EncodeOptions{Format: FormatPng}.Params()); err != nil {
+			return FacesResult{}, err
+		}
+		result.OutputFilePath = im.options.OutputFilePath
+	}
+	return result, nil
+}
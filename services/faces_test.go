@@ -0,0 +1,80 @@
+package services
+
+import (
+	"image"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gocv.io/x/gocv"
+)
+
+func TestFaceWindow(t *testing.T) {
+	assert := assert.New(t)
+	faces := []image.Rectangle{image.Rect(600, 100, 700, 200), image.Rect(720, 120, 780, 180)}
+	assert.Equal(image.Pt(540, 0), faceWindow(1000, 500, 300, 300, faces), "Window should be centered on every face")
+	assert.Equal(image.Pt(600, 100), faceWindow(1000, 500, 100, 100, faces), "Window should be centered on the largest face")
+	assert.Equal(image.Pt(700, 0), faceWindow(1000, 500, 300, 300, []image.Rectangle{image.Rect(950, 0, 1000, 50)}), "Window should be clamped to the image")
+}
+
+func TestCropOptionsFallback(t *testing.T) {
+	assert := assert.New(t)
+	crop := CropOptions{Width: 100, Height: 100, Gravity: GravityFace}.WithDefaults()
+	assert.Equal(GravitySmart, crop.Fallback, "Face crops should fall back to smart")
+	assert.Nil(crop.Validate(), "Error should be nil")
+	assert.Nil(CropOptions{Width: 100, Height: 100, Gravity: GravityFace, Fallback: GravityCenter}.Validate(), "Error should be nil")
+	assert.NotNil(CropOptions{Width: 100, Height: 100, Gravity: GravityFace, Fallback: GravityFace}.Validate(), "Face should not fall back to face")
+	assert.NotNil(CropOptions{Width: 100, Height: 100, Gravity: GravityCenter, Fallback: GravitySmart}.Validate(), "Only face crops should have a fallback")
+}
+
+func TestDetectFaces(t *testing.T) {
+	assert := assert.New(t)
+	cwd, _ := os.Getwd()
+	rootDir := filepath.Clean(filepath.Join(cwd, ".."))
+	src := gocv.IMRead(filepath.Join(rootDir, "storages", "test", "sample-test.png"), gocv.IMReadColor)
+	defer src.Close()
+	faces, err := DetectFaces(src, filepath.Join(rootDir, FaceCascadePath))
+	assert.Equal(nil, err, "Error should be nil")
+	for _, face := range faces {
+		assert.True(face.In(image.Rect(0, 0, src.Cols(), src.Rows())), "Face should be inside the image")
+	}
+	_, err2 := DetectFaces(src, filepath.Join(rootDir, "missing.xml"))
+	assert.ErrorIs(err2, ErrFaceCascadeNotFound, "Error 2 should be about the missing cascade")
+}
+
+func TestImageManipulationResizeCover(t *testing.T) {
+	assert := assert.New(t)
+	im := ImageManipulation{}
+	cwd, _ := os.Getwd()
+	rootDir := filepath.Clean(filepath.Join(cwd, ".."))
+	baseUploadPath := filepath.Join(rootDir, "storages", "test")
+	outputPath := filepath.Join(rootDir, "storages", "public")
+
+	result, err := im.ResizeCover(rootDir, baseUploadPath, outputPath, "sample-test.png", CropOptions{Width: 128, Height: 128, Gravity: GravityFace, Fallback: GravityCenter}, SharpenOptions{}, EncodeOptions{}, false)
+	assert.Equal(nil, err, "Error should be nil")
+	assert.Equal(FormatPng, result.Format, "Png inputs should stay png")
+	assert.Equal(128, result.Width, "Width should be 128")
+	assert.Equal(128, result.Height, "Height should be 128")
+	assert.Contains([]string{GravityFace, GravityCenter}, result.Gravity, "Gravity should be face or its fallback")
+	if err == nil {
+		_ = os.Remove(result.OutputFilePath)
+	}
+}
+
+func TestImageManipulationFaces(t *testing.T) {
+	assert := assert.New(t)
+	im := ImageManipulation{}
+	cwd, _ := os.Getwd()
+	rootDir := filepath.Clean(filepath.Join(cwd, ".."))
+	baseUploadPath := filepath.Join(rootDir, "storages", "test")
+	outputPath := filepath.Join(rootDir, "storages", "public")
+
+	result, err := im.Faces(rootDir, baseUploadPath, outputPath, "sample-test.png", true)
+	assert.Equal(nil, err, "Error should be nil")
+	assert.NotNil(result.Faces, "Faces should be an empty list rather than nil")
+	assert.NotEqual("", result.OutputFilePath, "Debug mode should write the annotated image")
+	if err == nil {
+		_ = os.Remove(result.OutputFilePath)
+	}
+}
@@ -0,0 +1,315 @@
+package services
+
+import (
+	"encoding/json"
+	"image"
+	"path/filepath"
+
+	"gocv.io/x/gocv"
+)
+
+const (
+	FilterBlur    = "blur"
+	FilterSharpen = "sharpen"
+	FilterRedact  = "redact"
+)
+
+var Filters = []string{FilterBlur, FilterSharpen, FilterRedact}
+
+// redaction modes
+const (
+	RedactPixelate = "pixelate"
+	RedactBlur     = "blur"
+)
+
+// maximum number of redacted regions
+const MaxRedactRegions = 100
+
+var ErrInvalidFilter = InvalidOption("filter", "invalid filter (choose either blur, sharpen or redact)")
+
+var ErrAlphaFormatRequired = InvalidOption("format", "transparent outputs require the png, webp or avif format")
+
+// Filter is an image filter or adjustment, applied by Filter or as a pipeline step
+type Filter interface {
+	Validate() error
+	apply(src gocv.Mat, basePath string) (gocv.Mat, error)
+}
+
+// alphaFilter is implemented by the filters which may produce transparent pixels
+type alphaFilter interface {
+	needsAlpha() bool
+}
+
+// RequiresAlpha tells whether the filter produces transparent pixels, which only the png, webp and avif
+// formats can keep
+func RequiresAlpha(filter Filter) bool {
+	f, ok := filter.(alphaFilter)
+	return ok && f.needsAlpha()
+}
+
+// keepAlpha copies the alpha channel of src into dst (both BGRA), so that filters only alter the colors
+func keepAlpha(src gocv.Mat, dst *gocv.Mat) {
+	if src.Channels() != 4 || dst.Channels() != 4 {
+		return
+	}
+	srcChannels := gocv.Split(src)
+	dstChannels := gocv.Split(*dst)
+	filteredAlpha := dstChannels[3]
+	dstChannels[3] = srcChannels[3]
+	gocv.Merge(dstChannels, dst)
+	filteredAlpha.Close()
+	for _, channel := range append(srcChannels, dstChannels[:3]...) {
+		channel.Close()
+	}
+}
+
+// withBGR runs fn on a BGR copy of the image and converts the result back to the image channels, keeping
+// its alpha channel
+func withBGR(src gocv.Mat, fn func(bgr *gocv.Mat) error) (gocv.Mat, error) {
+	bgr := toBGR(src)
+	defer bgr.Close()
+	if err := fn(&bgr); err != nil {
+		return gocv.Mat{}, err
+	}
+	dst := gocv.NewMat()
+	switch src.Channels() {
+	case 4:
+		gocv.CvtColor(bgr, &dst, gocv.ColorBGRToBGRA)
+		keepAlpha(src, &dst)
+	case 1:
+		gocv.CvtColor(bgr, &dst, gocv.ColorBGRToGray)
+	default:
+		bgr.CopyTo(&dst)
+	}
+	return dst, nil
+}
+
+// BlurOptions applies a gaussian blur
+type BlurOptions struct {
+	// Radius is the standard deviation of the gaussian kernel (in pixel)
+	Radius float64 `json:"radius"`
+}
+
+// WithDefaults fills the radius (2)
+func (bo BlurOptions) WithDefaults() BlurOptions {
+	if bo.Radius == 0 {
+		bo.Radius = 2
+	}
+	return bo
+}
+
+func (bo BlurOptions) Validate() error {
+	if bo.Radius <= 0 || bo.Radius > 100 {
+		return InvalidOption("radius", "invalid radius (must be greater than 0 and up to 100)")
+	}
+	return nil
+}
+
+func (bo BlurOptions) apply(src gocv.Mat, basePath string) (gocv.Mat, error) {
+	dst := gocv.NewMat()
+	gocv.GaussianBlur(src, &dst, image.Point{}, bo.Radius, bo.Radius, gocv.BorderDefault)
+	return dst, nil
+}
+
+// SharpenOptions applies an unsharp mask: the difference between the image and its blurred copy is amplified
+type SharpenOptions struct {
+	// Amount is the strength of the sharpening (1 doubles the contrast of the edges)
+	Amount float64 `json:"amount"`
+	// Radius is the standard deviation of the blur (in pixel), which sets the size of the sharpened details
+	Radius float64 `json:"radius"`
+	// Threshold leaves the pixels differing from the blurred copy by up to threshold (0 - 255) untouched,
+	// so that flat areas and noise are not sharpened
+	Threshold float64 `json:"threshold"`
+}
+
+// WithDefaults fills the amount (1) and radius (1)
+func (so SharpenOptions) WithDefaults() SharpenOptions {
+	if so.Amount == 0 {
+		so.Amount = 1
+	}
+	if so.Radius == 0 {
+		so.Radius = 1
+	}
+	return so
+}
+
+func (so SharpenOptions) Validate() error {
+	if so.Amount <= 0 || so.Amount > 10 {
+		return InvalidOption("amount", "invalid amount (must be greater than 0 and up to 10)")
+	}
+	if so.Radius <= 0 || so.Radius > 100 {
+		return InvalidOption("radius", "invalid radius (must be greater than 0 and up to 100)")
+	}
+	if so.Threshold < 0 || so.Threshold > 255 {
+		return InvalidOption("threshold", "invalid threshold (must between 0 - 255)")
+	}
+	return nil
+}
+
+func (so SharpenOptions) apply(src gocv.Mat, basePath string) (gocv.Mat, error) {
+	blurred := gocv.NewMat()
+	defer blurred.Close()
+	gocv.GaussianBlur(src, &blurred, image.Point{}, so.Radius, so.Radius, gocv.BorderDefault)
+	dst := gocv.NewMat()
+	gocv.AddWeighted(src, 1+so.Amount, blurred, -so.Amount, 0, &dst)
+	if so.Threshold > 0 {
+		diff := gocv.NewMat()
+		defer diff.Close()
+		gocv.AbsDiff(src, blurred, &diff)
+		bgr := toBGR(diff)
+		defer bgr.Close()
+		gray := gocv.NewMat()
+		defer gray.Close()
+		gocv.CvtColor(bgr, &gray, gocv.ColorBGRToGray)
+		// restore the pixels below the threshold
+		mask := gocv.NewMat()
+		defer mask.Close()
+		gocv.Threshold(gray, &mask, float32(so.Threshold), 255, gocv.ThresholdBinaryInv)
+		src.CopyToWithMask(&dst, mask)
+	}
+	keepAlpha(src, &dst)
+	return dst, nil
+}
+
+// RedactOptions pixelates or blurs regions of the image, to hide licence plates or faces
+type RedactOptions struct {
+	Mode    string `json:"mode"`
+	Regions []Box  `json:"regions"`
+	// Faces also redacts the faces detected in the image
+	Faces bool `json:"faces"`
+	// BlockSize is the pixel size of the pixelate mode, Radius the blur radius of the blur mode. Both are
+	// relative to every region size when not set.
+	BlockSize int     `json:"block_size"`
+	Radius    float64 `json:"radius"`
+}
+
+// WithDefaults fills the mode (pixelate)
+func (ro RedactOptions) WithDefaults() RedactOptions {
+	if ro.Mode == "" {
+		ro.Mode = RedactPixelate
+	}
+	return ro
+}
+
+func (ro RedactOptions) Validate() error {
+	if ro.Mode != RedactPixelate && ro.Mode != RedactBlur {
+		return InvalidOption("mode", "invalid mode (choose either pixelate or blur)")
+	}
+	if len(ro.Regions) == 0 && !ro.Faces {
+		return InvalidOption("", "set either regions or faces")
+	}
+	if len(ro.Regions) > MaxRedactRegions {
+		return InvalidOption("regions", "invalid regions (up to %d regions)", MaxRedactRegions)
+	}
+	for i, region := range ro.Regions {
+		if region.X < 0 || region.Y < 0 || region.Width <= 0 || region.Height <= 0 {
+			return InvalidOption("regions", "invalid region %d (x and y must be positive, width and height greater than 0)", i)
+		}
+	}
+	if ro.BlockSize < 0 || ro.BlockSize > 1000 {
+		return InvalidOption("block_size", "invalid block_size (must between 0 - 1000)")
+	}
+	if ro.Radius < 0 || ro.Radius > 100 {
+		return InvalidOption("radius", "invalid radius (must between 0 - 100)")
+	}
+	return nil
+}
+
+func (ro RedactOptions) apply(src gocv.Mat, basePath string) (gocv.Mat, error) {
+	rects := []image.Rectangle{}
+	for _, region := range ro.Regions {
+		rects = append(rects, region.Rect())
+	}
+	if ro.Faces {
+		faces, err := DetectFaces(src, filepath.Join(basePath, FaceCascadePath))
+		if err != nil {
+			return gocv.Mat{}, err
+		}
+		rects = append(rects, faces...)
+	}
+	dst := src.Clone()
+	bounds := image.Rect(0, 0, src.Cols(), src.Rows())
+	for _, rect := range rects {
+		rect = rect.Intersect(bounds)
+		if rect.Empty() {
+			continue
+		}
+		region := dst.Region(rect)
+		ro.redact(region)
+		region.Close()
+	}
+	return dst, nil
+}
+
+// redact pixelates or blurs the region in place
+func (ro RedactOptions) redact(region gocv.Mat) {
+	side := min(region.Cols(), region.Rows())
+	redacted := gocv.NewMat()
+	defer redacted.Close()
+	if ro.Mode == RedactBlur {
+		radius := ro.Radius
+		if radius == 0 {
+			radius = float64(max(4, side/4))
+		}
+		gocv.GaussianBlur(region, &redacted, image.Point{}, radius, radius, gocv.BorderDefault)
+	} else {
+		block := ro.BlockSize
+		if block == 0 {
+			block = max(4, side/8)
+		}
+		// average every block, then scale them back up without interpolation
+		small := gocv.NewMat()
+		defer small.Close()
+		size := image.Pt(max(1, (region.Cols()+block-1)/block), max(1, (region.Rows()+block-1)/block))
+		gocv.Resize(region, &small, size, 0, 0, gocv.InterpolationArea)
+		gocv.Resize(small, &redacted, image.Pt(region.Cols(), region.Rows()), 0, 0, gocv.InterpolationNearestNeighbor)
+	}
+	redacted.CopyTo(&region)
+}
+
+// Filter applies the filter on the image and encodes it using the given options. An empty output format keeps
+// png inputs as png and encodes the others into jpeg (transparent outputs are always encoded into png).
+func (im *ImageManipulation) Filter(basePath string, inputPath string, outputPath string, filename string, filter Filter, encode EncodeOptions, debug bool) (CompressResult, error) {
+	if err := filter.Validate(); err != nil {
+		return CompressResult{}, err
+	}
+	if encode.Format == "" {
+		encode.Format = defaultOutputFormat(filename)
+		if RequiresAlpha(filter) {
+			encode.Format = FormatPng
+		}
+	}
+	if RequiresAlpha(filter) && !encode.SupportsAlpha() {
+		return CompressResult{}, ErrAlphaFormatRequired
+	}
+	return im.runSteps(basePath, inputPath, outputPath, filename, func(im *ImageManipulation) ([]pipelineStep, error) {
+		return []pipelineStep{filterStep(filter, im)}, nil
+	}, encode, debug)
+}
+
+func filterStep(filter Filter, im *ImageManipulation) pipelineStep {
+	return func(src gocv.Mat) (gocv.Mat, error) {
+		return filter.apply(src, im.options.BasePath)
+	}
+}
+
+// filterStepBuilder decodes the step parameters into the filter options
+func filterStepBuilder[T Filter](withDefaults func(T) T) stepBuilder {
+	return func(im *ImageManipulation, params json.RawMessage) (pipelineStep, error) {
+		var filter T
+		if err := decodeStepParams(params, &filter); err != nil {
+			return nil, err
+		}
+		filter = withDefaults(filter)
+		if err := filter.Validate(); err != nil {
+			return nil, err
+		}
+		return filterStep(filter, im), nil
+	}
+}
+
+func init() {
+	registerPipelineStep(FilterBlur, filterStepBuilder(BlurOptions.WithDefaults))
+	registerPipelineStep(FilterSharpen, filterStepBuilder(SharpenOptions.WithDefaults))
+	registerPipelineStep(FilterRedact, filterStepBuilder(RedactOptions.WithDefaults))
+}
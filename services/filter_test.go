@@ -0,0 +1,76 @@
+package services
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFilterValidate(t *testing.T) {
+	assert := assert.New(t)
+	assert.Nil(BlurOptions{}.WithDefaults().Validate(), "Default blur should be valid")
+	assert.NotNil(BlurOptions{Radius: -1}.Validate(), "Negative radius should be rejected")
+	assert.Nil(SharpenOptions{}.WithDefaults().Validate(), "Default sharpen should be valid")
+	assert.NotNil(SharpenOptions{Amount: 1, Radius: 1, Threshold: 300}.Validate(), "Threshold above 255 should be rejected")
+	assert.NotNil(RedactOptions{}.WithDefaults().Validate(), "Redact without regions nor faces should be rejected")
+	assert.Nil(RedactOptions{Faces: true}.WithDefaults().Validate(), "Redacting faces should be valid")
+	assert.NotNil(RedactOptions{Mode: "erase", Faces: true}.Validate(), "Unknown mode should be rejected")
+	assert.NotNil(RedactOptions{Regions: []Box{{X: 10, Y: 10}}}.WithDefaults().Validate(), "Empty region should be rejected")
+}
+
+func TestFilterPipelineSteps(t *testing.T) {
+	assert := assert.New(t)
+	pipeline := Pipeline{Steps: []PipelineStep{
+		{Op: "resize", Params: json.RawMessage(`{"width": 800, "height": 600}`)},
+		{Op: "sharpen", Params: json.RawMessage(`{"amount": 0.5, "threshold": 4}`)},
+		{Op: "redact", Params: json.RawMessage(`{"regions": [{"x": 10, "y": 10, "width": 120, "height": 40}], "mode": "blur"}`)},
+		{Op: "blur"},
+	}}
+	assert.Equal(nil, pipeline.Validate(), "Pipeline should be valid")
+	invalid := Pipeline{Steps: []PipelineStep{{Op: "blur", Params: json.RawMessage(`{"radius": 500}`)}}}
+	assert.ErrorIs(invalid.Validate(), ErrInvalidPipeline, "Invalid radius should be rejected")
+}
+
+func TestImageManipulationFilter(t *testing.T) {
+	assert := assert.New(t)
+	im := ImageManipulation{}
+	cwd, _ := os.Getwd()
+	rootDir := filepath.Clean(filepath.Join(cwd, ".."))
+	baseUploadPath := filepath.Join(rootDir, "storages", "test")
+	outputPath := filepath.Join(rootDir, "storages", "public")
+	filters := []Filter{
+		BlurOptions{Radius: 4},
+		SharpenOptions{Amount: 1.5, Radius: 2, Threshold: 3},
+		RedactOptions{Regions: []Box{{X: 10, Y: 10, Width: 200, Height: 100}}}.WithDefaults(),
+		RedactOptions{Mode: RedactBlur, Regions: []Box{{X: 10, Y: 10, Width: 200, Height: 100}}, Faces: true},
+	}
+
+	for _, filter := range filters {
+		result, err := im.Filter(rootDir, baseUploadPath, outputPath, "sample-test.png", filter, EncodeOptions{}, false)
+		assert.Equal(nil, err, "Error should be nil")
+		assert.Equal(FormatPng, result.Format, "Png inputs should stay png")
+		if err == nil {
+			_ = os.Remove(result.OutputFilePath)
+		}
+	}
+}
+
+func TestImageManipulationResizeSharpen(t *testing.T) {
+	assert := assert.New(t)
+	im := ImageManipulation{}
+	cwd, _ := os.Getwd()
+	rootDir := filepath.Clean(filepath.Join(cwd, ".."))
+	baseUploadPath := filepath.Join(rootDir, "storages", "test")
+	outputPath := filepath.Join(rootDir, "storages", "public")
+
+	output, err := im.ResizeWithOptions(rootDir, baseUploadPath, outputPath, "sample-test.png", 200, 200, true, SharpenOptions{}.WithDefaults(), EncodeOptions{}, false)
+	assert.Equal(nil, err, "Error should be nil")
+	if err == nil {
+		_ = os.Remove(output)
+	}
+	_, err2 := im.ResizeWithOptions(rootDir, baseUploadPath, outputPath, "sample-test.png", 200, 200, true, SharpenOptions{Amount: 20, Radius: 1}, EncodeOptions{}, false)
+	assert.NotNil(err2, "Error 2 should be about the invalid amount")
+}
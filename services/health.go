@@ -0,0 +1,56 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"runtime/pprof"
+
+	"gocv.io/x/gocv"
+)
+
+// Versions are the versions of the linked gocv and OpenCV libraries
+type Versions struct {
+	GoCV   string `json:"gocv"`
+	OpenCV string `json:"opencv"`
+}
+
+func LibraryVersions() Versions {
+	return Versions{GoCV: gocv.Version(), OpenCV: gocv.OpenCVVersion()}
+}
+
+// CheckWritable makes sure files can be created in the directory
+func CheckWritable(dir string) error {
+	f, err := os.CreateTemp(dir, partialOutputPrefix+"check-*")
+	if err != nil {
+		return fmt.Errorf("%s is not writable", dir)
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
+
+// CheckOpenCV makes sure the OpenCV library is loaded and usable, by encoding a tiny image
+func CheckOpenCV() error {
+	if gocv.OpenCVVersion() == "" {
+		return errors.New("opencv is not loaded")
+	}
+	img := gocv.NewMatWithSizeFromScalar(gocv.NewScalar(0, 0, 0, 0), 1, 1, gocv.MatTypeCV8UC3)
+	defer img.Close()
+	if _, err := encodeMat(img, EncodeOptions{Format: FormatPng}); err != nil {
+		return errors.New("opencv can not encode images")
+	}
+	return nil
+}
+
+// matProfileName is the profile of the open gocv Mats, which gocv registers when built with the matprofile tag
+const matProfileName = "gocv.io/x/gocv.Mat"
+
+// OpenMats returns the number of gocv Mats allocated and not closed yet. It is only known when the application
+// is built with -tags matprofile.
+func OpenMats() (int, bool) {
+	profile := pprof.Lookup(matProfileName)
+	if profile == nil {
+		return 0, false
+	}
+	return profile.Count(), true
+}
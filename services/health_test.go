@@ -0,0 +1,23 @@
+package services
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckWritable(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+	assert.Nil(CheckWritable(dir), "Error should be nil")
+	entries, _ := os.ReadDir(dir)
+	assert.Empty(entries, "The check file should be removed")
+
+	missing := filepath.Join(dir, "missing")
+	err := CheckWritable(missing)
+	if assert.NotNil(err, "Error should not be nil") {
+		assert.Equal(missing+" is not writable", err.Error())
+	}
+}
@@ -1,6 +1,7 @@
 package services
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"image"
@@ -10,9 +11,13 @@ import (
 	"strings"
 	"time"
 
+	"go.opentelemetry.io/otel/attribute"
 	"gocv.io/x/gocv"
 )
 
+// DefaultQuality is the encoding quality used when none is requested (configurable)
+var DefaultQuality = 80
+
 type ImageManipulationOptions struct {
 	BasePath        string  `json:"base_path"`
 	InputPath       string  `json:"input_path"`
@@ -41,7 +46,7 @@ func (imo *ImageManipulationOptions) init(basePath string, inputPath string, out
 		imo.Height = height
 	}
 	if quality == 0 {
-		imo.Quality = 80
+		imo.Quality = DefaultQuality
 	} else {
 		imo.Quality = quality
 	}
@@ -78,6 +83,8 @@ func (imo *ImageManipulationOptions) init(basePath string, inputPath string, out
 
 type ImageManipulation struct {
 	options ImageManipulationOptions
+	// ctx carries the request span, parent of the processing stage spans (see NewImageManipulation)
+	ctx context.Context
 }
 
 func (im *ImageManipulation) CalculateAspectRatioFit(srcWidth int, srcHeight int, targetWidth int, targetHeight int) map[string]float64 {
@@ -88,70 +95,187 @@ func (im *ImageManipulation) CalculateAspectRatioFit(srcWidth int, srcHeight int
 	return r
 }
 
+// resizeMat scales the image to width x height, or to fit inside it when keeping the aspect ratio
+func (im *ImageManipulation) resizeMat(src gocv.Mat, dst *gocv.Mat, width float64, height float64, keepAspecRatio bool) {
+	var fx, fy float64
+	if keepAspecRatio {
+		fitSize := im.CalculateAspectRatioFit(src.Cols(), src.Rows(), int(width), int(height))
+		// fmt.Printf("KEEP ASPECT RATIO: %#v \n", fitSize)
+		fx = float64(int(fitSize["width"])) / float64(src.Cols())
+		fy = float64(int(fitSize["height"])) / float64(src.Rows())
+	} else {
+		fx = width / float64(src.Cols())
+		fy = height / float64(src.Rows())
+	}
+
+	gocv.Resize(src, dst, image.Point{}, fx, fy, gocv.InterpolationCubic)
+}
+
 func (im *ImageManipulation) PngToJpeg(basePath string, inputPath string, outputPath string, filename string, debug bool) (string, error) {
+	return im.PngToJpegWithOptions(basePath, inputPath, outputPath, filename, EncodeOptions{Quality: 100}, debug)
+}
+
+// PngToJpegWithOptions converts the image into jpeg using the given jpeg options (the format is forced to jpeg)
+func (im *ImageManipulation) PngToJpegWithOptions(basePath string, inputPath string, outputPath string, filename string, encode EncodeOptions, debug bool) (string, error) {
+	encode.Format = FormatJpeg
+	if err := encode.Validate(); err != nil {
+		return "", err
+	}
 	// set options value
-	_, err := im.options.init(basePath, inputPath, outputPath, filename, -1, -1, 100, "jpeg", true, debug)
+	_, err := im.options.init(basePath, inputPath, outputPath, filename, -1, -1, encode.Quality, "jpeg", true, debug)
 	if err != nil {
 		return "", err
 	}
-	src := gocv.IMRead(im.options.InputFilePath, gocv.IMReadColor)
+	encode.Quality = im.options.Quality
+	src := im.readImage(im.options.InputFilePath, false)
+	defer src.Close()
 	if src.Empty() {
-		return "", errors.New("failed to read input file")
+		return "", errReadInput
 	}
 	// main logic
-	if ok := gocv.IMWriteWithParams(im.options.OutputFilePath, src, []int{gocv.IMWriteJpegQuality, im.options.Quality}); !ok {
-		return "", errors.New("failed to write output file")
+	if err := im.writeImage(im.options.OutputFilePath, src, encode.Params()); err != nil {
+		return "", err
 	}
 	return im.options.OutputFilePath, nil
 }
 
 func (im *ImageManipulation) Resize(basePath string, inputPath string, outputPath string, filename string, width float64, height float64, quality int, keepAspecRatio bool, debug bool) (string, error) {
+	return im.ResizeWithOptions(basePath, inputPath, outputPath, filename, width, height, keepAspecRatio, SharpenOptions{}, EncodeOptions{Quality: quality}, debug)
+}
+
+// ResizeWithOptions resizes the image, sharpens it (a zero SharpenOptions disables it) and encodes it using the
+// given options (an empty format keeps the source format)
+func (im *ImageManipulation) ResizeWithOptions(basePath string, inputPath string, outputPath string, filename string, width float64, height float64, keepAspecRatio bool, sharpen SharpenOptions, encode EncodeOptions, debug bool) (string, error) {
+	if sharpen != (SharpenOptions{}) {
+		if err := sharpen.Validate(); err != nil {
+			return "", err
+		}
+	}
 	// set options value
 	mt := strings.Split(filename, ".")
 	imgFormat := mt[len(mt)-1]
-	_, err := im.options.init(basePath, inputPath, outputPath, filename, width, height, quality, imgFormat, keepAspecRatio, debug)
+	if encode.Format != "" {
+		if err := encode.Validate(); err != nil {
+			return "", err
+		}
+		imgFormat = encode.Format
+	}
+	_, err := im.options.init(basePath, inputPath, outputPath, filename, width, height, encode.Quality, imgFormat, keepAspecRatio, debug)
 	if err != nil {
 		return "", err
 	}
+	encode.Quality = im.options.Quality
 	// main logic
-	src := gocv.IMRead(im.options.InputFilePath, gocv.IMReadColor)
+	src := im.readImage(im.options.InputFilePath, encode.Format != "" && encode.SupportsAlpha())
+	defer src.Close()
 	if src.Empty() {
-		return "", errors.New("failed to read input file")
+		return "", errReadInput
 	}
+	span := im.startTransform(src)
 	transform := gocv.NewMat()
-
-	var fx, fy float64
-	if im.options.KeepAspectRatio {
-		fitSize := im.CalculateAspectRatioFit(src.Cols(), src.Rows(), int(im.options.Width), int(im.options.Height))
-		// fmt.Printf("KEEP ASPECT RATIO: %#v \n", fitSize)
-		fx = float64(int(fitSize["width"])) / float64(src.Cols())
-		fy = float64(int(fitSize["height"])) / float64(src.Rows())
-	} else {
-		fx = im.options.Width / float64(src.Cols())
-		fy = im.options.Height / float64(src.Rows())
+	defer transform.Close()
+	im.resizeMat(src, &transform, im.options.Width, im.options.Height, im.options.KeepAspectRatio)
+	output := transform
+	if sharpen != (SharpenOptions{}) {
+		// compensate the softness of the cubic interpolation
+		sharpened, err := sharpen.apply(transform, im.options.BasePath)
+		if err != nil {
+			EndSpan(span, err)
+			return "", err
+		}
+		defer sharpened.Close()
+		output = sharpened
 	}
+	span.End()
 
-	gocv.Resize(src, &transform, image.Point{}, fx, fy, gocv.InterpolationCubic)
-
-	if ok := gocv.IMWrite(im.options.OutputFilePath, transform); !ok {
-		return "", errors.New("failed to write output file")
+	// the encoder defaults are used when no output format is requested
+	params := []int{}
+	if encode.Format != "" {
+		params = encode.Params()
+	}
+	if err := im.writeImage(im.options.OutputFilePath, output, params); err != nil {
+		return "", err
 	}
 	return im.options.OutputFilePath, nil
 }
 
 func (im *ImageManipulation) Compress(basePath string, inputPath string, outputPath string, filename string, quality int, debug bool) (string, error) {
+	result, err := im.CompressWithOptions(basePath, inputPath, outputPath, filename, EncodeOptions{Format: FormatJpeg, Quality: quality}, debug)
+	return result.OutputFilePath, err
+}
+
+// CompressWithOptions encodes the image using the given output options. With a size budget (MaxBytes) or a
+// similarity target (TargetSSIM) the quality becomes the upper bound of the search, and the result reports
+// the chosen one.
+func (im *ImageManipulation) CompressWithOptions(basePath string, inputPath string, outputPath string, filename string, encode EncodeOptions, debug bool) (CompressResult, error) {
+	if encode.Format == "" {
+		encode.Format = FormatJpeg
+	}
+	if err := encode.Validate(); err != nil {
+		return CompressResult{}, err
+	}
+	if (encode.MaxBytes > 0 || encode.TargetSSIM > 0) && encode.Quality == 0 {
+		encode.Quality = 100
+	}
 	// set options value
-	_, err := im.options.init(basePath, inputPath, outputPath, filename, -1, -1, quality, "jpeg", true, debug)
+	_, err := im.options.init(basePath, inputPath, outputPath, filename, -1, -1, encode.Quality, encode.Format, true, debug)
 	if err != nil {
-		return "", err
+		return CompressResult{}, err
 	}
+	encode.Quality = im.options.Quality
 	// main logic
-	src := gocv.IMRead(im.options.InputFilePath, gocv.IMReadColor)
+	src := im.readImage(im.options.InputFilePath, encode.SupportsAlpha())
+	defer src.Close()
 	if src.Empty() {
-		return "", errors.New("failed to read input file")
+		return CompressResult{}, errReadInput
 	}
-	if ok := gocv.IMWriteWithParams(im.options.OutputFilePath, src, []int{gocv.IMWriteJpegQuality, im.options.Quality}); !ok {
-		return "", errors.New("failed to write output file")
+	// the quality search encodes the image several times
+	span := im.startSpan("image.encode", append(matAttributes(src), attribute.String("image.format", encode.Format), attribute.Int("image.quality", encode.Quality))...)
+	var data []byte
+	result := CompressResult{Format: encode.Format, Quality: encode.Quality, Width: src.Cols(), Height: src.Rows()}
+	if encode.MaxBytes > 0 {
+		data, result, err = fitToBudget(src, encode)
+	} else if encode.TargetSSIM > 0 {
+		data, result.Quality, result.SSIM, err = lowestQualityMeeting(src, encode, encode.Quality, encode.TargetSSIM)
+	} else if encode.Format == FormatPng {
+		// png is lossless, the quality does not apply
+		result.Quality = 0
+		data, result.Colors, err = optimizePng(src, encode)
+	} else {
+		data, err = encodeMat(src, encode)
 	}
-	return im.options.OutputFilePath, nil
+	span.SetAttributes(attribute.Int("image.bytes", len(data)))
+	EndSpan(span, err)
+	if err != nil {
+		return CompressResult{}, err
+	}
+	if encode.MaxBytes > 0 || encode.TargetSSIM > 0 {
+		im.options.OutputFilePath = qualityOutputPath(im.options.OutputFilePath, encode.Quality, result.Quality)
+	}
+	if err := im.storeImage(im.options.OutputFilePath, data); err != nil {
+		return CompressResult{}, err
+	}
+	result.OutputFilePath = im.options.OutputFilePath
+	result.Bytes = len(data)
+	if info, err := os.Stat(im.options.InputFilePath); err == nil {
+		result.OriginalBytes = int(info.Size())
+		result.SavedBytes = result.OriginalBytes - result.Bytes
+	}
+	return result, nil
+}
+
+// ConvertImage re-encodes an image file into the format described by the encode options
+func ConvertImage(inputFilePath string, outputFilePath string, encode EncodeOptions) error {
+	if err := encode.Validate(); err != nil {
+		return err
+	}
+	if encode.Quality == 0 {
+		encode.Quality = DefaultQuality
+	}
+	src := readInput(inputFilePath, encode.SupportsAlpha())
+	defer src.Close()
+	if src.Empty() {
+		return errReadInput
+	}
+	return writeOutput(outputFilePath, src, encode.Params())
 }
@@ -1,9 +1,11 @@
 package services
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -170,3 +172,157 @@ func TestImageManipulationCompress(t *testing.T) {
 	assert.Equal("", process2, "Process2 should have false value")
 	assert.Equal("invalid file name", err2.Error(), "Error 2 should contain message")
 }
+
+func TestImageManipulationCompressWithOptions(t *testing.T) {
+	assert := assert.New(t)
+	im := ImageManipulation{}
+	cwd, _ := os.Getwd()
+	rootDir := filepath.Clean(filepath.Join(cwd, ".."))
+	baseUploadPath := filepath.Join(rootDir, "storages", "test")
+	outputPath := filepath.Join(rootDir, "storages", "public")
+
+	data := map[string]string{
+		"cwd":              rootDir,
+		"base_upload_path": baseUploadPath,
+		"upload_path":      baseUploadPath,
+		"output_path":      outputPath,
+		"filename":         "sample-test.png",
+	}
+	for _, format := range AvailableEncoders() {
+		result, err := im.CompressWithOptions(data["cwd"], data["upload_path"], data["output_path"], data["filename"], EncodeOptions{Format: format, Quality: 80}, false)
+		assert.Equal(nil, err, "Error should be nil")
+		assert.True(strings.HasSuffix(result.OutputFilePath, "."+format), "Output should use the requested format")
+		assert.Equal(80, result.Quality, "Result should report the quality")
+		fexist, _ := os.Stat(result.OutputFilePath)
+		assert.True(fexist != nil, "File should exist")
+		assert.Equal(int64(result.Bytes), fexist.Size(), "Result should report the output size")
+		// remove output file
+		e := os.Remove(result.OutputFilePath)
+		if e != nil {
+			panic(e)
+		}
+	}
+
+	process2, err2 := im.CompressWithOptions(data["cwd"], data["upload_path"], data["output_path"], data["filename"], EncodeOptions{Format: "tiff", Quality: 80}, false)
+	assert.Equal("", process2.OutputFilePath, "Process2 should have false value")
+	assert.True(errors.Is(err2, ErrUnsupportedOutputFormat), "Error 2 should be an unsupported output format error")
+
+	process3, err3 := im.CompressWithOptions(data["cwd"], data["upload_path"], data["output_path"], data["filename"], EncodeOptions{Format: FormatJpeg, Lossless: true}, false)
+	assert.Equal("", process3.OutputFilePath, "Process3 should have false value")
+	assert.Equal("lossless mode is not supported for jpeg", err3.Error(), "Error 3 should contain message")
+}
+
+func TestImageManipulationCompressMaxBytes(t *testing.T) {
+	assert := assert.New(t)
+	im := ImageManipulation{}
+	cwd, _ := os.Getwd()
+	rootDir := filepath.Clean(filepath.Join(cwd, ".."))
+	baseUploadPath := filepath.Join(rootDir, "storages", "test")
+	outputPath := filepath.Join(rootDir, "storages", "public")
+
+	data := map[string]string{
+		"cwd":              rootDir,
+		"base_upload_path": baseUploadPath,
+		"upload_path":      baseUploadPath,
+		"output_path":      outputPath,
+		"filename":         "sample-test.png",
+	}
+	result, err := im.CompressWithOptions(data["cwd"], data["upload_path"], data["output_path"], data["filename"], EncodeOptions{Format: FormatJpeg, MaxBytes: 30000}, false)
+	assert.Equal(nil, err, "Error should be nil")
+	assert.True(result.Bytes <= 30000, "Output should fit into the budget")
+	assert.True(result.Quality >= minBudgetQuality && result.Quality <= 100, "Result should report the chosen quality")
+	assert.True(strings.HasSuffix(result.OutputFilePath, fmt.Sprintf("-%d.jpeg", result.Quality)), "Output should be named after the chosen quality")
+	fexist, _ := os.Stat(result.OutputFilePath)
+	assert.True(fexist != nil, "File should exist")
+	// remove output file
+	e := os.Remove(result.OutputFilePath)
+	if e != nil {
+		panic(e)
+	}
+
+	_, err2 := im.CompressWithOptions(data["cwd"], data["upload_path"], data["output_path"], data["filename"], EncodeOptions{Format: FormatJpeg, MaxBytes: 100}, false)
+	assert.True(errors.Is(err2, ErrSizeBudgetTooSmall), "Error 2 should be a size budget error")
+
+	result3, err3 := im.CompressWithOptions(data["cwd"], data["upload_path"], data["output_path"], data["filename"], EncodeOptions{Format: FormatJpeg, MaxBytes: 3000, AllowDownscale: true}, false)
+	assert.Equal(nil, err3, "Error 3 should be nil")
+	assert.True(result3.Bytes <= 3000, "Output 3 should fit into the budget")
+	assert.True(result3.Width < 640, "Output 3 should be downscaled")
+	e = os.Remove(result3.OutputFilePath)
+	if e != nil {
+		panic(e)
+	}
+
+	// a quality below the lowest one of the search is tried as is
+	result5, err5 := im.CompressWithOptions(data["cwd"], data["upload_path"], data["output_path"], data["filename"], EncodeOptions{Format: FormatJpeg, Quality: 5, MaxBytes: 30000}, false)
+	assert.Equal(nil, err5, "Error 5 should be nil")
+	assert.Equal(5, result5.Quality, "Result 5 should keep the requested quality")
+	os.Remove(result5.OutputFilePath)
+
+	_, err4 := im.CompressWithOptions(data["cwd"], data["upload_path"], data["output_path"], data["filename"], EncodeOptions{Format: FormatPng, MaxBytes: 3000}, false)
+	assert.Equal("max_bytes requires a lossy output format (jpeg, webp or avif)", err4.Error(), "Error 4 should contain message")
+}
+
+func TestQualityOutputPath(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal("/public/photo-1710681145-62.jpeg", qualityOutputPath("/public/photo-1710681145-100.jpeg", 100, 62))
+	assert.Equal("/public/photo-1710681145-5.webp", qualityOutputPath("/public/photo-1710681145-5.webp", 5, 5))
+	assert.Equal("/public/photo.jpeg", qualityOutputPath("/public/photo.jpeg", 100, 62), "Other names should be kept")
+}
+
+func TestImageManipulationCompressTargetSSIM(t *testing.T) {
+	assert := assert.New(t)
+	im := ImageManipulation{}
+	cwd, _ := os.Getwd()
+	rootDir := filepath.Clean(filepath.Join(cwd, ".."))
+	baseUploadPath := filepath.Join(rootDir, "storages", "test")
+	outputPath := filepath.Join(rootDir, "storages", "public")
+
+	data := map[string]string{
+		"cwd":              rootDir,
+		"base_upload_path": baseUploadPath,
+		"upload_path":      baseUploadPath,
+		"output_path":      outputPath,
+		"filename":         "sample-test.png",
+	}
+	result, err := im.CompressWithOptions(data["cwd"], data["upload_path"], data["output_path"], data["filename"], EncodeOptions{Format: FormatJpeg, TargetSSIM: 0.95}, false)
+	assert.Equal(nil, err, "Error should be nil")
+	assert.True(result.SSIM >= 0.95, "Output should meet the similarity target")
+	assert.True(result.Quality >= 1 && result.Quality <= 100, "Result should report the chosen quality")
+	assert.Equal(result.OriginalBytes-result.Bytes, result.SavedBytes, "Result should report the byte savings")
+	// remove output file
+	e := os.Remove(result.OutputFilePath)
+	if e != nil {
+		panic(e)
+	}
+
+	_, err2 := im.CompressWithOptions(data["cwd"], data["upload_path"], data["output_path"], data["filename"], EncodeOptions{Format: FormatJpeg, TargetSSIM: 0.95, MaxBytes: 30000}, false)
+	assert.Equal("max_bytes and target_ssim can not be combined", err2.Error(), "Error 2 should contain message")
+
+	_, err3 := im.CompressWithOptions(data["cwd"], data["upload_path"], data["output_path"], data["filename"], EncodeOptions{Format: FormatJpeg, TargetSSIM: 1.5}, false)
+	assert.Equal("invalid target_ssim (must be greater than 0 and lower than 1)", err3.Error(), "Error 3 should contain message")
+}
+
+func TestImageManipulationPngToJpegWithOptions(t *testing.T) {
+	assert := assert.New(t)
+	im := ImageManipulation{}
+	cwd, _ := os.Getwd()
+	rootDir := filepath.Clean(filepath.Join(cwd, ".."))
+	baseUploadPath := filepath.Join(rootDir, "storages", "test")
+	outputPath := filepath.Join(rootDir, "storages", "public")
+
+	encode := EncodeOptions{Quality: 85, Progressive: true, Optimize: true, Subsampling: "444"}
+	process, err := im.PngToJpegWithOptions(rootDir, baseUploadPath, outputPath, "sample-test.png", encode, false)
+	assert.Equal(nil, err, "Error should be nil")
+	assert.True(strings.HasSuffix(process, "-85.jpeg"), "Output should be a jpeg file")
+	fexist, _ := os.Stat(process)
+	assert.True(fexist != nil, "File should exist")
+	// remove output file
+	e := os.Remove(process)
+	if e != nil {
+		panic(e)
+	}
+
+	process2, err2 := im.PngToJpegWithOptions(rootDir, baseUploadPath, outputPath, "sample-test.png", EncodeOptions{Subsampling: "410"}, false)
+	assert.Equal("", process2, "Process2 should have false value")
+	assert.Equal("invalid subsampling (choose either 444, 422 or 420)", err2.Error(), "Error 2 should contain message")
+}
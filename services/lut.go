@@ -0,0 +1,227 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// LutDirectory holds the uploaded 3D LUTs ({name}.cube files), relative to the base path
+var LutDirectory = filepath.Join("storages", "luts")
+
+// bounds of the 3D LUT size (number of points per axis)
+const (
+	MinLutSize = 2
+	MaxLutSize = 65
+)
+
+var (
+	ErrInvalidLut  = InvalidOption("file", "invalid cube LUT")
+	ErrLutNotFound = NewError(CodeNotFound, "lut", "LUT not found")
+	ErrLutExists   = NewError(CodeConflict, "name", "LUT already exists")
+	// ErrInvalidLutName rejects names which can't be used as file names
+	ErrInvalidLutName = InvalidOption("name", "invalid lut name (only letters, digits, - and _ are allowed)")
+)
+
+// CubeLUT is a 3D LUT in the Adobe / Resolve .cube format: Size^3 RGB output colors, the red index changing
+// the fastest
+type CubeLUT struct {
+	Title     string       `json:"title"`
+	Size      int          `json:"size"`
+	DomainMin [3]float64   `json:"-"`
+	DomainMax [3]float64   `json:"-"`
+	Table     [][3]float64 `json:"-"`
+}
+
+// parseCubeFloats parses the expected number of floats of a .cube line
+func parseCubeFloats(fields []string, n int) ([]float64, error) {
+	if len(fields) != n {
+		return nil, fmt.Errorf("expected %d values, got %d", n, len(fields))
+	}
+	r := make([]float64, n)
+	for i, field := range fields {
+		v, err := strconv.ParseFloat(field, 64)
+		if err != nil || math.IsNaN(v) || math.IsInf(v, 0) {
+			return nil, fmt.Errorf("invalid value %q", field)
+		}
+		r[i] = v
+	}
+	return r, nil
+}
+
+// ParseCubeLUT reads a 3D LUT in the .cube format (1D LUTs are not supported)
+func ParseCubeLUT(r io.Reader) (*CubeLUT, error) {
+	lut := &CubeLUT{DomainMax: [3]float64{1, 1, 1}}
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.Fields(text)
+		var err error
+		switch fields[0] {
+		case "TITLE":
+			lut.Title = strings.Trim(strings.TrimSpace(strings.TrimPrefix(text, "TITLE")), `"`)
+		case "LUT_1D_SIZE":
+			return nil, fmt.Errorf("%w: 1D LUTs are not supported", ErrInvalidLut)
+		case "LUT_3D_SIZE":
+			if len(fields) != 2 {
+				err = errors.New("expected 1 value")
+				break
+			}
+			lut.Size, err = strconv.Atoi(fields[1])
+			if err == nil && (lut.Size < MinLutSize || lut.Size > MaxLutSize) {
+				err = fmt.Errorf("size must between %d - %d", MinLutSize, MaxLutSize)
+			}
+		case "DOMAIN_MIN", "DOMAIN_MAX":
+			var values []float64
+			if values, err = parseCubeFloats(fields[1:], 3); err == nil {
+				if fields[0] == "DOMAIN_MIN" {
+					copy(lut.DomainMin[:], values)
+				} else {
+					copy(lut.DomainMax[:], values)
+				}
+			}
+		default:
+			// the keywords of other tools (LUT_3D_INPUT_RANGE, LUT_IN_VIDEO_RANGE...) are ignored
+			if unicode.IsLetter(rune(fields[0][0])) {
+				continue
+			}
+			var values []float64
+			if lut.Size == 0 {
+				err = errors.New("LUT_3D_SIZE must be set before the table")
+			} else if values, err = parseCubeFloats(fields, 3); err == nil {
+				lut.Table = append(lut.Table, [3]float64{values[0], values[1], values[2]})
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: line %d: %s", ErrInvalidLut, line, err.Error())
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidLut, err.Error())
+	}
+	if lut.Size == 0 || len(lut.Table) != lut.Size*lut.Size*lut.Size {
+		return nil, fmt.Errorf("%w: expected LUT_3D_SIZE^3 table entries", ErrInvalidLut)
+	}
+	for i := range lut.DomainMin {
+		if lut.DomainMax[i] <= lut.DomainMin[i] {
+			return nil, fmt.Errorf("%w: DOMAIN_MAX must be greater than DOMAIN_MIN", ErrInvalidLut)
+		}
+	}
+	return lut, nil
+}
+
+// Lookup maps an RGB color (0 - 1) through the LUT with a trilinear interpolation
+func (lut *CubeLUT) Lookup(rgb [3]float64) [3]float64 {
+	var index [3]int
+	var fraction [3]float64
+	last := lut.Size - 1
+	for i, v := range rgb {
+		position := (v - lut.DomainMin[i]) / (lut.DomainMax[i] - lut.DomainMin[i]) * float64(last)
+		position = min(float64(last), max(0, position))
+		index[i] = min(last-1, int(position))
+		fraction[i] = position - float64(index[i])
+	}
+	at := func(r, g, b int) [3]float64 {
+		return lut.Table[r+g*lut.Size+b*lut.Size*lut.Size]
+	}
+	var out [3]float64
+	for c := 0; c < 3; c++ {
+		// interpolate along red, then green, then blue
+		c00 := at(index[0], index[1], index[2])[c]*(1-fraction[0]) + at(index[0]+1, index[1], index[2])[c]*fraction[0]
+		c10 := at(index[0], index[1]+1, index[2])[c]*(1-fraction[0]) + at(index[0]+1, index[1]+1, index[2])[c]*fraction[0]
+		c01 := at(index[0], index[1], index[2]+1)[c]*(1-fraction[0]) + at(index[0]+1, index[1], index[2]+1)[c]*fraction[0]
+		c11 := at(index[0], index[1]+1, index[2]+1)[c]*(1-fraction[0]) + at(index[0]+1, index[1]+1, index[2]+1)[c]*fraction[0]
+		c0 := c00*(1-fraction[1]) + c10*fraction[1]
+		c1 := c01*(1-fraction[1]) + c11*fraction[1]
+		out[c] = c0*(1-fraction[2]) + c1*fraction[2]
+	}
+	return out
+}
+
+// applyBGR maps the pixels of a BGR (3 bytes per pixel) buffer through the LUT, in place
+func (lut *CubeLUT) applyBGR(pix []byte) {
+	for i := 0; i+2 < len(pix); i += 3 {
+		out := lut.Lookup([3]float64{float64(pix[i+2]) / 255, float64(pix[i+1]) / 255, float64(pix[i]) / 255})
+		pix[i], pix[i+1], pix[i+2] = clampByte(out[2]*255), clampByte(out[1]*255), clampByte(out[0]*255)
+	}
+}
+
+// lutPath returns the path of the stored LUT
+func lutPath(basePath string, name string) string {
+	return filepath.Join(basePath, LutDirectory, name+".cube")
+}
+
+// validateLutName checks that the name can be used as a file name
+func validateLutName(name string) error {
+	if !namePattern.MatchString(name) {
+		return ErrInvalidLutName
+	}
+	return nil
+}
+
+// SaveLut validates the .cube data and stores it under the name. Existing LUTs are only overwritten when
+// replace is set.
+func SaveLut(basePath string, name string, data []byte, replace bool) (*CubeLUT, error) {
+	if err := validateLutName(name); err != nil {
+		return nil, err
+	}
+	lut, err := ParseCubeLUT(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	path := lutPath(basePath, name)
+	if _, err := os.Stat(path); err == nil && !replace {
+		return nil, ErrLutExists
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	// a LUT being replaced stays readable until the new one is complete
+	if err := writeOutputBytes(path, data); err != nil {
+		return nil, err
+	}
+	return lut, nil
+}
+
+// LoadLut reads the LUT stored under the name
+func LoadLut(basePath string, name string) (*CubeLUT, error) {
+	if err := validateLutName(name); err != nil {
+		return nil, err
+	}
+	file, err := os.Open(lutPath(basePath, name))
+	if err != nil {
+		return nil, ErrLutNotFound
+	}
+	defer file.Close()
+	return ParseCubeLUT(file)
+}
+
+// ListLuts returns the sorted names of the stored LUTs
+func ListLuts(basePath string) ([]string, error) {
+	paths, err := filepath.Glob(filepath.Join(basePath, LutDirectory, "*.cube"))
+	if err != nil {
+		return nil, err
+	}
+	r := []string{}
+	for _, path := range paths {
+		if !IsPartialOutput(path) {
+			r = append(r, strings.TrimSuffix(filepath.Base(path), ".cube"))
+		}
+	}
+	sort.Strings(r)
+	return r, nil
+}
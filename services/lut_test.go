@@ -0,0 +1,88 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// cubeLUT builds a .cube file of the given size mapping every color through fn
+func cubeLUT(size int, fn func(rgb [3]float64) [3]float64) string {
+	var b strings.Builder
+	b.WriteString("# generated\nTITLE \"Test LUT\"\nLUT_3D_SIZE " + fmt.Sprint(size) + "\n")
+	for blue := 0; blue < size; blue++ {
+		for green := 0; green < size; green++ {
+			for red := 0; red < size; red++ {
+				last := float64(size - 1)
+				out := fn([3]float64{float64(red) / last, float64(green) / last, float64(blue) / last})
+				b.WriteString(fmt.Sprintf("%.6f %.6f %.6f\n", out[0], out[1], out[2]))
+			}
+		}
+	}
+	return b.String()
+}
+
+func TestParseCubeLUT(t *testing.T) {
+	assert := assert.New(t)
+	lut, err := ParseCubeLUT(strings.NewReader(cubeLUT(3, func(rgb [3]float64) [3]float64 { return rgb })))
+	assert.Equal(nil, err, "Error should be nil")
+	assert.Equal("Test LUT", lut.Title, "Title should be read")
+	assert.Equal(3, lut.Size, "Size should be 3")
+	assert.Len(lut.Table, 27, "Table should have 27 entries")
+	lut2, err2 := ParseCubeLUT(strings.NewReader("LUT_3D_INPUT_RANGE 0 1\nLUT_IN_VIDEO_RANGE\n" + cubeLUT(2, func(rgb [3]float64) [3]float64 { return rgb })))
+	assert.Equal(nil, err2, "Error 2 should be nil, unknown keywords being ignored")
+	assert.Len(lut2.Table, 8, "Table 2 should have 8 entries")
+
+	invalid := []string{
+		"LUT_1D_SIZE 16\n",
+		"LUT_3D_SIZE 2\n0 0 0\n",
+		"LUT_3D_SIZE 200\n",
+		"0 0 0\nLUT_3D_SIZE 2\n",
+		"LUT_3D_SIZE 2\n0 0 zero\n",
+		"DOMAIN_MIN 1 1 1\n" + cubeLUT(2, func(rgb [3]float64) [3]float64 { return rgb }),
+	}
+	for i, data := range invalid {
+		_, err := ParseCubeLUT(strings.NewReader(data))
+		assert.ErrorIs(err, ErrInvalidLut, fmt.Sprintf("Error %d should be about the invalid LUT", i))
+	}
+}
+
+func TestCubeLUTLookup(t *testing.T) {
+	assert := assert.New(t)
+	identity, _ := ParseCubeLUT(strings.NewReader(cubeLUT(5, func(rgb [3]float64) [3]float64 { return rgb })))
+	out := identity.Lookup([3]float64{0.3, 0.55, 0.9})
+	assert.InDelta(0.3, out[0], 1e-6, "Identity should keep red")
+	assert.InDelta(0.55, out[1], 1e-6, "Identity should keep green")
+	assert.InDelta(0.9, out[2], 1e-6, "Identity should keep blue")
+
+	swap, _ := ParseCubeLUT(strings.NewReader(cubeLUT(2, func(rgb [3]float64) [3]float64 { return [3]float64{rgb[2], rgb[1], rgb[0]} })))
+	pix := []byte{10, 20, 200} // BGR
+	swap.applyBGR(pix)
+	assert.Equal([]byte{200, 20, 10}, pix, "Red and blue should be swapped")
+}
+
+func TestSaveLut(t *testing.T) {
+	assert := assert.New(t)
+	basePath := t.TempDir()
+	data := []byte(cubeLUT(2, func(rgb [3]float64) [3]float64 { return rgb }))
+
+	lut, err := SaveLut(basePath, "warm-01", data, false)
+	assert.Equal(nil, err, "Error should be nil")
+	assert.Equal(2, lut.Size, "Size should be 2")
+	_, err2 := SaveLut(basePath, "warm-01", data, false)
+	assert.ErrorIs(err2, ErrLutExists, "Error 2 should be about the existing LUT")
+	_, err3 := SaveLut(basePath, "warm-01", data, true)
+	assert.Equal(nil, err3, "Error 3 should be nil")
+	_, err4 := SaveLut(basePath, "../warm", data, false)
+	assert.ErrorIs(err4, ErrInvalidLutName, "Error 4 should be about the invalid name")
+
+	names, err5 := ListLuts(basePath)
+	assert.Equal(nil, err5, "Error 5 should be nil")
+	assert.Equal([]string{"warm-01"}, names, "Stored LUT should be listed")
+	_, err6 := LoadLut(basePath, "warm-01")
+	assert.Equal(nil, err6, "Error 6 should be nil")
+	_, err7 := LoadLut(basePath, "cold")
+	assert.ErrorIs(err7, ErrLutNotFound, "Error 7 should be about the missing LUT")
+}
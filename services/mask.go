@@ -0,0 +1,113 @@
+package services
+
+import (
+	"image"
+	"image/color"
+	"slices"
+
+	"gocv.io/x/gocv"
+)
+
+// mask shapes: rounded rounds the corners of the image, circle cuts the largest centered circle out of it
+const (
+	MaskRounded = "rounded"
+	MaskCircle  = "circle"
+)
+
+var Masks = []string{MaskRounded, MaskCircle}
+
+// the default corner radius, relative to the shortest side of the image
+const defaultMaskRadiusRatio = 0.1
+
+// MaskOptions makes the pixels outside of the shape transparent
+type MaskOptions struct {
+	Shape string `json:"shape"`
+	// Radius is the corner radius of the rounded shape (in pixels, 10% of the shortest side when not set)
+	Radius int `json:"radius"`
+}
+
+// WithDefaults fills the shape (rounded)
+func (mo MaskOptions) WithDefaults() MaskOptions {
+	if mo.Shape == "" {
+		mo.Shape = MaskRounded
+	}
+	return mo
+}
+
+func (mo MaskOptions) Validate() error {
+	if !slices.Contains(Masks, mo.Shape) {
+		return InvalidOption("shape", "invalid shape (choose either rounded or circle)")
+	}
+	if mo.Shape != MaskRounded && mo.Radius != 0 {
+		return InvalidOption("radius", "invalid radius (only used by the rounded shape)")
+	}
+	if mo.Radius < 0 || mo.Radius > MaxPadding {
+		return InvalidOption("radius", "invalid radius (must between 0 - %d)", MaxPadding)
+	}
+	return nil
+}
+
+func (mo MaskOptions) needsAlpha() bool {
+	return true
+}
+
+// shape draws the opaque area of a width x height mask (anti-aliased)
+func (mo MaskOptions) shape(width int, height int) gocv.Mat {
+	mask := gocv.NewMatWithSizeFromScalar(gocv.NewScalar(0, 0, 0, 0), height, width, gocv.MatTypeCV8U)
+	opaque := color.RGBA{R: 255, G: 255, B: 255, A: 255}
+	if mo.Shape == MaskCircle {
+		gocv.CircleWithParams(&mask, image.Pt(width/2, height/2), min(width, height)/2, opaque, -1, gocv.LineAA, 0)
+		return mask
+	}
+	radius := mo.Radius
+	if radius == 0 {
+		radius = int(float64(min(width, height)) * defaultMaskRadiusRatio)
+	}
+	radius = min(radius, (min(width, height)-1)/2)
+	// the rectangles are inclusive, the corners are filled by a circle each
+	gocv.Rectangle(&mask, image.Rect(radius, 0, width-1-radius, height-1), opaque, -1)
+	gocv.Rectangle(&mask, image.Rect(0, radius, width-1, height-1-radius), opaque, -1)
+	for _, center := range []image.Point{
+		image.Pt(radius, radius), image.Pt(width-1-radius, radius),
+		image.Pt(radius, height-1-radius), image.Pt(width-1-radius, height-1-radius),
+	} {
+		gocv.CircleWithParams(&mask, center, radius, opaque, -1, gocv.LineAA, 0)
+	}
+	return mask
+}
+
+func (mo MaskOptions) apply(src gocv.Mat, basePath string) (gocv.Mat, error) {
+	img := src
+	if mo.Shape == MaskCircle {
+		// the circle is cut out of the centered square
+		side := min(src.Cols(), src.Rows())
+		rect, _ := CropRect(src.Cols(), src.Rows(), side, side, GravityCenter)
+		img = cropMat(src, rect)
+		defer img.Close()
+	}
+	dst := gocv.NewMat()
+	switch img.Channels() {
+	case 4:
+		img.CopyTo(&dst)
+	case 1:
+		gocv.CvtColor(img, &dst, gocv.ColorGrayToBGRA)
+	default:
+		gocv.CvtColor(img, &dst, gocv.ColorBGRToBGRA)
+	}
+	mask := mo.shape(dst.Cols(), dst.Rows())
+	defer mask.Close()
+	channels := gocv.Split(dst)
+	defer func() {
+		for _, channel := range channels {
+			channel.Close()
+		}
+	}()
+	// transparent source pixels stay transparent
+	gocv.Min(channels[3], mask, &channels[3])
+	gocv.Merge(channels, &dst)
+	return dst, nil
+}
+
+func init() {
+	registerPipelineStep("mask", filterStepBuilder(MaskOptions.WithDefaults))
+}
@@ -0,0 +1,46 @@
+package services
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMaskValidate(t *testing.T) {
+	assert := assert.New(t)
+	assert.Nil(MaskOptions{}.WithDefaults().Validate(), "Rounded mask should be the default")
+	assert.Nil(MaskOptions{Shape: MaskCircle}.WithDefaults().Validate(), "Circle mask should be valid")
+	assert.NotNil(MaskOptions{Shape: "star"}.WithDefaults().Validate(), "Unknown shape should be rejected")
+	assert.NotNil(MaskOptions{Shape: MaskCircle, Radius: 10}.WithDefaults().Validate(), "Radius is only used by rounded masks")
+	assert.NotNil(MaskOptions{Radius: -1}.WithDefaults().Validate(), "Negative radius should be rejected")
+	assert.True(RequiresAlpha(MaskOptions{}), "Masks should require a transparent output")
+	assert.False(RequiresAlpha(BlurOptions{}), "Filters should not require a transparent output")
+}
+
+func TestImageManipulationMask(t *testing.T) {
+	assert := assert.New(t)
+	im := ImageManipulation{}
+	cwd, _ := os.Getwd()
+	rootDir := filepath.Clean(filepath.Join(cwd, ".."))
+	baseUploadPath := filepath.Join(rootDir, "storages", "test")
+	outputPath := filepath.Join(rootDir, "storages", "public")
+
+	result, err := im.Filter(rootDir, baseUploadPath, outputPath, "sample-test.png", MaskOptions{Radius: 24}.WithDefaults(), EncodeOptions{}, false)
+	assert.Equal(nil, err, "Error should be nil")
+	assert.Equal(FormatPng, result.Format, "Masks should be encoded into png by default")
+	if err == nil {
+		_ = os.Remove(result.OutputFilePath)
+	}
+
+	result2, err2 := im.Filter(rootDir, baseUploadPath, outputPath, "sample-test.png", MaskOptions{Shape: MaskCircle}, EncodeOptions{Format: FormatWebp}, false)
+	assert.Equal(nil, err2, "Error 2 should be nil")
+	assert.Equal(result2.Width, result2.Height, "Circle masks should be square")
+	if err2 == nil {
+		_ = os.Remove(result2.OutputFilePath)
+	}
+
+	_, err3 := im.Filter(rootDir, baseUploadPath, outputPath, "sample-test.png", MaskOptions{Shape: MaskCircle}, EncodeOptions{Format: FormatJpeg}, false)
+	assert.ErrorIs(err3, ErrAlphaFormatRequired, "Error 3 should be about the transparent output")
+}
@@ -0,0 +1,125 @@
+package services
+
+import (
+	"image"
+	"image/color"
+	"image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"os"
+	"strconv"
+	"strings"
+
+	_ "golang.org/x/image/bmp"
+)
+
+// FormatAuto picks the output format from the client Accept header
+const FormatAuto = "auto"
+
+const FormatGif = "gif"
+
+var formatMediaTypes = map[string]string{
+	FormatAvif: "image/avif",
+	FormatWebp: "image/webp",
+	FormatPng:  "image/png",
+	FormatJpeg: "image/jpeg",
+	FormatGif:  "image/gif",
+}
+
+// parseAccept returns the quality value of every media type listed in an Accept header
+func parseAccept(accept string) map[string]float64 {
+	r := map[string]float64{}
+	for _, part := range strings.Split(accept, ",") {
+		fields := strings.Split(part, ";")
+		mediaType := strings.ToLower(strings.TrimSpace(fields[0]))
+		if mediaType == "" {
+			continue
+		}
+		q := 1.0
+		for _, param := range fields[1:] {
+			kv := strings.SplitN(strings.TrimSpace(param), "=", 2)
+			if len(kv) == 2 && strings.ToLower(kv[0]) == "q" {
+				if v, err := strconv.ParseFloat(kv[1], 64); err == nil {
+					q = v
+				}
+			}
+		}
+		r[mediaType] = q
+	}
+	return r
+}
+
+// NegotiateFormat picks the best available output format allowed by the client Accept header.
+// Modern formats are only chosen when the client names them explicitly (wildcards are not
+// enough), otherwise it falls back to png for transparent images and jpeg for everything else.
+// Animated images become animated webp when the client names it, and keep their gif format otherwise.
+func NegotiateFormat(accept string, hasAlpha bool, animated bool) string {
+	accepted := parseAccept(accept)
+	if animated {
+		if q, ok := accepted[formatMediaTypes[FormatWebp]]; ok && q > 0 && q >= accepted[formatMediaTypes[FormatGif]] && IsEncoderAvailable(FormatWebp) {
+			return FormatWebp
+		}
+		return FormatGif
+	}
+	fallback := FormatJpeg
+	if hasAlpha {
+		fallback = FormatPng
+	}
+	best := ""
+	bestQ := 0.0
+	// ordered by preference, ties on the quality value keep the first one
+	for _, format := range []string{FormatAvif, FormatWebp} {
+		q, ok := accepted[formatMediaTypes[format]]
+		if !ok || q <= bestQ || !IsEncoderAvailable(format) {
+			continue
+		}
+		best = format
+		bestQ = q
+	}
+	if best == "" || accepted[formatMediaTypes[fallback]] > bestQ {
+		return fallback
+	}
+	return best
+}
+
+// NegotiateFileFormat inspects the input file (alpha channel, animation) and negotiates its
+// output format. Lossless output falls back to png, just like transparent images.
+func NegotiateFileFormat(accept string, inputFilePath string, lossless bool) string {
+	hasAlpha, _ := HasAlpha(inputFilePath)
+	return NegotiateFormat(accept, hasAlpha || lossless, IsAnimated(inputFilePath))
+}
+
+// HasAlpha tells whether the image file uses a color model with transparency
+func HasAlpha(inputFilePath string) (bool, error) {
+	f, err := os.Open(inputFilePath)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	config, _, err := image.DecodeConfig(f)
+	if err != nil {
+		return false, err
+	}
+	switch cm := config.ColorModel.(type) {
+	case color.Palette:
+		for _, c := range cm {
+			if _, _, _, a := c.RGBA(); a != 0xffff {
+				return true, nil
+			}
+		}
+		return false, nil
+	default:
+		return cm == color.NRGBAModel || cm == color.RGBAModel || cm == color.NRGBA64Model || cm == color.RGBA64Model || cm == color.AlphaModel || cm == color.Alpha16Model, nil
+	}
+}
+
+// IsAnimated tells whether the file is a gif with more than one frame
+func IsAnimated(inputFilePath string) bool {
+	f, err := os.Open(inputFilePath)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	g, err := gif.DecodeAll(f)
+	return err == nil && len(g.Image) > 1
+}
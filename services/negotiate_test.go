@@ -0,0 +1,44 @@
+package services
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseAccept(t *testing.T) {
+	assert := assert.New(t)
+	accepted := parseAccept("image/avif,image/webp;q=0.9, image/apng,*/*;q=0.8")
+	assert.Equal(1.0, accepted["image/avif"], "AVIF should have the default quality value")
+	assert.Equal(0.9, accepted["image/webp"], "WebP should have quality value 0.9")
+	assert.Equal(0.8, accepted["*/*"], "Wildcard should have quality value 0.8")
+	assert.Empty(parseAccept(""), "Empty header should not accept anything")
+}
+
+func TestNegotiateFormat(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal(FormatJpeg, NegotiateFormat("*/*", false, false), "Wildcard should fall back to jpeg")
+	assert.Equal(FormatPng, NegotiateFormat("image/*", true, false), "Wildcard should fall back to png for transparent images")
+	assert.Equal(FormatGif, NegotiateFormat("*/*", false, true), "Animated images should keep gif")
+	assert.Equal(FormatJpeg, NegotiateFormat("image/webp;q=0,*/*", false, false), "Refused format should not be chosen")
+	if IsEncoderAvailable(FormatWebp) {
+		assert.Equal(FormatWebp, NegotiateFormat("image/webp,*/*", false, false), "WebP should be chosen when accepted")
+		assert.Equal(FormatWebp, NegotiateFormat("image/webp,*/*", true, false), "WebP should be chosen for transparent images")
+		assert.Equal(FormatWebp, NegotiateFormat("image/webp,*/*", false, true), "Animated webp should be chosen when accepted")
+	}
+	if IsEncoderAvailable(FormatAvif) {
+		assert.Equal(FormatAvif, NegotiateFormat("image/avif,image/webp,*/*", false, false), "AVIF should be preferred")
+	}
+}
+
+func TestHasAlpha(t *testing.T) {
+	assert := assert.New(t)
+	cwd, _ := os.Getwd()
+	rootDir := filepath.Clean(filepath.Join(cwd, ".."))
+	_, err := HasAlpha(filepath.Join(rootDir, "storages", "test", "sample-test.png"))
+	assert.Equal(nil, err, "Error should be nil")
+	_, err2 := HasAlpha(filepath.Join(rootDir, "storages", "test", "missing.png"))
+	assert.NotEqual(nil, err2, "Error 2 should not be nil")
+}
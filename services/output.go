@@ -0,0 +1,62 @@
+package services
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// partialOutputPrefix starts the names of the outputs being written
+const partialOutputPrefix = ".partial-"
+
+// writeAtomic writes the output into a temporary file of the same directory, renamed once complete: an
+// interrupted write never leaves a truncated output behind. The temporary file name keeps the extension, which
+// selects the OpenCV encoder.
+func writeAtomic(path string, write func(tmpPath string) error) error {
+	dir, name := filepath.Split(path)
+	tmp, err := os.CreateTemp(dir, partialOutputPrefix+"*-"+name)
+	if err != nil {
+		return errors.New("failed to write output file")
+	}
+	tmpPath := tmp.Name()
+	tmp.Close()
+	if err := write(tmpPath); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := os.Chmod(tmpPath, 0o644); err != nil {
+		os.Remove(tmpPath)
+		return errors.New("failed to write output file")
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return errors.New("failed to write output file")
+	}
+	return nil
+}
+
+// IsPartialOutput tells whether the file is an output being written
+func IsPartialOutput(path string) bool {
+	return strings.HasPrefix(filepath.Base(path), partialOutputPrefix)
+}
+
+// CleanPartialOutputs removes the outputs left half-written under the directory (by a killed process or an
+// operation interrupted by the shutdown) and returns how many were removed
+func CleanPartialOutputs(dir string) (int, error) {
+	removed := 0
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.Type().IsRegular() && IsPartialOutput(path) {
+			if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return err
+			}
+			removed++
+		}
+		return nil
+	})
+	return removed, err
+}
@@ -0,0 +1,50 @@
+package services
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteOutputBytesAtomic(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+	path := filepath.Join(dir, "output.png")
+	os.WriteFile(path, []byte("previous"), 0o644)
+
+	assert.Nil(writeOutputBytes(path, []byte("complete")), "Error should be nil")
+	data, _ := os.ReadFile(path)
+	assert.Equal("complete", string(data))
+	info, _ := os.Stat(path)
+	assert.Equal(os.FileMode(0o644), info.Mode().Perm(), "Output should be readable")
+
+	// a failed write keeps the previous output and leaves no partial output behind
+	err := writeAtomic(path, func(tmpPath string) error {
+		os.WriteFile(tmpPath, []byte("trunc"), 0o644)
+		return errors.New("failed to write output file")
+	})
+	assert.NotNil(err, "Error should not be nil")
+	data, _ = os.ReadFile(path)
+	assert.Equal("complete", string(data))
+	entries, _ := os.ReadDir(dir)
+	assert.Equal(1, len(entries), "Partial output should be removed")
+}
+
+func TestCleanPartialOutputs(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+	os.Mkdir(filepath.Join(dir, "frames"), 0o755)
+	for _, name := range []string{"output.png", partialOutputPrefix + "123-output.png", filepath.Join("frames", partialOutputPrefix+"456-frame.png")} {
+		os.WriteFile(filepath.Join(dir, name), []byte("data"), 0o644)
+	}
+	removed, err := CleanPartialOutputs(dir)
+	assert.Nil(err, "Error should be nil")
+	assert.Equal(2, removed)
+	_, err = os.Stat(filepath.Join(dir, "output.png"))
+	assert.Nil(err, "Complete outputs should be kept")
+	assert.True(IsPartialOutput(filepath.Join(dir, partialOutputPrefix+"1-a.jpeg")))
+	assert.False(IsPartialOutput(filepath.Join(dir, "a.jpeg")))
+}
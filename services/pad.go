@@ -0,0 +1,183 @@
+package services
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+
+	"gocv.io/x/gocv"
+)
+
+// padding fill modes: color fills with a solid color, blur with a blurred mirror of the image and mirror with
+// a sharp mirror of the image
+const (
+	PadFillColor  = "color"
+	PadFillBlur   = "blur"
+	PadFillMirror = "mirror"
+)
+
+var PadFills = []string{PadFillColor, PadFillBlur, PadFillMirror}
+
+// ColorTransparent pads with fully transparent pixels (which requires an output format keeping the alpha channel)
+const ColorTransparent = "transparent"
+
+const (
+	defaultPadColor = "#ffffff"
+	// MaxPadding bounds every fixed border (in pixels)
+	MaxPadding = 4096
+	// MaxCanvasSide bounds the sides of the padded canvas (in pixels)
+	MaxCanvasSide = 16384
+)
+
+var (
+	ErrInvalidAspectRatio = InvalidOption("aspect", "invalid aspect (use width:height, e.g. 1:1 or 4:3, between 1:10 - 10:1)")
+	ErrCanvasTooLarge     = InvalidOption("", "invalid padding (the canvas sides must be up to %d pixels)", MaxCanvasSide)
+)
+
+// ParseAspectRatio parses an aspect ratio written as width:height (e.g. 16:9) or as a number (e.g. 1.5)
+func ParseAspectRatio(value string) (float64, error) {
+	width, height, found := strings.Cut(value, ":")
+	ratio, err := strconv.ParseFloat(strings.TrimSpace(width), 64)
+	if err == nil && found {
+		var h float64
+		if h, err = strconv.ParseFloat(strings.TrimSpace(height), 64); err == nil {
+			ratio /= h
+		}
+	}
+	if err != nil || math.IsNaN(ratio) || ratio < 0.1 || ratio > 10 {
+		return 0, ErrInvalidAspectRatio
+	}
+	return ratio, nil
+}
+
+// PadOptions extends the canvas around the image, to a target aspect ratio and / or by fixed borders
+type PadOptions struct {
+	// Aspect is the target aspect ratio (width:height), reached by extending the shortest side of the canvas
+	Aspect string `json:"aspect"`
+	// Gravity places the image on the canvas extended to the aspect ratio
+	Gravity string `json:"gravity"`
+	// Top, Right, Bottom and Left are fixed borders (in pixels), added after the aspect ratio padding
+	Top    int    `json:"top"`
+	Right  int    `json:"right"`
+	Bottom int    `json:"bottom"`
+	Left   int    `json:"left"`
+	Fill   string `json:"fill"`
+	// Color is the color of the color fill (#rrggbb or transparent)
+	Color string `json:"color"`
+}
+
+// WithDefaults fills the gravity (center), the fill (color) and its color (white)
+func (po PadOptions) WithDefaults() PadOptions {
+	if po.Gravity == "" {
+		po.Gravity = GravityCenter
+	}
+	if po.Fill == "" {
+		po.Fill = PadFillColor
+	}
+	if po.Fill == PadFillColor && po.Color == "" {
+		po.Color = defaultPadColor
+	}
+	return po
+}
+
+func (po PadOptions) Validate() error {
+	if po.Aspect == "" && po.Top == 0 && po.Right == 0 && po.Bottom == 0 && po.Left == 0 {
+		return InvalidOption("", "set either aspect or borders (top, right, bottom, left)")
+	}
+	if po.Aspect != "" {
+		if _, err := ParseAspectRatio(po.Aspect); err != nil {
+			return err
+		}
+	}
+	if !slices.Contains(Gravities, po.Gravity) {
+		return ErrInvalidGravity
+	}
+	for _, border := range []int{po.Top, po.Right, po.Bottom, po.Left} {
+		if border < 0 || border > MaxPadding {
+			return InvalidOption("", "invalid top, right, bottom or left (must between 0 - %d)", MaxPadding)
+		}
+	}
+	if !slices.Contains(PadFills, po.Fill) {
+		return InvalidOption("fill", "invalid fill (choose either color, blur or mirror)")
+	}
+	if po.Fill != PadFillColor && po.Color != "" {
+		return InvalidOption("color", "invalid color (only used by the color fill)")
+	}
+	if po.Fill == PadFillColor && po.Color != ColorTransparent {
+		if _, err := ParseHexColor(po.Color); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// needsAlpha tells whether the padding is transparent
+func (po PadOptions) needsAlpha() bool {
+	return po.Color == ColorTransparent
+}
+
+// padding returns the top, right, bottom and left padding of a width x height image
+func (po PadOptions) padding(width int, height int) (int, int, int, int) {
+	top, right, bottom, left := po.Top, po.Right, po.Bottom, po.Left
+	if po.Aspect != "" {
+		ratio, _ := ParseAspectRatio(po.Aspect)
+		canvasWidth, canvasHeight := width, height
+		if float64(width)/float64(height) < ratio {
+			canvasWidth = int(math.Round(float64(height) * ratio))
+		} else {
+			canvasHeight = int(math.Round(float64(width) / ratio))
+		}
+		pt := gravityPoint(canvasWidth, canvasHeight, width, height, po.Gravity)
+		top += pt.Y
+		left += pt.X
+		bottom += canvasHeight - height - pt.Y
+		right += canvasWidth - width - pt.X
+	}
+	return top, right, bottom, left
+}
+
+func (po PadOptions) apply(src gocv.Mat, basePath string) (gocv.Mat, error) {
+	top, right, bottom, left := po.padding(src.Cols(), src.Rows())
+	if src.Cols()+left+right > MaxCanvasSide || src.Rows()+top+bottom > MaxCanvasSide {
+		return gocv.Mat{}, ErrCanvasTooLarge
+	}
+	img := src.Clone()
+	defer img.Close()
+	switch {
+	case po.needsAlpha() && img.Channels() != 4:
+		bgr := toBGR(img)
+		defer bgr.Close()
+		gocv.CvtColor(bgr, &img, gocv.ColorBGRToBGRA)
+	case img.Channels() == 1:
+		gocv.CvtColor(src, &img, gocv.ColorGrayToBGR)
+	}
+	dst := gocv.NewMat()
+	switch po.Fill {
+	case PadFillBlur:
+		gocv.CopyMakeBorder(img, &dst, top, bottom, left, right, gocv.BorderReflect, color.RGBA{})
+		radius := float64(max(4, min(img.Cols(), img.Rows())/20))
+		gocv.GaussianBlur(dst, &dst, image.Point{}, radius, radius, gocv.BorderDefault)
+		// keep the image itself sharp
+		region := dst.Region(image.Rect(left, top, left+img.Cols(), top+img.Rows()))
+		img.CopyTo(&region)
+		region.Close()
+	case PadFillMirror:
+		gocv.CopyMakeBorder(img, &dst, top, bottom, left, right, gocv.BorderReflect, color.RGBA{})
+	default:
+		// transparent pixels are white once the alpha channel is dropped
+		value := color.RGBA{R: 255, G: 255, B: 255}
+		if !po.needsAlpha() {
+			c, _ := ParseHexColor(po.Color)
+			value = color.RGBA{R: c.R, G: c.G, B: c.B, A: 255}
+		}
+		gocv.CopyMakeBorder(img, &dst, top, bottom, left, right, gocv.BorderConstant, value)
+	}
+	return dst, nil
+}
+
+func init() {
+	registerPipelineStep("pad", filterStepBuilder(PadOptions.WithDefaults))
+}
@@ -0,0 +1,76 @@
+package services
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseAspectRatio(t *testing.T) {
+	assert := assert.New(t)
+	ratio, err := ParseAspectRatio("16:9")
+	assert.Equal(nil, err, "Error should be nil")
+	assert.InDelta(16.0/9, ratio, 1e-9, "Ratio should be width / height")
+	ratio2, _ := ParseAspectRatio("1.5")
+	assert.Equal(1.5, ratio2, "Plain numbers should be accepted")
+	for _, value := range []string{"", "square", "1:0", "0:1", "20:1", "4:x"} {
+		_, err := ParseAspectRatio(value)
+		assert.ErrorIs(err, ErrInvalidAspectRatio, "Error should be about the invalid aspect ratio: "+value)
+	}
+}
+
+func TestPadValidate(t *testing.T) {
+	assert := assert.New(t)
+	assert.Nil(PadOptions{Aspect: "1:1"}.WithDefaults().Validate(), "Aspect padding should be valid")
+	assert.Nil(PadOptions{Top: 10, Fill: PadFillMirror}.WithDefaults().Validate(), "Mirrored border should be valid")
+	assert.Nil(PadOptions{Left: 10, Color: ColorTransparent}.WithDefaults().Validate(), "Transparent border should be valid")
+	assert.NotNil(PadOptions{}.WithDefaults().Validate(), "Aspect or borders should be required")
+	assert.NotNil(PadOptions{Top: -1}.WithDefaults().Validate(), "Negative borders should be rejected")
+	assert.NotNil(PadOptions{Aspect: "1:1", Fill: "stretch"}.WithDefaults().Validate(), "Unknown fill should be rejected")
+	assert.NotNil(PadOptions{Aspect: "1:1", Fill: PadFillBlur, Color: "#000000"}.WithDefaults().Validate(), "Color is only used by the color fill")
+	assert.NotNil(PadOptions{Aspect: "1:1", Color: "red"}.WithDefaults().Validate(), "Invalid colors should be rejected")
+	assert.ErrorIs(PadOptions{Aspect: "1:1", Gravity: "middle"}.WithDefaults().Validate(), ErrInvalidGravity, "Invalid gravity should be rejected")
+}
+
+func TestPadPadding(t *testing.T) {
+	assert := assert.New(t)
+	top, right, bottom, left := PadOptions{Aspect: "1:1", Gravity: GravityCenter}.padding(200, 100)
+	assert.Equal([4]int{50, 0, 50, 0}, [4]int{top, right, bottom, left}, "Landscape images should be padded vertically")
+	top, right, bottom, left = PadOptions{Aspect: "1:1", Gravity: GravityWest}.padding(100, 200)
+	assert.Equal([4]int{0, 100, 0, 0}, [4]int{top, right, bottom, left}, "West gravity should pad on the right")
+	top, right, bottom, left = PadOptions{Aspect: "4:3", Gravity: GravityCenter, Top: 5, Left: 5}.padding(400, 300)
+	assert.Equal([4]int{5, 0, 0, 5}, [4]int{top, right, bottom, left}, "Borders should be added to the aspect padding")
+	top, right, bottom, left = PadOptions{Top: 1, Right: 2, Bottom: 3, Left: 4}.padding(10, 10)
+	assert.Equal([4]int{1, 2, 3, 4}, [4]int{top, right, bottom, left}, "Fixed borders should be kept")
+}
+
+func TestImageManipulationPad(t *testing.T) {
+	assert := assert.New(t)
+	im := ImageManipulation{}
+	cwd, _ := os.Getwd()
+	rootDir := filepath.Clean(filepath.Join(cwd, ".."))
+	baseUploadPath := filepath.Join(rootDir, "storages", "test")
+	outputPath := filepath.Join(rootDir, "storages", "public")
+	pads := []PadOptions{
+		{Aspect: "1:1", Color: "#336699"},
+		{Aspect: "1:1", Fill: PadFillBlur},
+		{Top: 20, Right: 20, Bottom: 20, Left: 20, Fill: PadFillMirror},
+		{Top: 10, Bottom: 10, Color: ColorTransparent},
+	}
+
+	for _, pad := range pads {
+		result, err := im.Filter(rootDir, baseUploadPath, outputPath, "sample-test.png", pad.WithDefaults(), EncodeOptions{}, false)
+		assert.Equal(nil, err, "Error should be nil")
+		if err == nil {
+			if pad.Aspect == "1:1" {
+				assert.Equal(result.Width, result.Height, "Output should be square")
+			}
+			_ = os.Remove(result.OutputFilePath)
+		}
+	}
+
+	_, err2 := im.Filter(rootDir, baseUploadPath, outputPath, "sample-test.png", PadOptions{Top: 10, Color: ColorTransparent}.WithDefaults(), EncodeOptions{Format: FormatJpeg}, false)
+	assert.ErrorIs(err2, ErrAlphaFormatRequired, "Error 2 should be about the transparent output")
+}
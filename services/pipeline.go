@@ -0,0 +1,260 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"gocv.io/x/gocv"
+)
+
+// maximum number of steps of a pipeline
+const MaxPipelineSteps = 20
+
+var ErrInvalidPipeline = InvalidOption("steps", "invalid pipeline")
+
+// pipelineStep transforms the image into a new Mat (the source is closed by the caller)
+type pipelineStep func(src gocv.Mat) (gocv.Mat, error)
+
+// stepBuilder validates the step parameters and returns the step to run
+type stepBuilder func(im *ImageManipulation, params json.RawMessage) (pipelineStep, error)
+
+var pipelineSteps = map[string]stepBuilder{}
+
+// registerPipelineStep makes an operation available as a pipeline step
+func registerPipelineStep(op string, builder stepBuilder) {
+	pipelineSteps[op] = builder
+}
+
+// PipelineOperations returns the sorted list of operations usable as pipeline steps
+func PipelineOperations() []string {
+	r := []string{}
+	for op := range pipelineSteps {
+		r = append(r, op)
+	}
+	sort.Strings(r)
+	return r
+}
+
+// decodeStepParams decodes the JSON parameters of a step, rejecting unknown fields
+func decodeStepParams(params json.RawMessage, v interface{}) error {
+	if len(params) == 0 {
+		return nil
+	}
+	decoder := json.NewDecoder(bytes.NewReader(params))
+	decoder.DisallowUnknownFields()
+	return decoder.Decode(v)
+}
+
+type PipelineStep struct {
+	Op     string          `json:"op"`
+	Params json.RawMessage `json:"params,omitempty"`
+}
+
+// Pipeline is an ordered list of operations applied on the image before encoding it
+type Pipeline struct {
+	Steps  []PipelineStep `json:"steps"`
+	Encode EncodeOptions  `json:"encode"`
+}
+
+func (p Pipeline) build(im *ImageManipulation) ([]pipelineStep, error) {
+	if len(p.Steps) == 0 || len(p.Steps) > MaxPipelineSteps {
+		return nil, fmt.Errorf("%w: it must have 1 - %d steps", ErrInvalidPipeline, MaxPipelineSteps)
+	}
+	steps := []pipelineStep{}
+	for i, step := range p.Steps {
+		builder, ok := pipelineSteps[step.Op]
+		if !ok {
+			return nil, fmt.Errorf("%w: unknown operation %q at step %d (available: %s)", ErrInvalidPipeline, step.Op, i, strings.Join(PipelineOperations(), ","))
+		}
+		fn, err := builder(im, step.Params)
+		if err != nil {
+			return nil, fmt.Errorf("%w: step %d (%s): %s", ErrInvalidPipeline, i, step.Op, err.Error())
+		}
+		steps = append(steps, fn)
+	}
+	return steps, nil
+}
+
+// Validate checks the parameters of every step (the output options are checked when running the pipeline)
+func (p Pipeline) Validate() error {
+	_, err := p.build(&ImageManipulation{})
+	return err
+}
+
+// NeedsAlpha tells whether a step produces transparent pixels (masks, transparent padding)
+func (p Pipeline) NeedsAlpha() bool {
+	for _, step := range p.Steps {
+		var filter Filter
+		switch step.Op {
+		case "mask":
+			filter = &MaskOptions{}
+		case "pad":
+			filter = &PadOptions{}
+		default:
+			continue
+		}
+		if decodeStepParams(step.Params, filter) == nil && RequiresAlpha(filter) {
+			return true
+		}
+	}
+	return false
+}
+
+// RunPipeline applies the pipeline steps on the image, in order, and encodes the result. An empty output format
+// keeps png inputs as png and encodes the others into jpeg (transparent outputs are always encoded into png).
+func (im *ImageManipulation) RunPipeline(basePath string, inputPath string, outputPath string, filename string, pipeline Pipeline, debug bool) (CompressResult, error) {
+	if pipeline.Encode.Format == "" {
+		pipeline.Encode.Format = defaultOutputFormat(filename)
+		if pipeline.NeedsAlpha() {
+			pipeline.Encode.Format = FormatPng
+		}
+	}
+	if pipeline.NeedsAlpha() && !pipeline.Encode.SupportsAlpha() {
+		return CompressResult{}, ErrAlphaFormatRequired
+	}
+	return im.runSteps(basePath, inputPath, outputPath, filename, pipeline.build, pipeline.Encode, debug)
+}
+
+// defaultOutputFormat keeps png inputs as png, the others are encoded into jpeg
+func defaultOutputFormat(filename string) string {
+	if strings.EqualFold(filepath.Ext(filename), ".png") {
+		return FormatPng
+	}
+	return FormatJpeg
+}
+
+// runSteps reads the input file, applies the steps returned by build (once the options are set) and writes
+// the encoded output
+func (im *ImageManipulation) runSteps(basePath string, inputPath string, outputPath string, filename string, build func(im *ImageManipulation) ([]pipelineStep, error), encode EncodeOptions, debug bool) (CompressResult, error) {
+	if err := encode.Validate(); err != nil {
+		return CompressResult{}, err
+	}
+	// set options value
+	_, err := im.options.init(basePath, inputPath, outputPath, filename, -1, -1, encode.Quality, encode.Format, true, debug)
+	if err != nil {
+		return CompressResult{}, err
+	}
+	encode.Quality = im.options.Quality
+	steps, err := build(im)
+	if err != nil {
+		return CompressResult{}, err
+	}
+	// main logic
+	img := im.readImage(im.options.InputFilePath, encode.SupportsAlpha())
+	defer func() {
+		img.Close()
+	}()
+	if img.Empty() {
+		return CompressResult{}, errReadInput
+	}
+	span := im.startTransform(img, attribute.Int("image.steps", len(steps)))
+	for _, step := range steps {
+		next, err := step(img)
+		if err != nil {
+			EndSpan(span, err)
+			return CompressResult{}, err
+		}
+		img.Close()
+		img = next
+	}
+	span.End()
+	data, err := im.encodeImage(img, encode)
+	if err != nil {
+		return CompressResult{}, err
+	}
+	if err := im.storeImage(im.options.OutputFilePath, data); err != nil {
+		return CompressResult{}, err
+	}
+	result := CompressResult{
+		OutputFilePath: im.options.OutputFilePath,
+		Format:         encode.Format,
+		Quality:        encode.Quality,
+		Width:          img.Cols(),
+		Height:         img.Rows(),
+		Bytes:          len(data),
+	}
+	if encode.Format == FormatPng {
+		result.Quality = 0
+	}
+	if info, err := os.Stat(im.options.InputFilePath); err == nil {
+		result.OriginalBytes = int(info.Size())
+		result.SavedBytes = result.OriginalBytes - result.Bytes
+	}
+	return result, nil
+}
+
+type resizeStepParams struct {
+	Width           float64 `json:"width"`
+	Height          float64 `json:"height"`
+	KeepAspectRatio *bool   `json:"keep_aspect_ratio"`
+	// Fit overrides keep_aspect_ratio, the gravity and fallback place the window of cover resizes
+	Fit      string `json:"fit"`
+	Gravity  string `json:"gravity"`
+	Fallback string `json:"fallback"`
+}
+
+func init() {
+	registerPipelineStep("resize", func(im *ImageManipulation, params json.RawMessage) (pipelineStep, error) {
+		var p resizeStepParams
+		if err := decodeStepParams(params, &p); err != nil {
+			return nil, err
+		}
+		if p.Width <= 0 || p.Height <= 0 {
+			return nil, InvalidOption("", "invalid width or height")
+		}
+		if p.Fit != "" && !slices.Contains(Fits, p.Fit) {
+			return nil, InvalidOption("fit", "invalid fit (choose either contain, fill or cover)")
+		}
+		if p.Fit == FitCover {
+			crop := CropOptions{Width: int(p.Width), Height: int(p.Height), Gravity: p.Gravity, Fallback: p.Fallback}.WithDefaults()
+			if err := crop.Validate(); err != nil {
+				return nil, err
+			}
+			return func(src gocv.Mat) (gocv.Mat, error) {
+				scaled := coverMat(src, crop.Width, crop.Height)
+				defer scaled.Close()
+				rect, _, err := crop.rect(scaled, im.options.BasePath)
+				if err != nil {
+					return gocv.Mat{}, err
+				}
+				return cropMat(scaled, rect), nil
+			}, nil
+		}
+		if p.Gravity != "" || p.Fallback != "" {
+			return nil, InvalidOption("gravity", "invalid gravity (only cover resizes have a gravity)")
+		}
+		keepAspectRatio := p.KeepAspectRatio == nil || *p.KeepAspectRatio
+		if p.Fit != "" {
+			keepAspectRatio = p.Fit == FitContain
+		}
+		return func(src gocv.Mat) (gocv.Mat, error) {
+			dst := gocv.NewMat()
+			im.resizeMat(src, &dst, p.Width, p.Height, keepAspectRatio)
+			return dst, nil
+		}, nil
+	})
+	registerPipelineStep("crop", func(im *ImageManipulation, params json.RawMessage) (pipelineStep, error) {
+		var crop CropOptions
+		if err := decodeStepParams(params, &crop); err != nil {
+			return nil, err
+		}
+		crop = crop.WithDefaults()
+		if err := crop.Validate(); err != nil {
+			return nil, err
+		}
+		return func(src gocv.Mat) (gocv.Mat, error) {
+			rect, _, err := crop.rect(src, im.options.BasePath)
+			if err != nil {
+				return gocv.Mat{}, err
+			}
+			return cropMat(src, rect), nil
+		}, nil
+	})
+}
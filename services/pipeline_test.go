@@ -0,0 +1,68 @@
+package services
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPipelineOperations(t *testing.T) {
+	assert := assert.New(t)
+	ops := PipelineOperations()
+	assert.Contains(ops, "resize", "Resize should be a pipeline step")
+	assert.Contains(ops, "crop", "Crop should be a pipeline step")
+	assert.Contains(ops, "watermark", "Watermark should be a pipeline step")
+}
+
+func TestPipelineValidate(t *testing.T) {
+	assert := assert.New(t)
+	pipeline := Pipeline{Steps: []PipelineStep{
+		{Op: "resize", Params: json.RawMessage(`{"width": 800, "height": 600}`)},
+		{Op: "watermark", Params: json.RawMessage(`{"text": "(c) Shop", "gravity": "southwest"}`)},
+	}}
+	assert.Equal(nil, pipeline.Validate(), "Pipeline should be valid")
+	assert.ErrorIs(Pipeline{}.Validate(), ErrInvalidPipeline, "Empty pipeline should be rejected")
+	unknown := Pipeline{Steps: []PipelineStep{{Op: "rotate"}}}
+	assert.ErrorIs(unknown.Validate(), ErrInvalidPipeline, "Unknown operation should be rejected")
+	invalid := Pipeline{Steps: []PipelineStep{{Op: "resize", Params: json.RawMessage(`{"width": 800, "height": 600, "depth": 3}`)}}}
+	assert.ErrorIs(invalid.Validate(), ErrInvalidPipeline, "Unknown parameters should be rejected")
+}
+
+func TestPipelineNeedsAlpha(t *testing.T) {
+	assert := assert.New(t)
+	masked := Pipeline{Steps: []PipelineStep{
+		{Op: "resize", Params: json.RawMessage(`{"width": 200, "height": 200}`)},
+		{Op: "mask", Params: json.RawMessage(`{"shape": "circle"}`)},
+	}}
+	assert.True(masked.NeedsAlpha(), "Masks should need a transparent output")
+	padded := Pipeline{Steps: []PipelineStep{{Op: "pad", Params: json.RawMessage(`{"aspect": "1:1", "color": "transparent"}`)}}}
+	assert.True(padded.NeedsAlpha(), "Transparent padding should need a transparent output")
+	opaque := Pipeline{Steps: []PipelineStep{{Op: "pad", Params: json.RawMessage(`{"aspect": "1:1", "fill": "blur"}`)}}}
+	assert.False(opaque.NeedsAlpha(), "Blurred padding should not need a transparent output")
+}
+
+func TestImageManipulationRunPipeline(t *testing.T) {
+	assert := assert.New(t)
+	im := ImageManipulation{}
+	cwd, _ := os.Getwd()
+	rootDir := filepath.Clean(filepath.Join(cwd, ".."))
+	baseUploadPath := filepath.Join(rootDir, "storages", "test")
+	outputPath := filepath.Join(rootDir, "storages", "public")
+	pipeline := Pipeline{Steps: []PipelineStep{
+		{Op: "crop", Params: json.RawMessage(`{"width": 400, "height": 400}`)},
+		{Op: "resize", Params: json.RawMessage(`{"width": 200, "height": 200}`)},
+		{Op: "watermark", Params: json.RawMessage(`{"text": "(c) Shop"}`)},
+	}}
+
+	result, err := im.RunPipeline(rootDir, baseUploadPath, outputPath, "sample-test.png", pipeline, false)
+	assert.Equal(nil, err, "Error should be nil")
+	assert.Equal(FormatPng, result.Format, "Png inputs should stay png")
+	assert.Equal(200, result.Width, "Width should be 200")
+	assert.Equal(200, result.Height, "Height should be 200")
+	if err == nil {
+		_ = os.Remove(result.OutputFilePath)
+	}
+}
@@ -0,0 +1,85 @@
+package services
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image/png"
+
+	"gocv.io/x/gocv"
+)
+
+// number of colors of a quantised png palette
+const pngPaletteSize = 256
+
+var (
+	pngSignature = []byte("\x89PNG\r\n\x1a\n")
+	// zlib compression levels and strategies tried by the png optimisation
+	pngCompressionLevels = []int{3, 6, 9}
+	pngStrategies        = []int{
+		gocv.IMWritePngStrategyDefault,
+		gocv.IMWritePngStrategyFiltered,
+		gocv.IMWritePngStrategyHuffmanOnly,
+		gocv.IMWritePngStrategyRle,
+		gocv.IMWritePngStrategyFixed,
+	}
+)
+
+// stripPngAncillaryChunks drops the ancillary chunks (metadata, color profiles, text, ...) of a png file.
+// Only the critical chunks and the transparency (tRNS) chunk are kept.
+func stripPngAncillaryChunks(data []byte) []byte {
+	if !bytes.HasPrefix(data, pngSignature) {
+		return data
+	}
+	r := bytes.NewBuffer(make([]byte, 0, len(data)))
+	r.Write(pngSignature)
+	for i := len(pngSignature); i+8 <= len(data); {
+		length := int(binary.BigEndian.Uint32(data[i:]))
+		end := i + 12 + length
+		if end > len(data) {
+			// truncated chunk, keep the original file
+			return data
+		}
+		chunkType := string(data[i+4 : i+8])
+		// critical chunks have an uppercase first letter
+		if chunkType[0] >= 'A' && chunkType[0] <= 'Z' || chunkType == "tRNS" {
+			r.Write(data[i:end])
+		}
+		i = end
+	}
+	return r.Bytes()
+}
+
+// optimizePng keeps the smallest encoding among every zlib compression level and strategy and strips its
+// ancillary chunks. When a palette is requested the image is quantised to 256 colors instead; it returns the
+// number of palette colors (0 for a truecolor output) along with the data.
+func optimizePng(src gocv.Mat, encode EncodeOptions) ([]byte, int, error) {
+	if encode.Palette {
+		img, err := src.ToImage()
+		if err != nil {
+			return nil, 0, err
+		}
+		paletted := Quantize(img, pngPaletteSize, encode.Dither)
+		var buf bytes.Buffer
+		encoder := png.Encoder{CompressionLevel: png.BestCompression}
+		if err := encoder.Encode(&buf, paletted); err != nil {
+			return nil, 0, err
+		}
+		return stripPngAncillaryChunks(buf.Bytes()), len(paletted.Palette), nil
+	}
+
+	var best []byte
+	for _, level := range pngCompressionLevels {
+		for _, strategy := range pngStrategies {
+			// the strategy has to follow the compression level, which resets it
+			buf, err := gocv.IMEncodeWithParams(gocv.PNGFileExt, src, []int{gocv.IMWritePngCompression, level, gocv.IMWritePngStrategy, strategy})
+			if err != nil {
+				return nil, 0, err
+			}
+			if best == nil || buf.Len() < len(best) {
+				best = bytes.Clone(buf.GetBytes())
+			}
+			buf.Close()
+		}
+	}
+	return stripPngAncillaryChunks(best), 0, nil
+}
@@ -0,0 +1,60 @@
+package services
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStripPngAncillaryChunks(t *testing.T) {
+	assert := assert.New(t)
+	var buf bytes.Buffer
+	png.Encode(&buf, image.NewNRGBA(image.Rect(0, 0, 4, 4)))
+	data := buf.Bytes()
+	// insert a tEXt chunk after IHDR (signature + 25 bytes)
+	text := []byte{0, 0, 0, 4, 't', 'E', 'X', 't', 'a', '=', 'b', 0, 0, 0, 0, 0}
+	withText := append(append(append([]byte{}, data[:33]...), text...), data[33:]...)
+
+	stripped := stripPngAncillaryChunks(withText)
+	assert.Equal(data, stripped, "Ancillary chunks should be removed")
+	assert.False(bytes.Contains(stripped, []byte("tEXt")), "Text chunk should be removed")
+	_, err := png.Decode(bytes.NewReader(stripped))
+	assert.Equal(nil, err, "Stripped file should stay valid")
+
+	assert.Equal([]byte("not a png"), stripPngAncillaryChunks([]byte("not a png")), "Non png data should be kept")
+}
+
+func TestImageManipulationCompressPng(t *testing.T) {
+	assert := assert.New(t)
+	im := ImageManipulation{}
+	cwd, _ := os.Getwd()
+	rootDir := filepath.Clean(filepath.Join(cwd, ".."))
+	baseUploadPath := filepath.Join(rootDir, "storages", "test")
+	outputPath := filepath.Join(rootDir, "storages", "public")
+
+	result, err := im.CompressWithOptions(rootDir, baseUploadPath, outputPath, "sample-test.png", EncodeOptions{Format: FormatPng}, false)
+	assert.Equal(nil, err, "Error should be nil")
+	assert.Equal(0, result.Colors, "Output should be truecolor")
+	assert.Equal(result.OriginalBytes-result.Bytes, result.SavedBytes, "Result should report the byte reduction")
+	e := os.Remove(result.OutputFilePath)
+	if e != nil {
+		panic(e)
+	}
+
+	result2, err2 := im.CompressWithOptions(rootDir, baseUploadPath, outputPath, "sample-test.png", EncodeOptions{Format: FormatPng, Palette: true, Dither: true}, false)
+	assert.Equal(nil, err2, "Error 2 should be nil")
+	assert.True(result2.Colors > 0 && result2.Colors <= 256, "Output 2 should use a palette")
+	assert.True(result2.Bytes < result.Bytes, "Palette output should be smaller")
+	e = os.Remove(result2.OutputFilePath)
+	if e != nil {
+		panic(e)
+	}
+
+	_, err3 := im.CompressWithOptions(rootDir, baseUploadPath, outputPath, "sample-test.png", EncodeOptions{Format: FormatJpeg, Palette: true}, false)
+	assert.Equal("palette and dither options require the png output format", err3.Error(), "Error 3 should contain message")
+}
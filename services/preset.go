@@ -0,0 +1,134 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// PresetsPath is the presets configuration file (JSON), relative to the base path
+var PresetsPath = filepath.Join("config", "presets.json")
+
+var (
+	ErrPresetNotFound = NewError(CodeNotFound, "preset", "preset not found")
+	ErrInvalidPresets = errors.New("invalid presets")
+)
+
+// Preset is a named pipeline defined by the operators. The presets file maps every name to its description,
+// steps and encode options:
+//
+//	{"thumb": {"description": "...", "steps": [{"op": "resize", "params": {...}}], "encode": {"format": "webp"}}}
+type Preset struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Pipeline
+}
+
+// presetFile caches the presets of a file, which are reloaded when its modification time or size changes
+type presetFile struct {
+	mu      sync.Mutex
+	modTime time.Time
+	size    int64
+	presets map[string]Preset
+}
+
+var (
+	presetFilesMu sync.Mutex
+	presetFiles   = map[string]*presetFile{}
+)
+
+// ParsePresets reads and validates a presets file. Unavailable encoders are only reported when a preset is
+// applied, so that a single preset can not disable the others.
+func ParsePresets(data []byte) (map[string]Preset, error) {
+	raw := map[string]Preset{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&raw); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidPresets, err.Error())
+	}
+	presets := map[string]Preset{}
+	for name, preset := range raw {
+		if !namePattern.MatchString(name) {
+			return nil, fmt.Errorf("%w: invalid name %q (only letters, digits, - and _ are allowed)", ErrInvalidPresets, name)
+		}
+		if err := preset.Pipeline.Validate(); err != nil {
+			return nil, fmt.Errorf("%w: %s: %s", ErrInvalidPresets, name, err.Error())
+		}
+		if preset.Encode.Format != "" && preset.Encode.Format != FormatAuto {
+			if err := preset.Encode.Validate(); err != nil && !errors.Is(err, ErrUnsupportedOutputFormat) {
+				return nil, fmt.Errorf("%w: %s: %s", ErrInvalidPresets, name, err.Error())
+			}
+		}
+		preset.Name = name
+		presets[name] = preset
+	}
+	return presets, nil
+}
+
+// load returns the cached presets, reloading the file when it changed. When the new content is invalid, the
+// error is returned along with the presets previously loaded. A missing file means no presets.
+func (pf *presetFile) load(path string) (map[string]Preset, error) {
+	pf.mu.Lock()
+	defer pf.mu.Unlock()
+	info, err := os.Stat(path)
+	if err != nil {
+		pf.modTime, pf.size, pf.presets = time.Time{}, 0, map[string]Preset{}
+		return pf.presets, nil
+	}
+	if pf.presets != nil && info.ModTime().Equal(pf.modTime) && info.Size() == pf.size {
+		return pf.presets, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return pf.presets, err
+	}
+	presets, err := ParsePresets(data)
+	if err != nil {
+		return pf.presets, err
+	}
+	pf.modTime, pf.size, pf.presets = info.ModTime(), info.Size(), presets
+	return presets, nil
+}
+
+// loadPresets returns the presets of the file under the base path, hot-reloaded
+func loadPresets(basePath string) (map[string]Preset, error) {
+	path := filepath.Join(basePath, PresetsPath)
+	presetFilesMu.Lock()
+	pf, ok := presetFiles[path]
+	if !ok {
+		pf = &presetFile{}
+		presetFiles[path] = pf
+	}
+	presetFilesMu.Unlock()
+	return pf.load(path)
+}
+
+// ListPresets returns the presets sorted by name. When the file was changed into an invalid one, the error is
+// returned along with the presets previously loaded.
+func ListPresets(basePath string) ([]Preset, error) {
+	presets, err := loadPresets(basePath)
+	r := []Preset{}
+	for _, preset := range presets {
+		r = append(r, preset)
+	}
+	sort.Slice(r, func(i, j int) bool {
+		return r[i].Name < r[j].Name
+	})
+	return r, err
+}
+
+// GetPreset returns the named preset. The presets previously loaded keep being served while the file is invalid.
+func GetPreset(basePath string, name string) (Preset, error) {
+	presets, _ := loadPresets(basePath)
+	preset, ok := presets[name]
+	if !ok {
+		return Preset{}, ErrPresetNotFound
+	}
+	return preset, nil
+}
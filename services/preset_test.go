@@ -0,0 +1,70 @@
+package services
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParsePresets(t *testing.T) {
+	assert := assert.New(t)
+	presets, err := ParsePresets([]byte(`{"thumb": {"description": "Thumbnail", "steps": [{"op": "resize", "params": {"width": 150, "height": 150, "fit": "cover"}}], "encode": {"format": "jpeg", "quality": 70}}}`))
+	assert.Equal(nil, err, "Error should be nil")
+	assert.Equal("thumb", presets["thumb"].Name, "Name should be filled from the key")
+	assert.Equal(70, presets["thumb"].Encode.Quality, "Encode options should be read")
+	_, err2 := ParsePresets([]byte(`{"thumb": {"steps": [{"op": "rotate"}]}}`))
+	assert.ErrorIs(err2, ErrInvalidPresets, "Error 2 should be about the unknown operation")
+	_, err3 := ParsePresets([]byte(`{"thumb": {"steps": [{"op": "blur"}], "encode": {"format": "png", "max_bytes": 1000}}}`))
+	assert.ErrorIs(err3, ErrInvalidPresets, "Error 3 should be about the encode options")
+	_, err4 := ParsePresets([]byte(`{"../thumb": {"steps": [{"op": "blur"}]}}`))
+	assert.ErrorIs(err4, ErrInvalidPresets, "Error 4 should be about the name")
+	_, err5 := ParsePresets([]byte(`{"thumb": {"steps": [{"op": "blur"}], "width": 100}}`))
+	assert.ErrorIs(err5, ErrInvalidPresets, "Error 5 should be about the unknown field")
+}
+
+func TestPresetsHotReload(t *testing.T) {
+	assert := assert.New(t)
+	basePath := t.TempDir()
+	path := filepath.Join(basePath, PresetsPath)
+	presets, err := ListPresets(basePath)
+	assert.Equal(nil, err, "Missing file should not be an error")
+	assert.Equal(0, len(presets), "Missing file should mean no presets")
+
+	assert.Nil(os.MkdirAll(filepath.Dir(path), 0755))
+	assert.Nil(os.WriteFile(path, []byte(`{"thumb": {"steps": [{"op": "blur"}]}}`), 0644))
+	preset, err := GetPreset(basePath, "thumb")
+	assert.Equal(nil, err, "Error should be nil")
+	assert.Equal("blur", preset.Steps[0].Op, "Preset should be loaded")
+
+	// the modification time may not change within the file system resolution
+	later := time.Now().Add(time.Minute)
+	assert.Nil(os.WriteFile(path, []byte(`{"thumb": {"steps": [{"op": "sharpen"}]}, "card": {"steps": [{"op": "blur"}]}}`), 0644))
+	assert.Nil(os.Chtimes(path, later, later))
+	presets2, err2 := ListPresets(basePath)
+	assert.Equal(nil, err2, "Error 2 should be nil")
+	assert.Equal([]string{"card", "thumb"}, []string{presets2[0].Name, presets2[1].Name}, "Presets should be reloaded and sorted")
+
+	assert.Nil(os.WriteFile(path, []byte(`{"thumb": `), 0644))
+	assert.Nil(os.Chtimes(path, later.Add(time.Minute), later.Add(time.Minute)))
+	presets3, err3 := ListPresets(basePath)
+	assert.ErrorIs(err3, ErrInvalidPresets, "Error 3 should be about the invalid file")
+	assert.Equal(2, len(presets3), "Previous presets should be kept")
+	_, err4 := GetPreset(basePath, "hero")
+	assert.ErrorIs(err4, ErrPresetNotFound, "Error 4 should be about the missing preset")
+}
+
+func TestBundledPresets(t *testing.T) {
+	assert := assert.New(t)
+	cwd, _ := os.Getwd()
+	rootDir := filepath.Clean(filepath.Join(cwd, ".."))
+	presets, err := ListPresets(rootDir)
+	assert.Equal(nil, err, "Error should be nil")
+	names := []string{}
+	for _, preset := range presets {
+		names = append(names, preset.Name)
+	}
+	assert.Equal([]string{"card", "hero", "thumb"}, names, "Bundled presets should be valid")
+}
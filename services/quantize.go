@@ -0,0 +1,122 @@
+package services
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"sort"
+)
+
+// maximum number of pixels sampled to build a palette
+const quantizeSampleSize = 1 << 16
+
+type colorBox struct {
+	colors []color.NRGBA
+}
+
+func channelValue(c color.NRGBA, channel int) uint8 {
+	switch channel {
+	case 0:
+		return c.R
+	case 1:
+		return c.G
+	case 2:
+		return c.B
+	default:
+		return c.A
+	}
+}
+
+// widestChannel returns the channel (r, g, b, a) with the largest value range and its range
+func (cb colorBox) widestChannel() (int, int) {
+	channel, width := 0, -1
+	for ch := 0; ch < 4; ch++ {
+		lo, hi := uint8(255), uint8(0)
+		for _, c := range cb.colors {
+			v := channelValue(c, ch)
+			lo, hi = min(lo, v), max(hi, v)
+		}
+		if int(hi)-int(lo) > width {
+			channel, width = ch, int(hi)-int(lo)
+		}
+	}
+	return channel, width
+}
+
+func (cb colorBox) average() color.NRGBA {
+	var r, g, b, a int
+	for _, c := range cb.colors {
+		r, g, b, a = r+int(c.R), g+int(c.G), b+int(c.B), a+int(c.A)
+	}
+	n := len(cb.colors)
+	return color.NRGBA{R: uint8(r / n), G: uint8(g / n), B: uint8(b / n), A: uint8(a / n)}
+}
+
+// BuildPalette computes a palette of at most size colors (alpha included) using median cut
+func BuildPalette(img image.Image, size int) color.Palette {
+	bounds := img.Bounds()
+	step := 1
+	if total := bounds.Dx() * bounds.Dy(); total > quantizeSampleSize {
+		step = total / quantizeSampleSize
+	}
+	samples := make([]color.NRGBA, 0, quantizeSampleSize)
+	i := 0
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			if i%step == 0 {
+				samples = append(samples, color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA))
+			}
+			i++
+		}
+	}
+	if len(samples) == 0 {
+		return color.Palette{color.NRGBA{}}
+	}
+
+	boxes := []colorBox{{colors: samples}}
+	for len(boxes) < size {
+		// split the box having the widest channel range
+		target, channel, width := -1, 0, 0
+		for idx, box := range boxes {
+			if len(box.colors) < 2 {
+				continue
+			}
+			if ch, w := box.widestChannel(); w > width {
+				target, channel, width = idx, ch, w
+			}
+		}
+		if target < 0 {
+			break
+		}
+		colors := boxes[target].colors
+		sort.Slice(colors, func(a, b int) bool {
+			return channelValue(colors[a], channel) < channelValue(colors[b], channel)
+		})
+		median := len(colors) / 2
+		boxes[target] = colorBox{colors: colors[:median]}
+		boxes = append(boxes, colorBox{colors: colors[median:]})
+	}
+
+	palette := make(color.Palette, 0, len(boxes))
+	for _, box := range boxes {
+		palette = append(palette, box.average())
+	}
+	return palette
+}
+
+// Quantize maps the image onto a palette of at most size colors, optionally using Floyd-Steinberg dithering
+func Quantize(img image.Image, size int, dither bool) *image.Paletted {
+	return QuantizeWithPalette(img, BuildPalette(img, size), dither)
+}
+
+// QuantizeWithPalette maps the image onto the given palette, optionally using Floyd-Steinberg dithering
+func QuantizeWithPalette(img image.Image, palette color.Palette, dither bool) *image.Paletted {
+	bounds := img.Bounds()
+	dst := image.NewPaletted(image.Rect(0, 0, bounds.Dx(), bounds.Dy()), palette)
+	var drawer draw.Drawer = draw.Src
+	if dither {
+		drawer = draw.FloydSteinberg
+	}
+	drawer.Draw(dst, dst.Bounds(), img, bounds.Min)
+	return dst
+}
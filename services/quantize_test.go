@@ -0,0 +1,40 @@
+package services
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuildPalette(t *testing.T) {
+	assert := assert.New(t)
+	img := image.NewNRGBA(image.Rect(0, 0, 64, 64))
+	for y := 0; y < 64; y++ {
+		for x := 0; x < 64; x++ {
+			img.Set(x, y, color.NRGBA{R: uint8(x * 4), G: uint8(y * 4), B: 128, A: 255})
+		}
+	}
+	palette := BuildPalette(img, 16)
+	assert.Equal(16, len(palette), "Palette should have 16 colors")
+
+	solid := image.NewNRGBA(image.Rect(0, 0, 8, 8))
+	palette2 := BuildPalette(solid, 256)
+	assert.Equal(1, len(palette2), "Palette of a solid image should have a single color")
+}
+
+func TestQuantize(t *testing.T) {
+	assert := assert.New(t)
+	img := image.NewNRGBA(image.Rect(0, 0, 32, 32))
+	for y := 0; y < 32; y++ {
+		for x := 0; x < 32; x++ {
+			img.Set(x, y, color.NRGBA{R: uint8(x * 8), G: uint8(y * 8), B: 0, A: uint8(255 - x*4)})
+		}
+	}
+	paletted := Quantize(img, 8, true)
+	assert.Equal(img.Bounds(), paletted.Bounds(), "Quantized image should keep the dimensions")
+	assert.True(len(paletted.Palette) <= 8, "Quantized image should use the palette size")
+	_, _, _, a := paletted.At(31, 0).RGBA()
+	assert.True(a < 0xffff, "Quantized image should keep the transparency")
+}
@@ -0,0 +1,214 @@
+package services
+
+import (
+	"fmt"
+	"html"
+	"image"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// bounds of the responsive image sets
+const (
+	MaxResponsiveWidths    = 10
+	MaxResponsiveDensities = 4
+	MaxResponsiveFormats   = 3
+	MaxResponsiveWidth     = 8192
+	defaultResponsiveSizes = "100vw"
+)
+
+// ResponsiveOptions describes a responsive image set: every breakpoint width is rendered at every device pixel
+// ratio (density) and in every format. The renditions are never wider than the source image.
+type ResponsiveOptions struct {
+	Widths    []int     `json:"widths"`
+	Densities []float64 `json:"densities"`
+	// Formats are listed by preference, the last one being the fallback of the <img> tag (webp and the source
+	// format when not set)
+	Formats []string `json:"formats"`
+	Quality int      `json:"quality"`
+	// Sizes is the sizes attribute of the markup (100vw when not set), Alt the alternate text of the image
+	Sizes string `json:"sizes"`
+	Alt   string `json:"alt"`
+}
+
+// WithDefaults fills the densities (1x) and the sizes attribute (100vw)
+func (ro ResponsiveOptions) WithDefaults() ResponsiveOptions {
+	if len(ro.Densities) == 0 {
+		ro.Densities = []float64{1}
+	}
+	if ro.Sizes == "" {
+		ro.Sizes = defaultResponsiveSizes
+	}
+	return ro
+}
+
+func (ro ResponsiveOptions) Validate() error {
+	if len(ro.Widths) == 0 || len(ro.Widths) > MaxResponsiveWidths {
+		return InvalidOption("widths", "invalid widths (set 1 - %d widths)", MaxResponsiveWidths)
+	}
+	for _, width := range ro.Widths {
+		if width <= 0 || width > MaxResponsiveWidth {
+			return InvalidOption("widths", "invalid widths (must between 1 - %d)", MaxResponsiveWidth)
+		}
+	}
+	if len(ro.Densities) == 0 || len(ro.Densities) > MaxResponsiveDensities {
+		return InvalidOption("dpr", "invalid dpr (set 1 - %d device pixel ratios)", MaxResponsiveDensities)
+	}
+	for _, density := range ro.Densities {
+		if density < 0.5 || density > 4 {
+			return InvalidOption("dpr", "invalid dpr (must between 0.5 - 4)")
+		}
+	}
+	if len(ro.Formats) > MaxResponsiveFormats {
+		return InvalidOption("formats", "invalid formats (up to %d formats)", MaxResponsiveFormats)
+	}
+	for i, format := range ro.Formats {
+		if err := (EncodeOptions{Format: format}).Validate(); err != nil {
+			return err
+		}
+		if slices.Contains(ro.Formats[:i], format) {
+			return InvalidOption("formats", "invalid formats (every format must be listed once)")
+		}
+	}
+	if ro.Quality < 0 || ro.Quality > 100 {
+		return InvalidOption("quality", "invalid quality (must between 1 - 100)")
+	}
+	return nil
+}
+
+// renditionWidths returns the sorted distinct widths of the renditions, clamped to the source width
+func (ro ResponsiveOptions) renditionWidths(srcWidth int) []int {
+	r := []int{}
+	for _, width := range ro.Widths {
+		for _, density := range ro.Densities {
+			w := min(srcWidth, max(1, int(math.Round(float64(width)*density))))
+			if !slices.Contains(r, w) {
+				r = append(r, w)
+			}
+		}
+	}
+	sort.Ints(r)
+	return r
+}
+
+type ResponsiveImage struct {
+	OutputFilePath string `json:"-"`
+	URL            string `json:"url"`
+	Format         string `json:"format"`
+	Width          int    `json:"width"`
+	Height         int    `json:"height"`
+	Bytes          int    `json:"bytes"`
+}
+
+type ResponsiveResult struct {
+	Width   int               `json:"width"`
+	Height  int               `json:"height"`
+	Formats []string          `json:"formats"`
+	Images  []ResponsiveImage `json:"images"`
+	// Srcset is the srcset attribute value of every format
+	Srcset  map[string]string `json:"srcset"`
+	Picture string            `json:"picture"`
+}
+
+// srcset lists the images of the format with their width descriptor
+func srcset(images []ResponsiveImage, format string) string {
+	r := []string{}
+	for _, img := range images {
+		if img.Format == format {
+			r = append(r, fmt.Sprintf("%s %dw", img.URL, img.Width))
+		}
+	}
+	return strings.Join(r, ", ")
+}
+
+// markup fills the srcset of every format and the <picture> markup: a <source> per preferred format and an
+// <img> using the fallback format. The <img> src is the smallest image covering the widest breakpoint at 1x
+// (the widest image when none does).
+func (rr *ResponsiveResult) markup(options ResponsiveOptions) {
+	rr.Srcset = map[string]string{}
+	for _, format := range rr.Formats {
+		rr.Srcset[format] = srcset(rr.Images, format)
+	}
+	fallbackFormat := rr.Formats[len(rr.Formats)-1]
+	sizes := html.EscapeString(options.Sizes)
+	b := strings.Builder{}
+	b.WriteString("<picture>\n")
+	for _, format := range rr.Formats[:len(rr.Formats)-1] {
+		fmt.Fprintf(&b, "  <source type=\"%s\" srcset=\"%s\" sizes=\"%s\">\n", formatMediaTypes[format], html.EscapeString(rr.Srcset[format]), sizes)
+	}
+	// the images of every format are sorted by increasing width
+	target := slices.Max(options.Widths)
+	fallback := ResponsiveImage{}
+	for _, img := range rr.Images {
+		if img.Format == fallbackFormat && fallback.Width < target {
+			fallback = img
+		}
+	}
+	fmt.Fprintf(&b, "  <img src=\"%s\" srcset=\"%s\" sizes=\"%s\" width=\"%d\" height=\"%d\" alt=\"%s\">\n",
+		html.EscapeString(fallback.URL), html.EscapeString(rr.Srcset[fallbackFormat]), sizes, fallback.Width, fallback.Height, html.EscapeString(options.Alt))
+	b.WriteString("</picture>")
+	rr.Picture = b.String()
+}
+
+// imageSize reads the dimensions of the image file
+func imageSize(path string) (int, int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+	config, _, err := image.DecodeConfig(f)
+	if err != nil {
+		return 0, 0, err
+	}
+	return config.Width, config.Height, nil
+}
+
+// Responsive resizes the image to every width of the set (see ResponsiveOptions) and format, sharpening the
+// renditions (a zero SharpenOptions disables it), and builds the srcset and <picture> markup. baseURL is
+// prepended to the output file paths (relative to the output path) to build the image URLs.
+func (im *ImageManipulation) Responsive(basePath string, inputPath string, outputPath string, filename string, options ResponsiveOptions, sharpen SharpenOptions, baseURL string, debug bool) (ResponsiveResult, error) {
+	options = options.WithDefaults()
+	if len(options.Formats) == 0 {
+		options.Formats = []string{defaultOutputFormat(filename)}
+		if IsEncoderAvailable(FormatWebp) {
+			options.Formats = []string{FormatWebp, defaultOutputFormat(filename)}
+		}
+	}
+	if err := options.Validate(); err != nil {
+		return ResponsiveResult{}, err
+	}
+	srcWidth, srcHeight, err := imageSize(filepath.Join(inputPath, filename))
+	if err != nil {
+		return ResponsiveResult{}, errReadInput
+	}
+	widths := options.renditionWidths(srcWidth)
+	result := ResponsiveResult{Width: srcWidth, Height: srcHeight, Formats: options.Formats, Images: []ResponsiveImage{}}
+	for _, format := range options.Formats {
+		for _, width := range widths {
+			// the height of the source never limits the fit, the width does
+			output, err := im.ResizeWithOptions(basePath, inputPath, outputPath, filename, float64(width), float64(srcHeight), true, sharpen, EncodeOptions{Format: format, Quality: options.Quality}, debug)
+			if err != nil {
+				return ResponsiveResult{}, err
+			}
+			size := im.CalculateAspectRatioFit(srcWidth, srcHeight, width, srcHeight)
+			img := ResponsiveImage{
+				OutputFilePath: output,
+				URL:            baseURL + strings.Replace(output, outputPath, "", 100),
+				Format:         format,
+				Width:          int(size["width"]),
+				Height:         int(size["height"]),
+			}
+			if info, err := os.Stat(output); err == nil {
+				img.Bytes = int(info.Size())
+			}
+			result.Images = append(result.Images, img)
+		}
+	}
+	result.markup(options)
+	return result, nil
+}
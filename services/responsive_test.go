@@ -0,0 +1,67 @@
+package services
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResponsiveValidate(t *testing.T) {
+	assert := assert.New(t)
+	assert.Nil(ResponsiveOptions{Widths: []int{320, 640}}.WithDefaults().Validate(), "Widths should be valid")
+	assert.Nil(ResponsiveOptions{Widths: []int{320}, Densities: []float64{1, 2}, Formats: []string{FormatJpeg}}.WithDefaults().Validate(), "Densities should be valid")
+	assert.NotNil(ResponsiveOptions{}.WithDefaults().Validate(), "Widths should be required")
+	assert.NotNil(ResponsiveOptions{Widths: []int{0}}.WithDefaults().Validate(), "Zero width should be rejected")
+	assert.NotNil(ResponsiveOptions{Widths: []int{320}, Densities: []float64{8}}.WithDefaults().Validate(), "Densities above 4 should be rejected")
+	assert.NotNil(ResponsiveOptions{Widths: []int{320}, Formats: []string{FormatJpeg, FormatJpeg}}.WithDefaults().Validate(), "Duplicated formats should be rejected")
+	assert.ErrorIs(ResponsiveOptions{Widths: []int{320}, Formats: []string{"tiff"}}.WithDefaults().Validate(), ErrUnsupportedOutputFormat, "Unknown formats should be rejected")
+}
+
+func TestResponsiveRenditionWidths(t *testing.T) {
+	assert := assert.New(t)
+	options := ResponsiveOptions{Widths: []int{640, 320}, Densities: []float64{1, 2}}
+	assert.Equal([]int{320, 640, 1280}, options.renditionWidths(2000), "Widths should be distinct and sorted")
+	assert.Equal([]int{320, 640, 1000}, options.renditionWidths(1000), "Widths should be clamped to the source width")
+}
+
+func TestResponsiveMarkup(t *testing.T) {
+	assert := assert.New(t)
+	result := ResponsiveResult{
+		Formats: []string{FormatWebp, FormatJpeg},
+		Images: []ResponsiveImage{
+			{URL: "http://x/static/a-320.webp", Format: FormatWebp, Width: 320, Height: 160},
+			{URL: "http://x/static/a-640.webp", Format: FormatWebp, Width: 640, Height: 320},
+			{URL: "http://x/static/a-320.jpeg", Format: FormatJpeg, Width: 320, Height: 160},
+			{URL: "http://x/static/a-640.jpeg", Format: FormatJpeg, Width: 640, Height: 320},
+		},
+	}
+	result.markup(ResponsiveOptions{Widths: []int{320}, Sizes: "(max-width: 600px) 100vw, 50vw", Alt: `Hero "banner"`})
+	assert.Equal("http://x/static/a-320.jpeg 320w, http://x/static/a-640.jpeg 640w", result.Srcset[FormatJpeg], "Srcset should list the widths")
+	assert.True(strings.Contains(result.Picture, `<source type="image/webp" srcset="http://x/static/a-320.webp 320w, http://x/static/a-640.webp 640w"`), "Picture should have a webp source")
+	assert.True(strings.Contains(result.Picture, `<img src="http://x/static/a-320.jpeg"`), "Img src should cover the widest breakpoint")
+	assert.True(strings.Contains(result.Picture, `width="320" height="160" alt="Hero &#34;banner&#34;"`), "Img attributes should be escaped")
+	assert.False(strings.Contains(result.Picture, "image/jpeg"), "The fallback format should not have a source")
+}
+
+func TestImageManipulationResponsive(t *testing.T) {
+	assert := assert.New(t)
+	im := ImageManipulation{}
+	cwd, _ := os.Getwd()
+	rootDir := filepath.Clean(filepath.Join(cwd, ".."))
+	baseUploadPath := filepath.Join(rootDir, "storages", "test")
+	outputPath := filepath.Join(rootDir, "storages", "public")
+	options := ResponsiveOptions{Widths: []int{64, 128}, Densities: []float64{1, 2}, Formats: []string{FormatJpeg, FormatPng}}
+
+	result, err := im.Responsive(rootDir, baseUploadPath, outputPath, "sample-test.png", options, SharpenOptions{}, "http://localhost/static", false)
+	assert.Equal(nil, err, "Error should be nil")
+	assert.Equal(6, len(result.Images), "Every width should be rendered in every format")
+	for _, img := range result.Images {
+		assert.True(strings.HasPrefix(img.URL, "http://localhost/static/"), "URL should be built from the base URL")
+		assert.True(img.Bytes > 0, "Image should not be empty")
+		_ = os.Remove(img.OutputFilePath)
+	}
+	assert.True(strings.HasPrefix(result.Picture, "<picture>"), "Picture markup should be built")
+}
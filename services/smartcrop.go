@@ -0,0 +1,171 @@
+package services
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"slices"
+
+	"gocv.io/x/gocv"
+)
+
+// GravitySmart crops the most interesting region of the image
+const GravitySmart = "smart"
+
+const (
+	// the interest map is computed on a downscaled copy (longest side, in pixels)
+	smartCropAnalysisSize = 256
+	// weights of the interest map components
+	smartCropEdgeWeight       = 0.5
+	smartCropSaturationWeight = 0.3
+	smartCropSkinWeight       = 0.2
+)
+
+// skin tone range in the YCrCb color space
+var (
+	skinToneLower = gocv.NewScalar(0, 133, 77, 0)
+	skinToneUpper = gocv.NewScalar(255, 173, 127, 0)
+)
+
+// IsCropGravity tells whether the gravity can be used to crop (every gravity, plus smart and face)
+func IsCropGravity(gravity string) bool {
+	return gravity == GravitySmart || gravity == GravityFace || slices.Contains(Gravities, gravity)
+}
+
+// toBGR returns a 3 channels copy of the image
+func toBGR(src gocv.Mat) gocv.Mat {
+	dst := gocv.NewMat()
+	switch src.Channels() {
+	case 4:
+		gocv.CvtColor(src, &dst, gocv.ColorBGRAToBGR)
+	case 1:
+		gocv.CvtColor(src, &dst, gocv.ColorGrayToBGR)
+	default:
+		src.CopyTo(&dst)
+	}
+	return dst
+}
+
+// normalizedFloat converts an 8 bits single channel image into a float one in the 0 - 1 range
+func normalizedFloat(src gocv.Mat) gocv.Mat {
+	dst := gocv.NewMat()
+	src.ConvertToWithParams(&dst, gocv.MatTypeCV32F, 1.0/255, 0)
+	return dst
+}
+
+// interestMap scores every pixel of a downscaled copy of the image (0 - 1) by combining its edge density,
+// color saturation and skin tone. It returns the map (CV_32FC1) with the downscale factor.
+func interestMap(src gocv.Mat) (gocv.Mat, float64) {
+	bgr := toBGR(src)
+	defer bgr.Close()
+	scale := min(1, float64(smartCropAnalysisSize)/float64(max(bgr.Cols(), bgr.Rows())))
+	small := gocv.NewMat()
+	defer small.Close()
+	gocv.Resize(bgr, &small, image.Point{}, scale, scale, gocv.InterpolationArea)
+
+	// edge density
+	gray := gocv.NewMat()
+	defer gray.Close()
+	gocv.CvtColor(small, &gray, gocv.ColorBGRToGray)
+	edges := gocv.NewMat()
+	defer edges.Close()
+	gocv.Canny(gray, &edges, 50, 150)
+	gocv.GaussianBlur(edges, &edges, image.Point{}, 2, 2, gocv.BorderDefault)
+	edgesFloat := normalizedFloat(edges)
+	defer edgesFloat.Close()
+
+	// saturation
+	hsv := gocv.NewMat()
+	defer hsv.Close()
+	gocv.CvtColor(small, &hsv, gocv.ColorBGRToHSV)
+	channels := gocv.Split(hsv)
+	saturationFloat := normalizedFloat(channels[1])
+	defer saturationFloat.Close()
+	for _, channel := range channels {
+		channel.Close()
+	}
+
+	// skin tone
+	ycrcb := gocv.NewMat()
+	defer ycrcb.Close()
+	gocv.CvtColor(small, &ycrcb, gocv.ColorBGRToYCrCb)
+	skin := gocv.NewMat()
+	defer skin.Close()
+	gocv.InRangeWithScalar(ycrcb, skinToneLower, skinToneUpper, &skin)
+	skinFloat := normalizedFloat(skin)
+	defer skinFloat.Close()
+
+	scores := gocv.NewMat()
+	gocv.AddWeighted(edgesFloat, smartCropEdgeWeight, saturationFloat, smartCropSaturationWeight, 0, &scores)
+	gocv.AddWeighted(scores, 1, skinFloat, smartCropSkinWeight, 0, &scores)
+	return scores, scale
+}
+
+// bestWindow slides a width x height window over the cols x rows score map and returns the top left corner
+// of the window with the highest total score. Ties are resolved in favour of the most centered window.
+func bestWindow(scores []float32, cols int, rows int, width int, height int) image.Point {
+	width, height = min(max(1, width), cols), min(max(1, height), rows)
+	// summed area table, with an extra leading row and column of zeros
+	sums := make([]float64, (cols+1)*(rows+1))
+	for y := 0; y < rows; y++ {
+		row := 0.0
+		for x := 0; x < cols; x++ {
+			row += float64(scores[y*cols+x])
+			sums[(y+1)*(cols+1)+x+1] = sums[y*(cols+1)+x+1] + row
+		}
+	}
+	center := image.Pt((cols-width)/2, (rows-height)/2)
+	best, bestScore, bestDistance := center, -1.0, 0
+	for y := 0; y+height <= rows; y++ {
+		for x := 0; x+width <= cols; x++ {
+			score := sums[(y+height)*(cols+1)+x+width] - sums[y*(cols+1)+x+width] - sums[(y+height)*(cols+1)+x] + sums[y*(cols+1)+x]
+			dx, dy := x-center.X, y-center.Y
+			distance := dx*dx + dy*dy
+			if score > bestScore || (score == bestScore && distance < bestDistance) {
+				best, bestScore, bestDistance = image.Pt(x, y), score, distance
+			}
+		}
+	}
+	return best
+}
+
+// SmartCropRect picks the width x height window (clamped to the image size) covering the most interesting
+// region of the image
+func SmartCropRect(src gocv.Mat, width int, height int) (image.Rectangle, error) {
+	scores, scale := interestMap(src)
+	defer scores.Close()
+	data, err := scores.DataPtrFloat32()
+	if err != nil {
+		return image.Rectangle{}, err
+	}
+	width, height = min(width, src.Cols()), min(height, src.Rows())
+	pt := bestWindow(data, scores.Cols(), scores.Rows(), int(float64(width)*scale), int(float64(height)*scale))
+	x := min(int(float64(pt.X)/scale), src.Cols()-width)
+	y := min(int(float64(pt.Y)/scale), src.Rows()-height)
+	return image.Rect(x, y, x+width, y+height), nil
+}
+
+// SmartCropHeatmap renders the interest map over the image (jet color map, red being the most interesting)
+// and outlines the chosen crop window
+func SmartCropHeatmap(src gocv.Mat, rect image.Rectangle) (gocv.Mat, error) {
+	scores, _ := interestMap(src)
+	defer scores.Close()
+	if scores.Empty() {
+		return gocv.Mat{}, errors.New("failed to compute the interest map")
+	}
+	normalized := gocv.NewMat()
+	defer normalized.Close()
+	gocv.Normalize(scores, &normalized, 0, 255, gocv.NormMinMax)
+	normalized.ConvertTo(&normalized, gocv.MatTypeCV8U)
+	colored := gocv.NewMat()
+	defer colored.Close()
+	gocv.ApplyColorMap(normalized, &colored, gocv.ColormapJet)
+	gocv.Resize(colored, &colored, image.Pt(src.Cols(), src.Rows()), 0, 0, gocv.InterpolationLinear)
+
+	bgr := toBGR(src)
+	defer bgr.Close()
+	heatmap := gocv.NewMat()
+	gocv.AddWeighted(bgr, 0.5, colored, 0.5, 0, &heatmap)
+	gocv.Rectangle(&heatmap, rect, color.RGBA{R: 255, G: 255, B: 255, A: 255}, max(2, src.Cols()/300))
+	return heatmap, nil
+}
@@ -0,0 +1,63 @@
+package services
+
+import (
+	"image"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gocv.io/x/gocv"
+)
+
+func TestBestWindow(t *testing.T) {
+	assert := assert.New(t)
+	cols, rows := 10, 6
+	scores := make([]float32, cols*rows)
+	// interesting spot in the bottom right area
+	scores[4*cols+8], scores[5*cols+9] = 1, 1
+	assert.Equal(image.Pt(6, 2), bestWindow(scores, cols, rows, 4, 4), "Window should cover the interesting spot")
+	assert.Equal(image.Pt(3, 1), bestWindow(make([]float32, cols*rows), cols, rows, 4, 4), "Flat maps should be centered")
+	assert.Equal(image.Pt(0, 0), bestWindow(scores, cols, rows, 20, 20), "Window should be clamped to the map size")
+}
+
+func TestIsCropGravity(t *testing.T) {
+	assert := assert.New(t)
+	assert.True(IsCropGravity(GravitySmart), "Smart gravity should be a crop gravity")
+	assert.True(IsCropGravity(GravityNorthWest), "North west gravity should be a crop gravity")
+	assert.False(IsCropGravity("middle"), "Unknown gravity should not be a crop gravity")
+}
+
+func TestSmartCropRect(t *testing.T) {
+	assert := assert.New(t)
+	cwd, _ := os.Getwd()
+	rootDir := filepath.Clean(filepath.Join(cwd, ".."))
+	src := gocv.IMRead(filepath.Join(rootDir, "storages", "test", "sample-test.png"), gocv.IMReadColor)
+	defer src.Close()
+	rect, err := SmartCropRect(src, 300, 300)
+	assert.Equal(nil, err, "Error should be nil")
+	assert.Equal(300, rect.Dx(), "Width should be 300")
+	assert.Equal(300, rect.Dy(), "Height should be 300")
+	assert.True(rect.In(image.Rect(0, 0, src.Cols(), src.Rows())), "Window should be inside the image")
+}
+
+func TestImageManipulationCrop(t *testing.T) {
+	assert := assert.New(t)
+	im := ImageManipulation{}
+	cwd, _ := os.Getwd()
+	rootDir := filepath.Clean(filepath.Join(cwd, ".."))
+	baseUploadPath := filepath.Join(rootDir, "storages", "test")
+	outputPath := filepath.Join(rootDir, "storages", "public")
+
+	result, err := im.Crop(rootDir, baseUploadPath, outputPath, "sample-test.png", CropOptions{Width: 200, Height: 200, Gravity: GravitySmart}, EncodeOptions{Format: FormatJpeg}, true)
+	assert.Equal(nil, err, "Error should be nil")
+	assert.Equal(200, result.Width, "Width should be 200")
+	assert.NotEqual("", result.HeatmapFilePath, "Debug mode should write the heatmap")
+	if err == nil {
+		_ = os.Remove(result.OutputFilePath)
+		_ = os.Remove(result.HeatmapFilePath)
+	}
+
+	_, err2 := im.Crop(rootDir, baseUploadPath, outputPath, "sample-test.png", CropOptions{Width: 200, Height: 200, Gravity: "middle"}, EncodeOptions{Format: FormatJpeg}, false)
+	assert.ErrorIs(err2, ErrInvalidGravity, "Error 2 should be about the invalid gravity")
+}
@@ -0,0 +1,100 @@
+package services
+
+import (
+	"image"
+
+	"gocv.io/x/gocv"
+)
+
+// SSIM constants for 8-bit images ((0.01 * 255)^2 and (0.03 * 255)^2)
+const (
+	ssimC1 = 6.5025
+	ssimC2 = 58.5225
+)
+
+// grayFloat converts an image into its single channel (luma) float representation
+func grayFloat(src gocv.Mat) gocv.Mat {
+	gray := gocv.NewMat()
+	switch src.Channels() {
+	case 4:
+		gocv.CvtColor(src, &gray, gocv.ColorBGRAToGray)
+	case 3:
+		gocv.CvtColor(src, &gray, gocv.ColorBGRToGray)
+	default:
+		src.CopyTo(&gray)
+	}
+	r := gocv.NewMat()
+	gray.ConvertTo(&r, gocv.MatTypeCV32F)
+	gray.Close()
+	return r
+}
+
+func ssimBlur(src gocv.Mat) gocv.Mat {
+	r := gocv.NewMat()
+	gocv.GaussianBlur(src, &r, image.Point{X: 11, Y: 11}, 1.5, 1.5, gocv.BorderDefault)
+	return r
+}
+
+func ssimMultiply(a gocv.Mat, b gocv.Mat) gocv.Mat {
+	r := gocv.NewMat()
+	gocv.Multiply(a, b, &r)
+	return r
+}
+
+// SSIM computes the mean structural similarity index of two images of the same size (on their luma
+// channel, using a 11x11 gaussian window). 1 means identical images.
+func SSIM(a gocv.Mat, b gocv.Mat) float64 {
+	i1 := grayFloat(a)
+	defer i1.Close()
+	i2 := grayFloat(b)
+	defer i2.Close()
+
+	i1Sq := ssimMultiply(i1, i1)
+	defer i1Sq.Close()
+	i2Sq := ssimMultiply(i2, i2)
+	defer i2Sq.Close()
+	i1i2 := ssimMultiply(i1, i2)
+	defer i1i2.Close()
+
+	mu1 := ssimBlur(i1)
+	defer mu1.Close()
+	mu2 := ssimBlur(i2)
+	defer mu2.Close()
+	mu1Sq := ssimMultiply(mu1, mu1)
+	defer mu1Sq.Close()
+	mu2Sq := ssimMultiply(mu2, mu2)
+	defer mu2Sq.Close()
+	mu1mu2 := ssimMultiply(mu1, mu2)
+	defer mu1mu2.Close()
+
+	sigma1Sq := ssimBlur(i1Sq)
+	defer sigma1Sq.Close()
+	gocv.Subtract(sigma1Sq, mu1Sq, &sigma1Sq)
+	sigma2Sq := ssimBlur(i2Sq)
+	defer sigma2Sq.Close()
+	gocv.Subtract(sigma2Sq, mu2Sq, &sigma2Sq)
+	sigma12 := ssimBlur(i1i2)
+	defer sigma12.Close()
+	gocv.Subtract(sigma12, mu1mu2, &sigma12)
+
+	// (2 * mu1mu2 + C1) * (2 * sigma12 + C2)
+	mu1mu2.MultiplyFloat(2)
+	mu1mu2.AddFloat(ssimC1)
+	sigma12.MultiplyFloat(2)
+	sigma12.AddFloat(ssimC2)
+	numerator := ssimMultiply(mu1mu2, sigma12)
+	defer numerator.Close()
+
+	// (mu1^2 + mu2^2 + C1) * (sigma1^2 + sigma2^2 + C2)
+	gocv.Add(mu1Sq, mu2Sq, &mu1Sq)
+	mu1Sq.AddFloat(ssimC1)
+	gocv.Add(sigma1Sq, sigma2Sq, &sigma1Sq)
+	sigma1Sq.AddFloat(ssimC2)
+	denominator := ssimMultiply(mu1Sq, sigma1Sq)
+	defer denominator.Close()
+
+	ssimMap := gocv.NewMat()
+	defer ssimMap.Close()
+	gocv.Divide(numerator, denominator, &ssimMap)
+	return ssimMap.Mean().Val1
+}
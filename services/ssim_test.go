@@ -0,0 +1,27 @@
+package services
+
+import (
+	"image"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gocv.io/x/gocv"
+)
+
+func TestSSIM(t *testing.T) {
+	assert := assert.New(t)
+	cwd, _ := os.Getwd()
+	rootDir := filepath.Clean(filepath.Join(cwd, ".."))
+	src := gocv.IMRead(filepath.Join(rootDir, "storages", "test", "sample-test.png"), gocv.IMReadColor)
+	defer src.Close()
+
+	assert.InDelta(1.0, SSIM(src, src), 0.0001, "Identical images should have SSIM 1")
+
+	blurred := gocv.NewMat()
+	defer blurred.Close()
+	gocv.GaussianBlur(src, &blurred, image.Point{X: 15, Y: 15}, 0, 0, gocv.BorderDefault)
+	score := SSIM(src, blurred)
+	assert.True(score < 1 && score > 0, "Blurred image should have a lower SSIM")
+}
@@ -0,0 +1,102 @@
+package services
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"gocv.io/x/gocv"
+)
+
+// tracer creates the spans of the processing stages (they are dropped until a tracer provider is installed)
+var tracer = otel.Tracer("github.com/vafrcor/go-http-image-manipulation/services")
+
+// NewImageManipulation returns an ImageManipulation whose processing stages are traced as children of the
+// span of the context (the request span)
+func NewImageManipulation(ctx context.Context) *ImageManipulation {
+	return &ImageManipulation{ctx: ctx}
+}
+
+func (im *ImageManipulation) context() context.Context {
+	if im.ctx == nil {
+		return context.Background()
+	}
+	return im.ctx
+}
+
+// startSpan starts the span of a processing stage
+func (im *ImageManipulation) startSpan(name string, attrs ...attribute.KeyValue) trace.Span {
+	_, span := tracer.Start(im.context(), name, trace.WithAttributes(attrs...))
+	return span
+}
+
+// EndSpan records the error of the stage (if any) and ends its span, the controllers use it for the upload stages
+func EndSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// fileFormat names the format of an image file after its extension
+func fileFormat(path string) string {
+	return strings.TrimPrefix(strings.ToLower(filepath.Ext(path)), ".")
+}
+
+// matAttributes describes the dimensions of an image
+func matAttributes(img gocv.Mat) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		attribute.Int("image.width", img.Cols()),
+		attribute.Int("image.height", img.Rows()),
+		attribute.Int("image.channels", img.Channels()),
+	}
+}
+
+// readImage reads the input file (see readInput), traced as the image.read stage
+func (im *ImageManipulation) readImage(path string, keepAlpha bool) gocv.Mat {
+	span := im.startSpan("image.read", attribute.String("image.format", fileFormat(path)))
+	img := readInput(path, keepAlpha)
+	if img.Empty() {
+		span.SetStatus(codes.Error, "failed to read input file")
+	} else {
+		span.SetAttributes(matAttributes(img)...)
+	}
+	span.End()
+	return img
+}
+
+// startTransform starts the span of the image.transform stage, which covers the operation itself (the
+// attributes describe the source image)
+func (im *ImageManipulation) startTransform(src gocv.Mat, attrs ...attribute.KeyValue) trace.Span {
+	return im.startSpan("image.transform", append(matAttributes(src), attrs...)...)
+}
+
+// encodeImage encodes the image in memory (see encodeOutput), traced as the image.encode stage
+func (im *ImageManipulation) encodeImage(img gocv.Mat, encode EncodeOptions) ([]byte, error) {
+	span := im.startSpan("image.encode", append(matAttributes(img), attribute.String("image.format", encode.Format), attribute.Int("image.quality", encode.Quality))...)
+	data, err := encodeOutput(img, encode)
+	span.SetAttributes(attribute.Int("image.bytes", len(data)))
+	EndSpan(span, err)
+	return data, err
+}
+
+// writeImage encodes the image into the output file (see writeOutput), traced as the image.write stage
+func (im *ImageManipulation) writeImage(path string, img gocv.Mat, params []int) error {
+	span := im.startSpan("image.write", append(matAttributes(img), attribute.String("image.format", fileFormat(path)))...)
+	err := writeOutput(path, img, params)
+	EndSpan(span, err)
+	return err
+}
+
+// storeImage writes the encoded output file (see writeOutputBytes), traced as the image.store stage
+func (im *ImageManipulation) storeImage(path string, data []byte) error {
+	span := im.startSpan("image.store", attribute.String("image.format", fileFormat(path)), attribute.Int("image.bytes", len(data)))
+	err := writeOutputBytes(path, data)
+	EndSpan(span, err)
+	return err
+}
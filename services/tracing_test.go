@@ -0,0 +1,46 @@
+package services
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestImageManipulationTracing(t *testing.T) {
+	assert := assert.New(t)
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	ctx, request := provider.Tracer("test").Start(context.Background(), "request")
+	// the stages are traced by the tracer of the package, bound to the test provider
+	previous := tracer
+	defer func() { tracer = previous }()
+	tracer = provider.Tracer("github.com/vafrcor/go-http-image-manipulation/services")
+
+	cwd, _ := os.Getwd()
+	rootDir := filepath.Clean(filepath.Join(cwd, ".."))
+	baseUploadPath := filepath.Join(rootDir, "storages", "test")
+	outputPath := filepath.Join(rootDir, "storages", "public")
+	im := NewImageManipulation(ctx)
+	process, err := im.PngToJpeg(rootDir, baseUploadPath, outputPath, "sample-test.png", false)
+	request.End()
+	assert.Nil(err, "Error should be nil")
+	os.Remove(process)
+
+	spans := recorder.Ended()
+	names := []string{}
+	for _, span := range spans {
+		names = append(names, span.Name())
+	}
+	assert.Equal([]string{"image.read", "image.write", "request"}, names, "Read and write stages should be traced")
+	for _, span := range spans[:2] {
+		assert.Equal(request.SpanContext().SpanID(), span.Parent().SpanID(), "Stages should be children of the request span")
+	}
+	assert.Contains(spans[0].Attributes(), attribute.String("image.format", "png"))
+	assert.Contains(spans[1].Attributes(), attribute.String("image.format", fileFormat(process)))
+}
@@ -0,0 +1,323 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"unicode/utf8"
+
+	"gocv.io/x/gocv"
+)
+
+const (
+	defaultWatermarkOpacity  = 0.5
+	defaultWatermarkFontSize = 24
+	defaultWatermarkFont     = "simplex"
+	defaultWatermarkColor    = "#ffffff"
+)
+
+// maximum number of watermark tiles, the tiles are spread further apart beyond it
+const MaxWatermarkTiles = 1000
+
+// maximum length of the watermark text (in characters)
+const MaxWatermarkTextLength = 200
+
+// WatermarkDirectory holds the preconfigured logos (png files), relative to the base path
+var WatermarkDirectory = filepath.Join("storages", "watermarks")
+
+var watermarkFonts = map[string]gocv.HersheyFont{
+	"simplex":        gocv.FontHersheySimplex,
+	"plain":          gocv.FontHersheyPlain,
+	"duplex":         gocv.FontHersheyDuplex,
+	"complex":        gocv.FontHersheyComplex,
+	"triplex":        gocv.FontHersheyTriplex,
+	"complex_small":  gocv.FontHersheyComplexSmall,
+	"script_simplex": gocv.FontHersheyScriptSimplex,
+	"script_complex": gocv.FontHersheyScriptComplex,
+}
+
+// namePattern restricts the names of the stored assets (logos, LUTs), which are used as file names
+var namePattern = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+
+var ErrWatermarkLogoNotFound = NewError(CodeNotFound, "logo", "watermark logo not found")
+
+type WatermarkOptions struct {
+	// text watermark
+	Text     string `json:"text"`
+	Font     string `json:"font"`
+	FontSize int    `json:"font_size"`
+	Color    string `json:"color"`
+	// logo watermark: name of a preconfigured logo, or path of an uploaded one
+	Logo     string `json:"logo"`
+	LogoPath string `json:"-"`
+	// Scale sets the logo width relative to the image width (0 keeps the logo size)
+	Scale    float64 `json:"scale"`
+	Opacity  float64 `json:"opacity"`
+	Rotation float64 `json:"rotation"`
+	// Gravity places the watermark, the offsets move it away from the gravity edges
+	Gravity string `json:"gravity"`
+	OffsetX int    `json:"offset_x"`
+	OffsetY int    `json:"offset_y"`
+	// Tile repeats the watermark over the whole image
+	Tile        bool `json:"tile"`
+	TileSpacing int  `json:"tile_spacing"`
+}
+
+// WithDefaults fills the font (simplex, 24px, white), opacity (0.5) and gravity (southeast)
+func (wo WatermarkOptions) WithDefaults() WatermarkOptions {
+	if wo.Font == "" {
+		wo.Font = defaultWatermarkFont
+	}
+	if wo.FontSize == 0 {
+		wo.FontSize = defaultWatermarkFontSize
+	}
+	if wo.Color == "" {
+		wo.Color = defaultWatermarkColor
+	}
+	if wo.Opacity == 0 {
+		wo.Opacity = defaultWatermarkOpacity
+	}
+	if wo.Gravity == "" {
+		wo.Gravity = GravitySouthEast
+	}
+	return wo
+}
+
+func (wo WatermarkOptions) Validate() error {
+	hasLogo := wo.Logo != "" || wo.LogoPath != ""
+	if (wo.Text == "") == !hasLogo {
+		return InvalidOption("", "set either a watermark text or a logo")
+	}
+	if _, ok := watermarkFonts[wo.Font]; !ok {
+		return InvalidOption("font", "invalid font (choose either simplex, plain, duplex, complex, triplex, complex_small, script_simplex or script_complex)")
+	}
+	if utf8.RuneCountInString(wo.Text) > MaxWatermarkTextLength {
+		return InvalidOption("text", "invalid text (must be up to %d characters)", MaxWatermarkTextLength)
+	}
+	if wo.FontSize < 1 || wo.FontSize > 1000 {
+		return InvalidOption("font_size", "invalid font_size (must between 1 - 1000)")
+	}
+	if _, err := ParseHexColor(wo.Color); err != nil {
+		return err
+	}
+	if wo.Logo != "" && !namePattern.MatchString(wo.Logo) {
+		return InvalidOption("logo", "invalid logo name (only letters, digits, - and _ are allowed)")
+	}
+	if wo.Scale < 0 || wo.Scale > 1 {
+		return InvalidOption("scale", "invalid scale (must between 0 - 1)")
+	}
+	if wo.Opacity <= 0 || wo.Opacity > 1 {
+		return InvalidOption("opacity", "invalid opacity (must be greater than 0 and up to 1)")
+	}
+	if wo.Rotation < -360 || wo.Rotation > 360 {
+		return InvalidOption("rotation", "invalid rotation (must between -360 - 360)")
+	}
+	if !slices.Contains(Gravities, wo.Gravity) {
+		return ErrInvalidGravity
+	}
+	if wo.OffsetX < 0 || wo.OffsetY < 0 || wo.TileSpacing < 0 {
+		return InvalidOption("", "invalid offset or tile_spacing (must be positive)")
+	}
+	return nil
+}
+
+// rotateMat rotates the image (counter clockwise, in degrees) and grows the canvas to keep every corner.
+// The uncovered area is transparent (or black for images without alpha channel).
+func rotateMat(src gocv.Mat, angle float64) gocv.Mat {
+	width, height := float64(src.Cols()), float64(src.Rows())
+	radians := angle * math.Pi / 180
+	cos, sin := math.Abs(math.Cos(radians)), math.Abs(math.Sin(radians))
+	size := image.Pt(int(math.Ceil(width*cos+height*sin)), int(math.Ceil(width*sin+height*cos)))
+	center := image.Pt(src.Cols()/2, src.Rows()/2)
+	m := gocv.GetRotationMatrix2D(center, angle, 1)
+	defer m.Close()
+	// move the rotated image into the middle of the grown canvas
+	m.SetDoubleAt(0, 2, m.GetDoubleAt(0, 2)+float64(size.X/2-center.X))
+	m.SetDoubleAt(1, 2, m.GetDoubleAt(1, 2)+float64(size.Y/2-center.Y))
+	dst := gocv.NewMat()
+	gocv.WarpAffineWithParams(src, &dst, m, size, gocv.InterpolationLinear, gocv.BorderConstant, color.RGBA{})
+	return dst
+}
+
+// textOverlay renders the text with an antialiased Hershey font: the glyphs are drawn into an alpha mask
+// which is then filled with the text color. The mask is measured first and must fit in the canvas.
+func (wo WatermarkOptions) textOverlay(canvas image.Point) (*image.NRGBA, error) {
+	font := watermarkFonts[wo.Font]
+	thickness := max(1, wo.FontSize/12)
+	unit := gocv.GetTextSize(wo.Text, font, 1, thickness)
+	scale := float64(wo.FontSize) / float64(max(1, unit.Y))
+	size, baseline := gocv.GetTextSizeWithBaseline(wo.Text, font, scale, thickness)
+	width, height := size.X+2*thickness, size.Y+baseline+2*thickness
+	if err := checkTextMask(width, height, canvas); err != nil {
+		return nil, err
+	}
+	mask := gocv.NewMatWithSizeFromScalar(gocv.NewScalar(0, 0, 0, 0), height, width, gocv.MatTypeCV8UC1)
+	defer mask.Close()
+	gocv.PutTextWithParams(&mask, wo.Text, image.Pt(thickness, thickness+size.Y), font, scale, color.RGBA{R: 255, G: 255, B: 255, A: 255}, thickness, gocv.LineAA, false)
+	rendered := mask
+	if wo.Rotation != 0 {
+		rotated := rotateMat(mask, wo.Rotation)
+		defer rotated.Close()
+		rendered = rotated
+	}
+	img, err := rendered.ToImage()
+	if err != nil {
+		return nil, err
+	}
+	alpha, ok := img.(*image.Gray)
+	if !ok {
+		return nil, errors.New("failed to render watermark text")
+	}
+	c, _ := ParseHexColor(wo.Color)
+	overlay := image.NewNRGBA(alpha.Bounds())
+	for i, a := range alpha.Pix {
+		copy(overlay.Pix[i*4:i*4+4], []byte{c.R, c.G, c.B, a})
+	}
+	return overlay, nil
+}
+
+// checkTextMask rejects the text masks larger than the canvas or than MaxPixels
+func checkTextMask(width int, height int, canvas image.Point) error {
+	if width > canvas.X || height > canvas.Y || int64(width)*int64(height) > MaxPixels {
+		return InvalidOption("text", "invalid text (the text is larger than the image, lower font_size or shorten it)")
+	}
+	return nil
+}
+
+// logoOverlay loads the logo, scales it relative to the image width and rotates it
+func (wo WatermarkOptions) logoOverlay(basePath string, imageWidth int) (*image.NRGBA, error) {
+	path := wo.LogoPath
+	if path == "" {
+		path = filepath.Join(basePath, WatermarkDirectory, wo.Logo+".png")
+	}
+	if _, err := os.Stat(path); err != nil {
+		return nil, ErrWatermarkLogoNotFound
+	}
+	logo := readInput(path, true)
+	defer logo.Close()
+	if logo.Empty() {
+		return nil, ErrWatermarkLogoNotFound
+	}
+	if logo.Channels() != 4 {
+		gocv.CvtColor(logo, &logo, gocv.ColorBGRToBGRA)
+	}
+	if wo.Scale > 0 {
+		width := max(1, int(float64(imageWidth)*wo.Scale))
+		height := max(1, logo.Rows()*width/logo.Cols())
+		gocv.Resize(logo, &logo, image.Pt(width, height), 0, 0, gocv.InterpolationArea)
+	}
+	rendered := logo
+	if wo.Rotation != 0 {
+		rotated := rotateMat(logo, wo.Rotation)
+		defer rotated.Close()
+		rendered = rotated
+	}
+	img, err := rendered.ToImage()
+	if err != nil {
+		return nil, err
+	}
+	return cloneNRGBA(img), nil
+}
+
+// positions returns where the overlay is drawn: once according to the gravity and offsets, or on a grid
+// covering the whole canvas when tiling
+func (wo WatermarkOptions) positions(canvas image.Point, overlay image.Point) []image.Point {
+	if wo.Tile {
+		r := []image.Point{}
+		step := overlay.Add(image.Pt(wo.TileSpacing, wo.TileSpacing))
+		for tileCount(canvas.Sub(image.Pt(wo.OffsetX, wo.OffsetY)), step) > MaxWatermarkTiles {
+			step = step.Add(image.Pt(max(1, step.X/4), max(1, step.Y/4)))
+		}
+		for y := wo.OffsetY; y < canvas.Y; y += step.Y {
+			for x := wo.OffsetX; x < canvas.X; x += step.X {
+				r = append(r, image.Pt(x, y))
+			}
+		}
+		return r
+	}
+	pt := gravityPoint(canvas.X, canvas.Y, overlay.X, overlay.Y, wo.Gravity)
+	switch wo.Gravity {
+	case GravityEast, GravityNorthEast, GravitySouthEast:
+		pt.X -= wo.OffsetX
+	default:
+		pt.X += wo.OffsetX
+	}
+	switch wo.Gravity {
+	case GravitySouth, GravitySouthEast, GravitySouthWest:
+		pt.Y -= wo.OffsetY
+	default:
+		pt.Y += wo.OffsetY
+	}
+	return []image.Point{pt}
+}
+
+// tileCount returns the number of tiles spaced by step covering the area
+func tileCount(area image.Point, step image.Point) int64 {
+	if area.X <= 0 || area.Y <= 0 {
+		return 0
+	}
+	return int64((area.X+step.X-1)/step.X) * int64((area.Y+step.Y-1)/step.Y)
+}
+
+// apply alpha blends the watermark over the image and returns a BGRA image
+func (wo WatermarkOptions) apply(src gocv.Mat, basePath string) (gocv.Mat, error) {
+	var overlay *image.NRGBA
+	var err error
+	if wo.Text != "" {
+		overlay, err = wo.textOverlay(image.Pt(src.Cols(), src.Rows()))
+	} else {
+		overlay, err = wo.logoOverlay(basePath, src.Cols())
+	}
+	if err != nil {
+		return gocv.Mat{}, err
+	}
+	img, err := src.ToImage()
+	if err != nil {
+		return gocv.Mat{}, err
+	}
+	canvas := cloneNRGBA(img)
+	mask := image.NewUniform(color.Alpha{A: uint8(math.Round(wo.Opacity * 255))})
+	bounds := overlay.Bounds()
+	for _, pt := range wo.positions(canvas.Bounds().Size(), bounds.Size()) {
+		draw.DrawMask(canvas, bounds.Add(pt), overlay, image.Point{}, mask, image.Point{}, draw.Over)
+	}
+	return gocv.ImageToMatRGBA(canvas)
+}
+
+// Watermark overlays a text or a logo on the image and encodes it using the given options
+func (im *ImageManipulation) Watermark(basePath string, inputPath string, outputPath string, filename string, watermark WatermarkOptions, encode EncodeOptions, debug bool) (CompressResult, error) {
+	watermark = watermark.WithDefaults()
+	if err := watermark.Validate(); err != nil {
+		return CompressResult{}, err
+	}
+	return im.runSteps(basePath, inputPath, outputPath, filename, func(im *ImageManipulation) ([]pipelineStep, error) {
+		return []pipelineStep{watermarkStep(watermark, im.options.BasePath)}, nil
+	}, encode, debug)
+}
+
+func watermarkStep(watermark WatermarkOptions, basePath string) pipelineStep {
+	return func(src gocv.Mat) (gocv.Mat, error) {
+		return watermark.apply(src, basePath)
+	}
+}
+
+func init() {
+	registerPipelineStep("watermark", func(im *ImageManipulation, params json.RawMessage) (pipelineStep, error) {
+		var watermark WatermarkOptions
+		if err := decodeStepParams(params, &watermark); err != nil {
+			return nil, err
+		}
+		watermark = watermark.WithDefaults()
+		if err := watermark.Validate(); err != nil {
+			return nil, err
+		}
+		return watermarkStep(watermark, im.options.BasePath), nil
+	})
+}
@@ -0,0 +1,68 @@
+package services
+
+import (
+	"image"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWatermarkOptionsValidate(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal(nil, WatermarkOptions{Text: "(c) Shop"}.WithDefaults().Validate(), "Text watermark should be valid")
+	assert.Equal(nil, WatermarkOptions{Logo: "brand", Scale: 0.2}.WithDefaults().Validate(), "Logo watermark should be valid")
+	assert.Equal("set either a watermark text or a logo", WatermarkOptions{}.WithDefaults().Validate().Error(), "Missing text and logo should be rejected")
+	assert.Equal("set either a watermark text or a logo", WatermarkOptions{Text: "a", Logo: "brand"}.WithDefaults().Validate().Error(), "Text and logo should not be combined")
+	assert.NotEqual(nil, WatermarkOptions{Logo: "../secret"}.WithDefaults().Validate(), "Logo names should not contain paths")
+	assert.NotEqual(nil, WatermarkOptions{Text: "a", Font: "arial"}.WithDefaults().Validate(), "Unknown font should be rejected")
+	assert.NotEqual(nil, WatermarkOptions{Text: "a", Opacity: 1.5}.WithDefaults().Validate(), "Opacity above 1 should be rejected")
+	assert.ErrorIs(WatermarkOptions{Text: "a", Color: "white"}.WithDefaults().Validate(), ErrInvalidColor, "Color names should be rejected")
+	assert.ErrorIs(WatermarkOptions{Text: "a", Gravity: "middle"}.WithDefaults().Validate(), ErrInvalidGravity, "Unknown gravity should be rejected")
+	assert.ErrorIs(WatermarkOptions{Text: strings.Repeat("a", MaxWatermarkTextLength+1)}.WithDefaults().Validate(), ErrInvalidOption, "Long text should be rejected")
+	assert.Equal(nil, checkTextMask(100, 20, image.Pt(200, 100)), "Text fitting the image should be accepted")
+	assert.ErrorIs(checkTextMask(300, 20, image.Pt(200, 100)), ErrInvalidOption, "Text wider than the image should be rejected")
+}
+
+func TestWatermarkPositions(t *testing.T) {
+	assert := assert.New(t)
+	canvas, overlay := image.Pt(200, 100), image.Pt(50, 20)
+	pts := WatermarkOptions{Gravity: GravitySouthEast, OffsetX: 10, OffsetY: 5}.positions(canvas, overlay)
+	assert.Equal([]image.Point{{X: 140, Y: 75}}, pts, "South east watermark should be moved away from the corner")
+	pts2 := WatermarkOptions{Gravity: GravityNorthWest, OffsetX: 10, OffsetY: 5}.positions(canvas, overlay)
+	assert.Equal([]image.Point{{X: 10, Y: 5}}, pts2, "North west watermark should be moved away from the corner")
+	pts3 := WatermarkOptions{Tile: true, TileSpacing: 50}.positions(canvas, overlay)
+	assert.Equal(2*2, len(pts3), "Tiles should cover the whole canvas")
+	assert.Equal(image.Pt(100, 70), pts3[3], "Tiles should be spaced")
+	pts4 := WatermarkOptions{Tile: true}.positions(image.Pt(10000, 10000), image.Pt(1, 1))
+	assert.LessOrEqual(len(pts4), MaxWatermarkTiles, "Tiles should be spread further apart beyond the maximum")
+	assert.Greater(len(pts4), MaxWatermarkTiles/2, "Tiles should still cover the whole canvas")
+}
+
+func TestImageManipulationWatermark(t *testing.T) {
+	assert := assert.New(t)
+	im := ImageManipulation{}
+	cwd, _ := os.Getwd()
+	rootDir := filepath.Clean(filepath.Join(cwd, ".."))
+	baseUploadPath := filepath.Join(rootDir, "storages", "test")
+	outputPath := filepath.Join(rootDir, "storages", "public")
+
+	result, err := im.Watermark(rootDir, baseUploadPath, outputPath, "sample-test.png", WatermarkOptions{Text: "(c) Shop", Rotation: 30, Tile: true}, EncodeOptions{Format: FormatJpeg}, false)
+	assert.Equal(nil, err, "Error should be nil")
+	assert.Equal(FormatJpeg, result.Format, "Format should be jpeg")
+	if err == nil {
+		_ = os.Remove(result.OutputFilePath)
+	}
+
+	logoPath := filepath.Join(baseUploadPath, "sample-test.png")
+	result2, err2 := im.Watermark(rootDir, baseUploadPath, outputPath, "sample-test.png", WatermarkOptions{LogoPath: logoPath, Scale: 0.25}, EncodeOptions{Format: FormatPng}, false)
+	assert.Equal(nil, err2, "Error 2 should be nil")
+	if err2 == nil {
+		_ = os.Remove(result2.OutputFilePath)
+	}
+
+	_, err3 := im.Watermark(rootDir, baseUploadPath, outputPath, "sample-test.png", WatermarkOptions{Logo: "missing"}, EncodeOptions{Format: FormatPng}, false)
+	assert.ErrorIs(err3, ErrWatermarkLogoNotFound, "Error 3 should be about the missing logo")
+}
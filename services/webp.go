@@ -0,0 +1,92 @@
+package services
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+)
+
+// VP8X and ANMF chunk flags of the webp container
+const (
+	webpFlagAnimation   = 0x02
+	webpFlagAlpha       = 0x10
+	webpFrameNoBlending = 0x02
+)
+
+var ErrInvalidWebp = NewError(CodeDecodeFailed, "", "invalid webp data")
+
+func putUint24(b []byte, v int) {
+	b[0], b[1], b[2] = byte(v), byte(v>>8), byte(v>>16)
+}
+
+// riffChunk serialises a RIFF chunk (padded to an even size)
+func riffChunk(fourCC string, payload []byte) []byte {
+	r := make([]byte, 8, 8+len(payload)+1)
+	copy(r, fourCC)
+	binary.LittleEndian.PutUint32(r[4:], uint32(len(payload)))
+	r = append(r, payload...)
+	if len(payload)%2 == 1 {
+		r = append(r, 0)
+	}
+	return r
+}
+
+// webpFrameChunks extracts the image chunks (ALPH, VP8 and VP8L) of a still webp file
+func webpFrameChunks(data []byte) ([]byte, error) {
+	if len(data) < 12 || string(data[0:4]) != "RIFF" || string(data[8:12]) != "WEBP" {
+		return nil, ErrInvalidWebp
+	}
+	var r []byte
+	for i := 12; i+8 <= len(data); {
+		size := int(binary.LittleEndian.Uint32(data[i+4:]))
+		end := i + 8 + size
+		if end > len(data) {
+			return nil, ErrInvalidWebp
+		}
+		switch string(data[i : i+4]) {
+		case "ALPH", "VP8 ", "VP8L":
+			r = append(r, riffChunk(string(data[i:i+4]), data[i+8:end])...)
+		}
+		i = end + size%2
+	}
+	if len(r) == 0 {
+		return nil, ErrInvalidWebp
+	}
+	return r, nil
+}
+
+// muxAnimatedWebp builds an animated webp file out of still webp frames covering the whole canvas.
+// Durations are in milliseconds and a loop count of 0 means infinite looping.
+func muxAnimatedWebp(frames [][]byte, durations []int, width int, height int, loopCount int, hasAlpha bool) ([]byte, error) {
+	if loopCount < 0 || loopCount > math.MaxUint16 {
+		return nil, InvalidOption("loop_count", "invalid loop_count (must between 0 - %d plays)", math.MaxUint16)
+	}
+	vp8x := make([]byte, 10)
+	vp8x[0] = webpFlagAnimation
+	if hasAlpha {
+		vp8x[0] |= webpFlagAlpha
+	}
+	putUint24(vp8x[4:], width-1)
+	putUint24(vp8x[7:], height-1)
+	// transparent background color followed by the loop count
+	anim := make([]byte, 6)
+	binary.LittleEndian.PutUint16(anim[4:], uint16(loopCount))
+
+	body := bytes.NewBufferString("WEBP")
+	body.Write(riffChunk("VP8X", vp8x))
+	body.Write(riffChunk("ANIM", anim))
+	for i, frame := range frames {
+		chunks, err := webpFrameChunks(frame)
+		if err != nil {
+			return nil, err
+		}
+		// frame offset (0, 0), size, duration and flags, followed by the frame data
+		header := make([]byte, 16)
+		putUint24(header[6:], width-1)
+		putUint24(header[9:], height-1)
+		putUint24(header[12:], durations[i])
+		header[15] = webpFrameNoBlending
+		body.Write(riffChunk("ANMF", append(header, chunks...)))
+	}
+	return riffChunk("RIFF", body.Bytes()), nil
+}
@@ -0,0 +1,29 @@
+package services
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMuxAnimatedWebp(t *testing.T) {
+	assert := assert.New(t)
+	still, _ := base64.StdEncoding.DecodeString(webpProbeSample)
+	data, err := muxAnimatedWebp([][]byte{still, still}, []int{100, 250}, 1, 1, 0, true)
+	assert.Equal(nil, err, "Error should be nil")
+	assert.Equal("RIFF", string(data[0:4]), "Output should be a RIFF file")
+	assert.Equal(len(data)-8, int(binary.LittleEndian.Uint32(data[4:])), "RIFF size should cover the whole file")
+	assert.Equal("WEBPVP8X", string(data[8:16]), "Output should start with the extended header")
+	assert.Equal(byte(webpFlagAnimation|webpFlagAlpha), data[20], "Animation and alpha flags should be set")
+	assert.Equal("ANIM", string(data[30:34]), "Animation chunk should follow the extended header")
+	assert.Equal("ANMF", string(data[44:48]), "Frames should follow the animation chunk")
+	assert.Equal(100, int(data[64])|int(data[65])<<8|int(data[66])<<16, "First frame duration should be kept")
+
+	_, err2 := muxAnimatedWebp([][]byte{[]byte("GIF89a")}, []int{100}, 1, 1, 0, false)
+	assert.ErrorIs(err2, ErrInvalidWebp, "Error 2 should be about the invalid webp frame")
+
+	_, err3 := muxAnimatedWebp([][]byte{still}, []int{100}, 1, 1, 65536, false)
+	assert.ErrorIs(err3, ErrInvalidOption, "Error 3 should be about the loop count overflowing")
+}
@@ -0,0 +1,77 @@
+// Package tracing installs the OpenTelemetry tracer provider exporting the spans of the requests and of the
+// image processing stages
+package tracing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/vafrcor/go-http-image-manipulation/config"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+)
+
+// Setup installs the global tracer provider and propagators of the configuration. The returned function
+// flushes the pending spans and releases the exporter, it must be called when the server stops. Nothing is
+// installed with the none exporter (the spans are dropped).
+func Setup(cfg config.Tracing) (func(context.Context) error, error) {
+	shutdown := func(context.Context) error { return nil }
+	if cfg.Exporter == config.TracingNone {
+		return shutdown, nil
+	}
+	exporter, closer, err := newExporter(cfg)
+	if err != nil {
+		return nil, err
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceName(cfg.ServiceName))),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.SampleRatio))),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	return func(ctx context.Context) error {
+		err := provider.Shutdown(ctx)
+		if closer != nil {
+			err = errors.Join(err, closer.Close())
+		}
+		return err
+	}, nil
+}
+
+// newExporter creates the exporter of the configuration, and the file to close after it (if any)
+func newExporter(cfg config.Tracing) (sdktrace.SpanExporter, io.Closer, error) {
+	switch cfg.Exporter {
+	case config.TracingOTLP:
+		options := []otlptracehttp.Option{}
+		if cfg.Endpoint != "" {
+			options = append(options, otlptracehttp.WithEndpointURL(cfg.Endpoint))
+		}
+		// the exporter connects lazily, an unreachable collector only fails the exports
+		exporter, err := otlptracehttp.New(context.Background(), options...)
+		return exporter, nil, err
+	case config.TracingStdout:
+		exporter, err := stdouttrace.New(stdouttrace.WithPrettyPrint())
+		return exporter, nil, err
+	case config.TracingFile:
+		file, err := os.OpenFile(cfg.File, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to open the traces file: %w", err)
+		}
+		exporter, err := stdouttrace.New(stdouttrace.WithWriter(file))
+		if err != nil {
+			file.Close()
+			return nil, nil, err
+		}
+		return exporter, file, nil
+	}
+	return nil, nil, fmt.Errorf("unknown tracing exporter %q", cfg.Exporter)
+}
@@ -0,0 +1,36 @@
+package tracing
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vafrcor/go-http-image-manipulation/config"
+	"go.opentelemetry.io/otel"
+)
+
+func TestSetupFileExporter(t *testing.T) {
+	assert := assert.New(t)
+	cfg := config.Default().Tracing
+	cfg.Exporter = config.TracingFile
+	cfg.File = filepath.Join(t.TempDir(), "traces.json")
+	shutdown, err := Setup(cfg)
+	if !assert.Nil(err, "Error should be nil") {
+		return
+	}
+	_, span := otel.Tracer("test").Start(context.Background(), "image.read")
+	span.End()
+	assert.Nil(shutdown(context.Background()), "Shutdown should flush the spans")
+	data, _ := os.ReadFile(cfg.File)
+	assert.Contains(string(data), `"Name":"image.read"`, "Span should be written to the file")
+	assert.Contains(string(data), `"Value":{"Type":"STRING","Value":"go-http-image-manipulation"}`, "Service name should be the resource")
+}
+
+func TestSetupNone(t *testing.T) {
+	assert := assert.New(t)
+	shutdown, err := Setup(config.Default().Tracing)
+	assert.Nil(err, "Error should be nil")
+	assert.Nil(shutdown(context.Background()), "Error should be nil")
+}